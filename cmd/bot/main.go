@@ -4,7 +4,11 @@ import (
 	"GolangtgBot/internal/ai"
 	"GolangtgBot/internal/bot"
 	"GolangtgBot/internal/config"
+	"GolangtgBot/internal/rag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -36,7 +40,22 @@ func main() {
 		log.Println("Используется фейковая ИИ система!")
 	}
 
-	telegramBot, err := bot.NewBot(cfg.TelegramToken, aiClient, cfg.DebugMode)
+	ragPipeline, err := rag.NewRAGPipeline(cfg.RAGOptions(aiClient))
+	if err != nil {
+		log.Fatalf("Ошибка инициализации базы знаний: %v", err)
+	}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+
+		log.Println("Сохранение базы знаний перед остановкой")
+		ragPipeline.Snapshot()
+		os.Exit(0)
+	}()
+
+	telegramBot, err := bot.NewBot(cfg.TelegramToken, aiClient, ragPipeline, cfg.AdminIDs, cfg.DebugMode)
 	if err != nil {
 		log.Fatalf("Ошибка при создании сессии: %v", err)
 	}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"GolangtgBot/internal/rag"
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runBench сравнивает HNSW с полным перебором на синтетических
+// векторах: время построения, задержку запроса и полноту выдачи
+// относительно точного поиска, в том числе после удалений.
+//
+//	ragctl bench -n 50000 -dim 256 -ef 32,64,128
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := flags.Int("n", 20000, "число векторов")
+	dim := flags.Int("dim", 128, "размерность")
+	clusters := flags.Int("clusters", 50, "число кластеров в данных")
+	latent := flags.Int("latent", 24, "внутренняя размерность данных")
+	queries := flags.Int("queries", 200, "число запросов")
+	k := flags.Int("k", 10, "сколько соседей искать")
+	m := flags.Int("m", rag.DefaultHNSWM, "HNSW: M")
+	efConstruction := flags.Int("efc", rag.DefaultHNSWEfConstruction, "HNSW: efConstruction")
+	efList := flags.String("ef", "16,32,64,128,256", "HNSW: значения efSearch через запятую")
+	deleteShare := flags.Float64("delete", 0.1, "доля векторов, удаляемых во второй части замера")
+	seed := flags.Int64("seed", 1, "зерно генератора данных")
+	flags.Parse(args)
+
+	efs, err := parseInts(*efList)
+	if err != nil {
+		return err
+	}
+
+	random := rand.New(rand.NewSource(*seed))
+	space := newLatentSpace(random, *dim, *latent, *clusters)
+	vectors := space.sample(random, *n)
+	probes := space.sample(random, *queries)
+
+	flat := rag.NewFlatIndex()
+	flatBuild := timeIt(func() {
+		for i, vector := range vectors {
+			flat.Add(i, vector)
+		}
+	})
+
+	hnsw := rag.NewHNSWIndex(rag.HNSWOptions{M: *m, EfConstruction: *efConstruction})
+	hnswBuild := timeIt(func() {
+		for i, vector := range vectors {
+			hnsw.Add(i, vector)
+		}
+	})
+
+	fmt.Printf("Векторов: %d, размерность: %d, запросов: %d, k = %d\n", *n, *dim, *queries, *k)
+	fmt.Printf("Построение: перебор %v, HNSW (M=%d, efConstruction=%d) %v\n\n", flatBuild.Round(time.Millisecond), *m, *efConstruction, hnswBuild.Round(time.Millisecond))
+
+	exact, flatLatency := runQueries(flat, probes, *k)
+	type row struct {
+		ef      int
+		latency time.Duration
+		recall  float64
+	}
+	var rows []row
+	for _, ef := range efs {
+		hnsw.SetEfSearch(ef)
+		found, latency := runQueries(hnsw, probes, *k)
+		rows = append(rows, row{ef, latency, recallAt(found, exact)})
+	}
+
+	// Сохранение и загрузка графа, как рядом со снапшотом базы
+	var graph bytes.Buffer
+	idOf := func(docNum int) string { return strconv.Itoa(docNum) }
+	saveTime := timeIt(func() { err = hnsw.Save(&graph, idOf) })
+	if err != nil {
+		return err
+	}
+	size := graph.Len()
+	restored := rag.NewHNSWIndex(rag.HNSWOptions{M: *m, EfConstruction: *efConstruction})
+	loadTime := timeIt(func() {
+		err = restored.Load(&graph, func(id string) (int, []float64, bool) {
+			docNum, convErr := strconv.Atoi(id)
+			if convErr != nil || docNum >= len(vectors) {
+				return 0, nil, false
+			}
+			return docNum, vectors[docNum], true
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	removed := int(float64(*n) * *deleteShare)
+	deleteTime := timeIt(func() {
+		for _, docNum := range random.Perm(*n)[:removed] {
+			flat.Remove(docNum)
+			hnsw.Remove(docNum)
+		}
+	})
+	exactAfter, _ := runQueries(flat, probes, *k)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "индекс\tefSearch\tзапрос, мкс\trecall@%d\tпосле удаления %d\t\n", *k, removed)
+	fmt.Fprintf(table, "перебор\t-\t%d\t1.0000\t1.0000\t\n", flatLatency.Microseconds())
+	for _, r := range rows {
+		hnsw.SetEfSearch(r.ef)
+		found, _ := runQueries(hnsw, probes, *k)
+		fmt.Fprintf(table, "hnsw\t%d\t%d\t%.4f\t%.4f\t\n", r.ef, r.latency.Microseconds(), r.recall, recallAt(found, exactAfter))
+	}
+	table.Flush()
+
+	fmt.Printf("\nУдаление %d векторов из HNSW и перебора: %v\n", removed, deleteTime.Round(time.Millisecond))
+	fmt.Printf("Граф на диске: %.1f МБ, сохранение %v, загрузка %v (узлов %d)\n",
+		float64(size)/(1<<20), saveTime.Round(time.Millisecond), loadTime.Round(time.Millisecond), restored.Len())
+
+	return nil
+}
+
+// latentSpace порождает векторы, похожие на эмбеддинги текстов: точки
+// лежат около подпространства малой размерности и группируются по
+// темам, а в полную размерность переводятся случайной проекцией.
+type latentSpace struct {
+	projection [][]float64
+	centers    [][]float64
+}
+
+func newLatentSpace(random *rand.Rand, dim, latent, clusters int) latentSpace {
+	space := latentSpace{
+		projection: make([][]float64, dim),
+		centers:    make([][]float64, clusters),
+	}
+	for i := range space.projection {
+		space.projection[i] = gaussianVector(random, latent, 1)
+	}
+	for i := range space.centers {
+		space.centers[i] = gaussianVector(random, latent, 1)
+	}
+	return space
+}
+
+func (s latentSpace) sample(random *rand.Rand, n int) [][]float64 {
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		center := s.centers[random.Intn(len(s.centers))]
+		point := gaussianVector(random, len(center), 0.7)
+		for j := range point {
+			point[j] += center[j]
+		}
+
+		vector := gaussianVector(random, len(s.projection), 0.1)
+		norm := 0.0
+		for j, row := range s.projection {
+			for l, weight := range row {
+				vector[j] += weight * point[l]
+			}
+			norm += vector[j] * vector[j]
+		}
+
+		norm = math.Sqrt(norm)
+		for j := range vector {
+			vector[j] /= norm
+		}
+		vectors[i] = vector
+	}
+	return vectors
+}
+
+func gaussianVector(random *rand.Rand, dim int, scale float64) []float64 {
+	vector := make([]float64, dim)
+	for i := range vector {
+		vector[i] = random.NormFloat64() * scale
+	}
+	return vector
+}
+
+func runQueries(index rag.DenseIndex, probes [][]float64, k int) ([][]int, time.Duration) {
+	results := make([][]int, len(probes))
+	start := time.Now()
+	for i, probe := range probes {
+		for _, hit := range index.Search(probe, k, nil) {
+			results[i] = append(results[i], hit.DocNum)
+		}
+	}
+	return results, time.Since(start) / time.Duration(len(probes))
+}
+
+func recallAt(found, exact [][]int) float64 {
+	total, hits := 0, 0
+	for i := range exact {
+		expected := make(map[int]bool, len(exact[i]))
+		for _, docNum := range exact[i] {
+			expected[docNum] = true
+		}
+		for _, docNum := range found[i] {
+			if expected[docNum] {
+				hits++
+			}
+		}
+		total += len(exact[i])
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+func timeIt(fn func()) time.Duration {
+	start := time.Now()
+	fn()
+	return time.Since(start)
+}
+
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(list, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("ожидались положительные числа через запятую, получено %q", list)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
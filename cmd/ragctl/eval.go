@@ -0,0 +1,110 @@
+package main
+
+import (
+	"GolangtgBot/internal/config"
+	"GolangtgBot/internal/eval"
+	"GolangtgBot/internal/rag"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// runEval сравнивает две конфигурации поиска. Конфигурация задаётся
+// переменными окружения поверх текущих настроек:
+//
+//	ragctl eval -a "RAG_SCORER=bm25" -b "RAG_SCORER=tfidf; RAG_STEMMING=false"
+func runEval(args []string) error {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	corpusPath := flags.String("corpus", "examples/eval/corpus.jsonl", "JSONL с документами {id, content, metadata}")
+	queriesPath := flags.String("queries", "examples/eval/queries.jsonl", "JSONL с запросами {query, relevant, filter}")
+	k := flags.Int("k", 5, "сколько документов выдачи оценивать")
+	configA := flags.String("a", "", "первая конфигурация: KEY=VALUE; KEY=VALUE")
+	configB := flags.String("b", "", "вторая конфигурация; без неё печатается отчёт только по первой")
+	verbose := flags.Bool("v", false, "показать запросы, где выдача отличается")
+	showLog := flags.Bool("log", false, "не скрывать журнал поиска")
+	flags.Parse(args)
+
+	if !*showLog {
+		log.SetOutput(io.Discard)
+	}
+
+	corpus, err := eval.LoadCorpus(*corpusPath)
+	if err != nil {
+		return err
+	}
+	cases, err := eval.LoadCases(*queriesPath)
+	if err != nil {
+		return err
+	}
+
+	reportA, err := evaluateConfig(*configA, corpus, cases, *k)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Документов: %d, запросов: %d\n\n", len(corpus), len(cases))
+
+	if *configB == "" {
+		eval.WriteReport(os.Stdout, reportA)
+		return nil
+	}
+
+	reportB, err := evaluateConfig(*configB, corpus, cases, *k)
+	if err != nil {
+		return err
+	}
+
+	eval.WriteComparison(os.Stdout, reportA, reportB, *verbose)
+	return nil
+}
+
+func evaluateConfig(spec string, corpus []rag.Document, cases []eval.Case, k int) (eval.Report, error) {
+	overrides, err := parseOverrides(spec)
+	if err != nil {
+		return eval.Report{}, err
+	}
+
+	opts := config.LoadWith(overrides).RAGOptions(nil)
+	opts.StoragePath = ""
+	opts.Backend = rag.BackendMemory
+	opts.Seed = rag.SeedOptions{}
+
+	pipeline, err := rag.NewRAGPipeline(opts)
+	if err != nil {
+		return eval.Report{}, err
+	}
+
+	// Копия, чтобы конфигурации не делили подготовленные документы
+	docs := make([]rag.Document, len(corpus))
+	copy(docs, corpus)
+	if _, err := pipeline.AddDocuments(docs); err != nil {
+		return eval.Report{}, err
+	}
+
+	name := spec
+	if name == "" {
+		name = "текущая"
+	}
+
+	return eval.Run(name, pipeline.Retrieve, cases, k)
+}
+
+func parseOverrides(spec string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, pair := range strings.Split(spec, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("ожидалось KEY=VALUE, получено %q", pair)
+		}
+		overrides[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return overrides, nil
+}
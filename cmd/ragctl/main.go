@@ -0,0 +1,46 @@
+// ragctl - служебные команды для базы знаний без запуска бота.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Использование: ragctl <команда> [флаги]
+
+Команды:
+  eval    оценка качества поиска на эталонных запросах
+  export  выгрузка базы знаний в JSONL
+  import  загрузка документов из JSONL
+  bench   сравнение HNSW с полным перебором векторов
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "eval":
+		err = runEval(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "неизвестная команда: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ошибка:", err)
+		os.Exit(1)
+	}
+}
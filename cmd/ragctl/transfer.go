@@ -0,0 +1,113 @@
+package main
+
+import (
+	"GolangtgBot/internal/config"
+	"GolangtgBot/internal/rag"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// openStore открывает базу знаний из RAG_STORAGE_PATH. Бот в это время
+// должен быть остановлен, иначе журналы двух процессов перемешаются.
+func openStore(showLog bool) (*rag.RAGPipeline, error) {
+	if !showLog {
+		log.SetOutput(io.Discard)
+	}
+
+	opts := config.Load().RAGOptions(nil)
+	if opts.StoragePath == "" && opts.Backend != rag.BackendQdrant {
+		return nil, errors.New("не задан RAG_STORAGE_PATH")
+	}
+	opts.Seed = rag.SeedOptions{}
+
+	return rag.NewRAGPipeline(opts)
+}
+
+// runExport выгружает базу знаний в JSONL:
+//
+//	ragctl export -o backup.jsonl -filter "tag in (docker)"
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "файл для выгрузки, по умолчанию stdout")
+	vectors := flags.Bool("vectors", false, "сохранить векторы документов")
+	filterExpr := flags.String("filter", "", "выгрузить только документы, подходящие под фильтр")
+	showLog := flags.Bool("log", false, "не скрывать журнал")
+	flags.Parse(args)
+
+	opts := rag.ExportOptions{Vectors: *vectors}
+	if *filterExpr != "" {
+		filter, err := rag.ParseFilter(*filterExpr)
+		if err != nil {
+			return err
+		}
+		opts.Filters = append(opts.Filters, filter)
+	}
+
+	pipeline, err := openStore(*showLog)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count, err := pipeline.Export(w, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Выгружено документов: %d\n", count)
+	return nil
+}
+
+// runImport загружает JSONL в базу знаний и печатает ошибки по строкам:
+//
+//	ragctl import -collection global/docs backup.jsonl
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	collection := flags.String("collection", "", "коллекция для записей без коллекции, по умолчанию общая")
+	showLog := flags.Bool("log", false, "не скрывать журнал")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("укажите файл: ragctl import [флаги] <файл.jsonl>")
+	}
+
+	if *collection != "" {
+		if _, err := rag.ParseCollection(*collection); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pipeline, err := openStore(*showLog)
+	if err != nil {
+		return err
+	}
+
+	report, err := pipeline.Import(file, rag.ImportOptions{Collection: *collection, Source: "import"})
+	for _, lineErr := range report.Errors {
+		fmt.Fprintln(os.Stderr, lineErr)
+	}
+
+	fmt.Printf("Добавлено: %d, обновлено: %d, объединено: %d, без изменений: %d, ошибок: %d\n",
+		report.Added, report.Updated, report.Merged, report.Unchanged, len(report.Errors))
+
+	return err
+}
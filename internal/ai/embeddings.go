@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+type Embedder interface {
+	Name() string
+	Embed(texts []string) ([][]float64, error)
+}
+
+// EmbeddingClient работает с любым OpenAI-совместимым эндпоинтом
+// /embeddings (OpenAI, Ollama, LocalAI и т.п.).
+type EmbeddingClient struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+}
+
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingResponse struct {
+	Data  []EmbeddingData `json:"data"`
+	Error *APIError       `json:"error,omitempty"`
+}
+
+type EmbeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+func NewEmbeddingClient(apiKey, baseURL, model string) *EmbeddingClient {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1/embeddings"
+	}
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+
+	return &EmbeddingClient{
+		APIKey:  apiKey,
+		BaseURL: baseURL,
+		Model:   model,
+	}
+}
+
+func (c *EmbeddingClient) Name() string {
+	return c.Model
+}
+
+func (c *EmbeddingClient) Embed(texts []string) ([][]float64, error) {
+	requestBody := EmbeddingRequest{
+		Model: c.Model,
+		Input: texts,
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось составить запрос: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", c.BaseURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при создании запроса: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка отправления запроса: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == 401 {
+			return nil, fmt.Errorf("ошибка авторизации: неверный API ключ эмбеддингов")
+		} else if resp.StatusCode == 429 {
+			return nil, fmt.Errorf("превышен лимит запросов эмбеддингов, попробуйте позже")
+		}
+		return nil, fmt.Errorf("embeddings API ошибка: %s - %s", resp.Status, string(body))
+	}
+
+	var response EmbeddingResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("ошибка разбора ответа: %v", err)
+	}
+
+	if response.Error != nil {
+		return nil, fmt.Errorf("embeddings API ошибка: %s", response.Error.Message)
+	}
+
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("получено %d векторов вместо %d", len(response.Data), len(texts))
+	}
+
+	sort.Slice(response.Data, func(i, j int) bool {
+		return response.Data[i].Index < response.Data[j].Index
+	})
+
+	vectors := make([][]float64, len(response.Data))
+	for i, item := range response.Data {
+		vectors[i] = item.Embedding
+	}
+
+	return vectors, nil
+}
@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// HashEmbedder строит плотные векторы без внешнего API: слова и
+// символьные триграммы хешируются в фиксированное число измерений.
+// Смысловых синонимов он не знает, но устойчив к окончаниям и опечаткам,
+// поэтому годится как локальная замена настоящей модели эмбеддингов.
+type HashEmbedder struct {
+	Dimensions int
+}
+
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = 256
+	}
+
+	return &HashEmbedder{
+		Dimensions: dimensions,
+	}
+}
+
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", e.Dimensions)
+}
+
+func (e *HashEmbedder) Embed(texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float64 {
+	vector := make([]float64, e.Dimensions)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		e.add(vector, "w:"+word, 1)
+
+		runes := []rune("<" + word + ">")
+		for i := 0; i+3 <= len(runes); i++ {
+			e.add(vector, string(runes[i:i+3]), 0.5)
+		}
+	}
+
+	norm := 0.0
+	for _, value := range vector {
+		norm += value * value
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+
+	return vector
+}
+
+func (e *HashEmbedder) add(vector []float64, feature string, weight float64) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(feature))
+	hash := hasher.Sum64()
+
+	index := int(hash % uint64(e.Dimensions))
+	if hash&(1<<63) != 0 {
+		weight = -weight
+	}
+	vector[index] += weight
+}
@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"GolangtgBot/internal/rag"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func scopeOf(message *tgbotapi.Message) rag.Scope {
+	return rag.Scope{
+		ChatID:  message.Chat.ID,
+		UserID:  message.From.ID,
+		Private: message.Chat.IsPrivate(),
+	}
+}
+
+func (tb *TelegramBot) isAdmin(userID int64) bool {
+	return tb.admins[userID]
+}
+
+// searchScope ограничивает поиск активной коллекцией чата и общими.
+func (tb *TelegramBot) searchScope(message *tgbotapi.Message) rag.Filter {
+	return rag.InCollections(tb.ragPipeline.Collections().SearchScope(scopeOf(message))...)
+}
+
+// writableCollection возвращает активную коллекцию, если пользователь
+// может в неё писать. В общие коллекции пишут только администраторы.
+func (tb *TelegramBot) writableCollection(message *tgbotapi.Message) (rag.Collection, bool) {
+	collection := tb.ragPipeline.Collections().Active(scopeOf(message))
+
+	if collection.Kind == rag.CollectionGlobal && !tb.isAdmin(message.From.ID) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf(globalReadOnly, collectionTitle(collection)))
+		tb.bot.Send(msg)
+		return collection, false
+	}
+
+	return collection, true
+}
+
+// canManageCollection: общие коллекции удаляют администраторы бота,
+// личные - владелец, коллекции группы - создатель или админ группы.
+func (tb *TelegramBot) canManageCollection(userID int64, collection rag.Collection) bool {
+	if tb.isAdmin(userID) {
+		return true
+	}
+
+	switch collection.Kind {
+	case rag.CollectionGlobal:
+		return false
+	case rag.CollectionPersonal:
+		return collection.OwnerID == userID
+	}
+
+	if !collection.IsDefault() && collection.CreatedBy == userID {
+		return true
+	}
+
+	member, err := tb.bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID: collection.OwnerID,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		log.Printf("Ошибка проверки прав в чате %d: %v", collection.OwnerID, err)
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+func collectionTitle(collection rag.Collection) string {
+	if collection.IsDefault() {
+		switch collection.Kind {
+		case rag.CollectionPersonal:
+			return "личная"
+		case rag.CollectionGroup:
+			return "группы"
+		}
+	}
+	return collection.ShortName()
+}
+
+func (tb *TelegramBot) handleCollectionListCommand(message *tgbotapi.Message) {
+	scope := scopeOf(message)
+	active := tb.ragPipeline.Collections().Active(scope)
+
+	kinds := map[string]string{
+		rag.CollectionPersonal: "👤",
+		rag.CollectionGroup:    "👥",
+		rag.CollectionGlobal:   "🌐",
+	}
+
+	var builder strings.Builder
+	builder.WriteString("📚 Коллекции:\n\n")
+	for _, collection := range tb.ragPipeline.Collections().List(scope) {
+		marker := "  "
+		if collection.Name == active.Name {
+			marker = "▶️"
+		}
+		builder.WriteString(fmt.Sprintf("%s %s %s\n", marker, kinds[collection.Kind], collectionTitle(collection)))
+	}
+	builder.WriteString("\nПоиск идёт по активной коллекции ▶️ и всем общим 🌐")
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, builder.String())
+	tb.bot.Send(msg)
+}
+
+func (tb *TelegramBot) handleCollectionNewCommand(message *tgbotapi.Message) {
+	args := strings.Fields(strings.TrimPrefix(message.Text, "/rag_coll_new"))
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != "global") {
+		msg := tgbotapi.NewMessage(message.Chat.ID, collectionNewUsage)
+		tb.bot.Send(msg)
+		return
+	}
+
+	global := len(args) == 2
+	if global && !tb.isAdmin(message.From.ID) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, adminOnly)
+		tb.bot.Send(msg)
+		return
+	}
+
+	scope := scopeOf(message)
+	collection, err := tb.ragPipeline.Collections().Create(scope, args[0], global)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	text := fmt.Sprintf("✅ Коллекция %s создана", collectionTitle(collection))
+	if !global {
+		if err := tb.ragPipeline.Collections().SetActive(scope, collection); err != nil {
+			log.Printf("Ошибка сохранения активной коллекции: %v", err)
+		} else {
+			text += " и выбрана активной"
+		}
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	tb.bot.Send(msg)
+}
+
+func (tb *TelegramBot) handleCollectionUseCommand(message *tgbotapi.Message) {
+	name := strings.TrimSpace(strings.TrimPrefix(message.Text, "/rag_coll_use"))
+
+	scope := scopeOf(message)
+	collection, err := tb.ragPipeline.Collections().Resolve(scope, name)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	if err := tb.ragPipeline.Collections().SetActive(scope, collection); err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	text := fmt.Sprintf("▶️ Активная коллекция: %s", collectionTitle(collection))
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	tb.bot.Send(msg)
+}
+
+func (tb *TelegramBot) handleCollectionDropCommand(message *tgbotapi.Message) {
+	name := strings.TrimSpace(strings.TrimPrefix(message.Text, "/rag_coll_drop"))
+	if name == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, collectionDropUsage)
+		tb.bot.Send(msg)
+		return
+	}
+
+	collection, err := tb.ragPipeline.Collections().Resolve(scopeOf(message), name)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	if !tb.canManageCollection(message.From.ID, collection) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, collectionAccessDenied)
+		tb.bot.Send(msg)
+		return
+	}
+
+	removed, err := tb.ragPipeline.DropCollection(collection)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	text := fmt.Sprintf("🗑 Коллекция %s удалена (записей: %d)", collectionTitle(collection), removed)
+	if collection.IsDefault() {
+		text = fmt.Sprintf("🗑 Коллекция %s очищена (записей: %d)", collectionTitle(collection), removed)
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	tb.bot.Send(msg)
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"GolangtgBot/internal/rag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	callbackFeedback = "fb"
+
+	feedbackUp   = "up"
+	feedbackDown = "down"
+
+	// answerLogLimit - сколько последних ответов можно оценить
+	answerLogLimit = 1000
+	// feedbackReportLimit - сколько худших документов показывать в отчёте
+	feedbackReportLimit = 10
+)
+
+// answerLog помнит последние ответы, чтобы по нажатию кнопки сохранить
+// оценку вместе с вопросом, ответом и источниками: в данные кнопки
+// помещается только ID ответа. После перезапуска старые ответы оценить
+// уже нельзя.
+type answerLog struct {
+	answers map[string]rag.Feedback
+	order   []string
+	mu      sync.Mutex
+}
+
+func newAnswerLog() *answerLog {
+	return &answerLog{answers: make(map[string]rag.Feedback)}
+}
+
+// answerID - ID ответа на сообщение: ID вопроса уникален в чате.
+func answerID(message *tgbotapi.Message) string {
+	return fmt.Sprintf("%d_%d", message.Chat.ID, message.MessageID)
+}
+
+func (l *answerLog) add(answer rag.Feedback) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, exists := l.answers[answer.AnswerID]; !exists {
+		l.order = append(l.order, answer.AnswerID)
+	}
+	l.answers[answer.AnswerID] = answer
+
+	if len(l.order) > answerLogLimit {
+		delete(l.answers, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *answerLog) get(id string) (rag.Feedback, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	answer, found := l.answers[id]
+	return answer, found
+}
+
+// answerKeyboard - кнопки источников и под ними кнопки оценки ответа.
+func answerKeyboard(hits []rag.SearchHit, id string) *tgbotapi.InlineKeyboardMarkup {
+	feedbackRow := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("👍", callbackFeedback+":"+id+":"+feedbackUp),
+		tgbotapi.NewInlineKeyboardButtonData("👎", callbackFeedback+":"+id+":"+feedbackDown),
+	)
+
+	keyboard := sourcesKeyboard(hits)
+	if keyboard == nil {
+		markup := tgbotapi.NewInlineKeyboardMarkup(feedbackRow)
+		return &markup
+	}
+
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, feedbackRow)
+	return keyboard
+}
+
+// handleFeedbackCallback сохраняет оценку ответа. Повторное нажатие
+// той же кнопки ничего не меняет, другой - заменяет оценку.
+func (tb *TelegramBot) handleFeedbackCallback(callback *tgbotapi.CallbackQuery, payload string) {
+	id, vote, _ := strings.Cut(payload, ":")
+
+	var rating int
+	switch vote {
+	case feedbackUp:
+		rating = rag.RatingUp
+	case feedbackDown:
+		rating = rag.RatingDown
+	default:
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
+	feedback, found := tb.answers.get(id)
+	if !found {
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, feedbackExpired))
+		return
+	}
+
+	feedback.UserID = callback.From.ID
+	feedback.Rating = rating
+	feedback.CreatedAt = time.Now()
+
+	changed, err := tb.ragPipeline.Feedback().Add(feedback)
+	switch {
+	case err != nil:
+		log.Printf("Ошибка сохранения оценки: %v", err)
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, "❌ Не удалось сохранить оценку"))
+	case !changed:
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, feedbackAlreadySaved))
+	default:
+		log.Printf("Оценка %+d ответа %s от %d, источники: %v", rating, id, feedback.UserID, feedback.Sources)
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, feedbackSaved))
+	}
+}
+
+// handleFeedbackCommand показывает администратору итоги оценок и
+// документы, ответы по которым оценивали хуже всего.
+func (tb *TelegramBot) handleFeedbackCommand(message *tgbotapi.Message) {
+	if !tb.isAdmin(message.From.ID) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, adminOnly)
+		tb.bot.Send(msg)
+		return
+	}
+
+	feedback := tb.ragPipeline.Feedback()
+	up, down := feedback.Totals()
+	if up+down == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, noFeedback)
+		tb.bot.Send(msg)
+		return
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("📊 Оценки ответов: 👍 %d, 👎 %d\n", up, down))
+
+	worst := feedback.Worst(feedbackReportLimit)
+	if len(worst) == 0 {
+		builder.WriteString("\n✅ Документов с отрицательными оценками нет")
+	} else {
+		builder.WriteString("\nХуже всего оценены ответы по документам:\n")
+	}
+	for i, rating := range worst {
+		preview := "документ удалён"
+		if doc, found := tb.ragPipeline.GetDocument(rating.ID); found {
+			preview = previewText(doc.Content)
+		}
+		builder.WriteString(fmt.Sprintf("\n%d. %s (👍 %d, 👎 %d) - %s\n", i+1, rating.ID, rating.Up, rating.Down, preview))
+		if rating.LastQuestion != "" {
+			builder.WriteString(fmt.Sprintf("   Вопрос с 👎: %s\n", previewText(rating.LastQuestion)))
+		}
+	}
+
+	tb.sendSplitMessage(message.Chat.ID, builder.String(), message.MessageID)
+}
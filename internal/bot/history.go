@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"GolangtgBot/internal/rag"
+	"sync"
+)
+
+const historyLimit = 5
+
+// historyKey - диалог одного пользователя в одном чате. В группе у
+// каждого участника своя история, чтобы чужие вопросы не смешивались.
+type historyKey struct {
+	chatID int64
+	userID int64
+}
+
+// chatHistory хранит последние реплики каждого диалога в памяти, чтобы
+// уточняющие вопросы можно было переписать в полноценный запрос.
+type chatHistory struct {
+	turns map[historyKey][]rag.Turn
+	mu    sync.Mutex
+}
+
+func newChatHistory() *chatHistory {
+	return &chatHistory{turns: make(map[historyKey][]rag.Turn)}
+}
+
+func (h *chatHistory) get(chatID, userID int64) []rag.Turn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]rag.Turn(nil), h.turns[historyKey{chatID, userID}]...)
+}
+
+func (h *chatHistory) add(chatID, userID int64, turn rag.Turn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := historyKey{chatID, userID}
+	turns := append(h.turns[key], turn)
+	if len(turns) > historyLimit {
+		turns = turns[len(turns)-historyLimit:]
+	}
+	h.turns[key] = turns
+}
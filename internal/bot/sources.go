@@ -0,0 +1,263 @@
+package bot
+
+import (
+	"GolangtgBot/internal/rag"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	callbackSource = "src"
+
+	sourcePreviewLength = 80
+	sourceButtonsPerRow = 5
+
+	// maxCallbackData - предел Telegram для callback_data в байтах
+	maxCallbackData = 64
+)
+
+var citationRegexp = regexp.MustCompile(`\[(\d+)\]`)
+
+// citedSources оставляет источники, на которые модель сослалась в
+// ответе. Если ссылок нет, возвращаются все найденные.
+func citedSources(answer string, hits []rag.SearchHit) []rag.SearchHit {
+	cited := make(map[int]bool)
+	for _, match := range citationRegexp.FindAllStringSubmatch(answer, -1) {
+		if rank, err := strconv.Atoi(match[1]); err == nil {
+			cited[rank] = true
+		}
+	}
+
+	var result []rag.SearchHit
+	for _, hit := range hits {
+		if cited[hit.Rank] {
+			result = append(result, hit)
+		}
+	}
+
+	if len(result) == 0 {
+		return hits
+	}
+	return result
+}
+
+func sourceIDs(hits []rag.SearchHit) []string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.Document.ID
+	}
+	return ids
+}
+
+// contextNote предупреждает, что часть найденных источников не
+// поместилась в контекст модели целиком.
+func contextNote(report rag.ContextReport, hits []rag.SearchHit) string {
+	trimmed := make(map[string]bool, len(report.Trimmed))
+	for _, id := range report.Trimmed {
+		trimmed[id] = true
+	}
+
+	var ranks []string
+	for _, hit := range hits {
+		if trimmed[hit.Document.ID] {
+			ranks = append(ranks, fmt.Sprintf("[%d]", hit.Rank))
+		}
+	}
+
+	var note string
+	if len(ranks) > 0 {
+		note += "\n\n" + fmt.Sprintf(contextTrimmedNote, strings.Join(ranks, ", "))
+	}
+	if len(report.Dropped) > 0 {
+		note += "\n\n" + fmt.Sprintf(contextDroppedNote, len(report.Dropped))
+	}
+	return note
+}
+
+// sourcesFooter - список источников с выдержками, совпавшие с вопросом
+// слова выделены.
+func sourcesFooter(hits []rag.SearchHit) formattedText {
+	var footer formattedText
+	if len(hits) == 0 {
+		return footer
+	}
+
+	footer.write("📚 Источники:")
+	for _, hit := range hits {
+		footer.write(fmt.Sprintf("\n\n[%d] %s (%.2f)\n", hit.Rank, hit.Document.ID, hit.Score))
+		footer.writeSnippet(hit)
+	}
+
+	return footer
+}
+
+// formattedText - текст с сущностями Telegram. Смещения сущностей
+// считаются в UTF-16, как того требует Bot API.
+type formattedText struct {
+	text     string
+	entities []tgbotapi.MessageEntity
+	length   int
+}
+
+func (f *formattedText) write(text string) {
+	f.text += text
+	f.length += utf16Length(text)
+}
+
+// writeSnippet пишет выдержку источника, выделяя совпадения жирным
+// с подчёркиванием. Без выдержки пишется начало документа.
+func (f *formattedText) writeSnippet(hit rag.SearchHit) {
+	snippet := hit.Snippet
+	if snippet.Text == "" {
+		f.write(previewText(hit.Document.Content))
+		return
+	}
+
+	written := 0
+	for _, span := range snippet.Highlights {
+		f.write(snippet.Text[written:span.Start])
+
+		word := snippet.Text[span.Start:span.End]
+		for _, entityType := range []string{"bold", "underline"} {
+			f.entities = append(f.entities, tgbotapi.MessageEntity{
+				Type:   entityType,
+				Offset: f.length,
+				Length: utf16Length(word),
+			})
+		}
+		f.write(word)
+		written = span.End
+	}
+	f.write(snippet.Text[written:])
+}
+
+// shifted - те же сущности после offset символов UTF-16 другого текста.
+func (f formattedText) shifted(offset int) []tgbotapi.MessageEntity {
+	entities := make([]tgbotapi.MessageEntity, len(f.entities))
+	for i, entity := range f.entities {
+		entity.Offset += offset
+		entities[i] = entity
+	}
+	return entities
+}
+
+func utf16Length(text string) int {
+	length := 0
+	for _, r := range text {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
+
+// sendFormatted отправляет текст с сущностями одним сообщением. Если
+// он не помещается, уходит частями без выделения: при разбиении
+// смещения сущностей уже не совпадут с текстом.
+func (tb *TelegramBot) sendFormatted(chatID int64, text formattedText, replyToMessageID int, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	if len(text.text) > maxMessageLength {
+		tb.sendSplitMessageWithKeyboard(chatID, text.text, replyToMessageID, keyboard)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text.text)
+	msg.Entities = text.entities
+	msg.ReplyToMessageID = replyToMessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+
+	if _, err := tb.bot.Send(msg); err != nil {
+		log.Printf("Ошибка отправки сообщения: %v", err)
+	}
+}
+
+// sendAnswerWithSources отправляет ответ и источники к нему одним
+// сообщением, а если ответ длинный - источники отдельным после него.
+func (tb *TelegramBot) sendAnswerWithSources(chatID int64, answer string, hits []rag.SearchHit, replyToMessageID int, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	footer := sourcesFooter(hits)
+
+	if len(answer)+len(footer.text)+2 > maxMessageLength {
+		tb.sendSplitMessage(chatID, answer, replyToMessageID)
+		tb.sendFormatted(chatID, footer, replyToMessageID, keyboard)
+		return
+	}
+
+	prefix := answer + "\n\n"
+	message := formattedText{
+		text:     prefix + footer.text,
+		entities: footer.shifted(utf16Length(prefix)),
+	}
+	tb.sendFormatted(chatID, message, replyToMessageID, keyboard)
+}
+
+// previewText - начало текста в одну строку.
+func previewText(text string) string {
+	preview := strings.Join(strings.Fields(text), " ")
+	if runes := []rune(preview); len(runes) > sourcePreviewLength {
+		preview = string(runes[:sourcePreviewLength]) + "…"
+	}
+	return preview
+}
+
+// sourcesKeyboard - по кнопке на источник, нажатие присылает его полный
+// текст. Источник с ID длиннее, чем влезает в callback_data, остаётся
+// без кнопки: иначе Telegram отклонит всё сообщение.
+func sourcesKeyboard(hits []rag.SearchHit) *tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, hit := range hits {
+		data := callbackSource + ":" + hit.Document.ID
+		if len(data) > maxCallbackData {
+			log.Printf("Источник %s без кнопки: ID не помещается в callback_data", hit.Document.ID)
+			continue
+		}
+
+		label := fmt.Sprintf("📄 [%d]", hit.Rank)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, data))
+		if len(row) == sourceButtonsPerRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+// handleSourceCallback присылает полный текст источника, если он виден
+// в этом чате - чужие коллекции через подменённую кнопку не открыть.
+func (tb *TelegramBot) handleSourceCallback(callback *tgbotapi.CallbackQuery, docID string) {
+	message := callback.Message
+	if message == nil {
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
+	scope := tb.ragPipeline.Collections().SearchScope(rag.Scope{
+		ChatID:  message.Chat.ID,
+		UserID:  callback.From.ID,
+		Private: message.Chat.IsPrivate(),
+	})
+
+	doc, found := tb.ragPipeline.GetDocument(docID)
+	if !found || !rag.InCollections(scope...).Match(doc) {
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, "Источник не найден"))
+		return
+	}
+
+	tb.bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+
+	text := fmt.Sprintf("📄 %s\n\n%s", doc.ID, doc.Content)
+	tb.sendSplitMessage(message.Chat.ID, text, message.MessageID)
+}
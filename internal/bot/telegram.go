@@ -3,21 +3,34 @@ package bot
 import (
 	"GolangtgBot/internal/ai"
 	"GolangtgBot/internal/rag"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// Bot API отдаёт через getFile файлы не больше 20 МБ
+const maxUploadSize = 20 << 20
+
+// maxMessageLength - длина части сообщения с запасом до лимита Telegram
+const maxMessageLength = 3800
+
 type TelegramBot struct {
 	bot         *tgbotapi.BotAPI
 	aiClient    ai.AIClient
 	ragPipeline *rag.RAGPipeline
+	history     *chatHistory
+	answers     *answerLog
+	admins      map[int64]bool
 	debugMode   bool
 }
 
-func NewBot(token string, aiClient ai.AIClient, debug bool) (*TelegramBot, error) {
+func NewBot(token string, aiClient ai.AIClient, ragPipeline *rag.RAGPipeline, adminIDs []int64, debug bool) (*TelegramBot, error) {
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка создания сессии: %v", err)
@@ -26,12 +39,18 @@ func NewBot(token string, aiClient ai.AIClient, debug bool) (*TelegramBot, error
 	bot.Debug = debug
 	log.Printf("Авторизация аккаунта %s", bot.Self.UserName)
 
-	ragPipeline := rag.NewRAGPipeline()
+	admins := make(map[int64]bool, len(adminIDs))
+	for _, id := range adminIDs {
+		admins[id] = true
+	}
 
 	return &TelegramBot{
 		bot:         bot,
 		aiClient:    aiClient,
 		ragPipeline: ragPipeline,
+		history:     newChatHistory(),
+		answers:     newAnswerLog(),
+		admins:      admins,
 		debugMode:   debug,
 	}, nil
 }
@@ -62,6 +81,50 @@ func (tb *TelegramBot) Start() {
 			Command:     "rag_add",
 			Description: "Добавить документ в базу знаний",
 		},
+		{
+			Command:     "rag_find",
+			Description: "Поиск по базе знаний с фильтром",
+		},
+		{
+			Command:     "rag_del",
+			Description: "Удалить документ по ID",
+		},
+		{
+			Command:     "rag_edit",
+			Description: "Изменить текст документа по ID",
+		},
+		{
+			Command:     "rag_coll_list",
+			Description: "Список коллекций",
+		},
+		{
+			Command:     "rag_coll_new",
+			Description: "Создать коллекцию",
+		},
+		{
+			Command:     "rag_coll_use",
+			Description: "Переключить активную коллекцию",
+		},
+		{
+			Command:     "rag_coll_drop",
+			Description: "Удалить коллекцию",
+		},
+		{
+			Command:     "rag_dups",
+			Description: "Найти почти одинаковые документы",
+		},
+		{
+			Command:     "rag_export",
+			Description: "Выгрузить базу знаний в JSONL",
+		},
+		{
+			Command:     "rag_import",
+			Description: "Загрузить документы из JSONL",
+		},
+		{
+			Command:     "rag_feedback",
+			Description: "Оценки ответов и худшие документы",
+		},
 	}
 
 	config := tgbotapi.NewSetMyCommands(commands...)
@@ -90,11 +153,33 @@ func (tb *TelegramBot) handleUpdate(update tgbotapi.Update) {
 	if update.Message != nil {
 		tb.handleMessage(update.Message)
 	}
+
+	if update.CallbackQuery != nil {
+		tb.handleCallback(update.CallbackQuery)
+	}
+}
+
+func (tb *TelegramBot) handleCallback(callback *tgbotapi.CallbackQuery) {
+	action, payload, _ := strings.Cut(callback.Data, ":")
+
+	switch action {
+	case callbackSource:
+		tb.handleSourceCallback(callback, payload)
+	case callbackFeedback:
+		tb.handleFeedbackCallback(callback, payload)
+	default:
+		tb.bot.Request(tgbotapi.NewCallback(callback.ID, ""))
+	}
 }
 
 func (tb *TelegramBot) handleMessage(message *tgbotapi.Message) {
 	log.Printf("[%s] %s", message.From.UserName, message.Text)
 
+	if message.Document != nil {
+		tb.handleDocumentUpload(message)
+		return
+	}
+
 	if message.IsCommand() {
 		tb.handleCommand(message)
 		return
@@ -117,6 +202,29 @@ func (tb *TelegramBot) handleCommand(message *tgbotapi.Message) {
 		tb.handleRAGStatsCommand(message)
 	case "rag_add":
 		tb.handleRAGAddCommand(message)
+	case "rag_find":
+		tb.handleRAGFindCommand(message)
+	case "rag_del":
+		tb.handleRAGDeleteCommand(message)
+	case "rag_edit":
+		tb.handleRAGEditCommand(message)
+	case "rag_coll_list":
+		tb.handleCollectionListCommand(message)
+	case "rag_coll_new":
+		tb.handleCollectionNewCommand(message)
+	case "rag_coll_use":
+		tb.handleCollectionUseCommand(message)
+	case "rag_coll_drop":
+		tb.handleCollectionDropCommand(message)
+	case "rag_dups":
+		tb.handleRAGDuplicatesCommand(message)
+	case "rag_export":
+		tb.handleExportCommand(message)
+	case "rag_import":
+		msg := tgbotapi.NewMessage(message.Chat.ID, importUsage)
+		tb.bot.Send(msg)
+	case "rag_feedback":
+		tb.handleFeedbackCommand(message)
 	default:
 		tb.handleUnknownCommand(message)
 	}
@@ -170,18 +278,61 @@ func (tb *TelegramBot) handleRAGStatsCommand(message *tgbotapi.Message) {
 • Документов в базе: %d
 • Слов в словаре: %d
 • Размер хранилища: %s
+• Ранжирование: %s
+• Эмбеддер: %s (векторов: %d)
+• Хранилище: %s
 
 Используйте /rag_add чтобы добавить документы в базу знаний.`,
 
 		stats["total_documents"],
 		stats["vocabulary_size"],
-		stats["store_size"])
+		stats["store_size"],
+		stats["scorer"],
+		stats["embedder"],
+		stats["embedded"],
+		stats["backend"])
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
 	//msg.ParseMode = "Markdown"
 	tb.bot.Send(msg)
 }
 
+// handleRAGDuplicatesCommand показывает администратору группы почти
+// одинаковых документов по всей базе.
+func (tb *TelegramBot) handleRAGDuplicatesCommand(message *tgbotapi.Message) {
+	if !tb.isAdmin(message.From.ID) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, adminOnly)
+		tb.bot.Send(msg)
+		return
+	}
+
+	clusters := tb.ragPipeline.DuplicateClusters()
+	if len(clusters) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, noDuplicates)
+		tb.bot.Send(msg)
+		return
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("🔍 Найдено групп похожих документов: %d\n", len(clusters)))
+	for i, cluster := range clusters {
+		builder.WriteString(fmt.Sprintf("\n%d.\n", i+1))
+		for _, id := range cluster {
+			doc, found := tb.ragPipeline.GetDocument(id)
+			if !found {
+				continue
+			}
+			collection := doc.Metadata.Collection
+			if collection == "" {
+				collection = rag.GlobalCollection
+			}
+			builder.WriteString(fmt.Sprintf("• %s [%s] - %s\n", id, collection, previewText(doc.Content)))
+		}
+	}
+
+	tb.sendSplitMessage(message.Chat.ID, builder.String(), message.MessageID)
+}
+
 func (tb *TelegramBot) handleRAGAddCommand(message *tgbotapi.Message) {
 	content := strings.TrimSpace(strings.TrimPrefix(message.Text, "/rag_add"))
 
@@ -193,14 +344,259 @@ func (tb *TelegramBot) handleRAGAddCommand(message *tgbotapi.Message) {
 		return
 	}
 
-	docID := tb.ragPipeline.AddDocument(content)
+	collection, ok := tb.writableCollection(message)
+	if !ok {
+		return
+	}
+
+	result, err := tb.ragPipeline.AddDocument(content, rag.Metadata{
+		Source:     "telegram",
+		Collection: collection.Name,
+		AuthorID:   message.From.ID,
+		ChatID:     message.Chat.ID,
+		CreatedAt:  message.Time(),
+		Tags:       rag.ExtractHashtags(content),
+	})
+	if reply, handled := duplicateReply(result, err); handled {
+		msg := tgbotapi.NewMessage(message.Chat.ID, reply)
+		tb.bot.Send(msg)
+		return
+	}
 
-	text := fmt.Sprintf("✅ Документ добавлен в базу знаний\n\nID: `%s`\nТекст: %s", docID, content)
+	text := fmt.Sprintf("✅ Документ добавлен в коллекцию %s\n\nID: `%s`\nТекст: %s", collectionTitle(collection), result.ID, content)
+	if result.Chunks > 1 {
+		text += fmt.Sprintf("\n\nДокумент разбит на %d фрагментов", result.Chunks)
+	}
+	if result.Duplicate != nil {
+		text += fmt.Sprintf("\n\n🔗 Похож на документ `%s` (сходство %.0f%%)", result.Duplicate.ID, result.Duplicate.Similarity*100)
+	}
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
 	//msg.ParseMode = "Markdown"
 	tb.bot.Send(msg)
 }
 
+// handleDocumentUpload скачивает присланный файл через Telegram API и
+// добавляет извлечённый текст в базу знаний. #теги берутся из подписи.
+func (tb *TelegramBot) handleDocumentUpload(message *tgbotapi.Message) {
+	if captionCommand(message) == "rag_import" {
+		tb.handleImportUpload(message)
+		return
+	}
+
+	document := message.Document
+
+	if document.FileSize > maxUploadSize {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Файл слишком большой, максимум %d МБ", maxUploadSize>>20))
+		tb.bot.Send(msg)
+		return
+	}
+
+	if rag.DetectFormat(document.FileName, document.MimeType) == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, unsupportedFile)
+		tb.bot.Send(msg)
+		return
+	}
+
+	collection, ok := tb.writableCollection(message)
+	if !ok {
+		return
+	}
+
+	tb.bot.Send(tgbotapi.NewChatAction(message.Chat.ID, tgbotapi.ChatUploadDocument))
+
+	data, err := tb.downloadFile(document.FileID)
+	if err != nil {
+		log.Printf("Ошибка загрузки файла %s: %v", document.FileName, err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Не удалось скачать файл: "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	result, err := tb.ragPipeline.AddFile(document.FileName, document.MimeType, data, rag.Metadata{
+		Source:     "telegram_file",
+		Collection: collection.Name,
+		AuthorID:   message.From.ID,
+		ChatID:     message.Chat.ID,
+		CreatedAt:  message.Time(),
+		Tags:       rag.ExtractHashtags(message.Caption),
+	})
+	if reply, handled := duplicateReply(result, err); handled {
+		msg := tgbotapi.NewMessage(message.Chat.ID, reply)
+		tb.bot.Send(msg)
+		return
+	}
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	text := fmt.Sprintf("✅ Файл %s добавлен в коллекцию %s\n\nID: `%s`\nФрагментов: %d",
+		document.FileName, collectionTitle(collection), result.ID, result.Chunks)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	tb.bot.Send(msg)
+}
+
+// duplicateReply формирует ответ, если документ не был добавлен как
+// новый: отклонён как копия или объединён с похожим.
+func duplicateReply(result rag.AddResult, err error) (string, bool) {
+	var duplicateErr *rag.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		return fmt.Sprintf("⚠️ Похожий документ уже есть в базе\n\nID: `%s`\nСходство: %.0f%%",
+			duplicateErr.ID, duplicateErr.Similarity*100), true
+	}
+
+	if err == nil && result.Merged {
+		return fmt.Sprintf("🔗 Текст объединён с похожим документом `%s` (сходство %.0f%%)",
+			result.ID, result.Duplicate.Similarity*100), true
+	}
+
+	return "", false
+}
+
+func (tb *TelegramBot) downloadFile(fileID string) ([]byte, error) {
+	url, err := tb.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("статус %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadSize {
+		return nil, fmt.Errorf("файл больше %d МБ", maxUploadSize>>20)
+	}
+
+	return data, nil
+}
+
+func (tb *TelegramBot) handleRAGFindCommand(message *tgbotapi.Message) {
+	args := strings.TrimSpace(strings.TrimPrefix(message.Text, "/rag_find"))
+
+	filterExpr, query, found := strings.Cut(args, "|")
+	if !found || strings.TrimSpace(query) == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, ragFindUsage)
+		tb.bot.Send(msg)
+		return
+	}
+
+	filters := []rag.Filter{tb.searchScope(message)}
+	if strings.TrimSpace(filterExpr) != "" {
+		filter, err := rag.ParseFilter(filterExpr)
+		if err != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Ошибка в фильтре: "+err.Error())
+			tb.bot.Send(msg)
+			return
+		}
+		filters = append(filters, filter)
+	}
+
+	_, hits, _ := tb.ragPipeline.ProcessQuery(strings.TrimSpace(query), filters...)
+	if len(hits) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "🔍 Ничего не найдено")
+		tb.bot.Send(msg)
+		return
+	}
+
+	var text formattedText
+	text.write("🔍 Найденные документы:\n")
+	for _, hit := range hits {
+		text.write(fmt.Sprintf("\n%d. [%s] (%.3f) ", hit.Rank, hit.Document.ID, hit.Score))
+		text.writeSnippet(hit)
+		text.write("\n")
+	}
+
+	tb.sendFormatted(message.Chat.ID, text, message.MessageID, sourcesKeyboard(hits))
+}
+
+func (tb *TelegramBot) handleRAGDeleteCommand(message *tgbotapi.Message) {
+	docID := strings.TrimSpace(strings.TrimPrefix(message.Text, "/rag_del"))
+
+	if docID == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, ragDeleteUsage)
+		tb.bot.Send(msg)
+		return
+	}
+
+	if !tb.checkDocumentAccess(message, docID) {
+		return
+	}
+
+	removed, err := tb.ragPipeline.DeleteDocument(docID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	text := fmt.Sprintf("🗑 Документ `%s` удалён (записей: %d)", docID, removed)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	tb.bot.Send(msg)
+}
+
+func (tb *TelegramBot) handleRAGEditCommand(message *tgbotapi.Message) {
+	args := strings.TrimSpace(strings.TrimPrefix(message.Text, "/rag_edit"))
+	docID, content, _ := strings.Cut(args, " ")
+	content = strings.TrimSpace(content)
+
+	if docID == "" || content == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, ragEditUsage)
+		tb.bot.Send(msg)
+		return
+	}
+
+	if !tb.checkDocumentAccess(message, docID) {
+		return
+	}
+
+	chunks, err := tb.ragPipeline.UpdateDocument(docID, content)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	text := fmt.Sprintf("✏️ Документ `%s` обновлён\n\nТекст: %s", docID, content)
+	if chunks > 1 {
+		text += fmt.Sprintf("\n\nДокумент разбит на %d фрагментов", chunks)
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	tb.bot.Send(msg)
+}
+
+// checkDocumentAccess разрешает менять документ его автору и тем, кто
+// может управлять его коллекцией.
+func (tb *TelegramBot) checkDocumentAccess(message *tgbotapi.Message, docID string) bool {
+	doc, found := tb.ragPipeline.GetDocument(docID)
+	if !found {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Документ %s не найден", docID))
+		tb.bot.Send(msg)
+		return false
+	}
+
+	if doc.Metadata.AuthorID != message.From.ID &&
+		!tb.canManageCollection(message.From.ID, tb.ragPipeline.Collections().OfDocument(doc)) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, accessDenied)
+		tb.bot.Send(msg)
+		return false
+	}
+
+	return true
+}
+
 func (tb *TelegramBot) handleUnknownCommand(message *tgbotapi.Message) {
 	text := unknownCommand
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
@@ -264,9 +660,12 @@ func (tb *TelegramBot) splitMessage(text string, maxLength int) []string {
 }
 
 func (tb *TelegramBot) sendSplitMessage(chatID int64, text string, replyToMessageID int) {
-	maxLength := 3800
+	tb.sendSplitMessageWithKeyboard(chatID, text, replyToMessageID, nil)
+}
 
-	parts := tb.splitMessage(text, maxLength)
+// sendSplitMessageWithKeyboard прикрепляет кнопки к последней части.
+func (tb *TelegramBot) sendSplitMessageWithKeyboard(chatID int64, text string, replyToMessageID int, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	parts := tb.splitMessage(text, maxMessageLength)
 
 	for i, part := range parts {
 		msg := tgbotapi.NewMessage(chatID, part)
@@ -280,6 +679,10 @@ func (tb *TelegramBot) sendSplitMessage(chatID int64, text string, replyToMessag
 			msg.Text = part
 		}
 
+		if i == len(parts)-1 && keyboard != nil {
+			msg.ReplyMarkup = keyboard
+		}
+
 		if _, err := tb.bot.Send(msg); err != nil {
 			log.Printf("Ошибка отправки части сообщения %d: %v", i+1, err)
 		}
@@ -290,14 +693,13 @@ func (tb *TelegramBot) processAIQuestion(message *tgbotapi.Message, question str
 	chatAction := tgbotapi.NewChatAction(message.Chat.ID, tgbotapi.ChatTyping)
 	tb.bot.Send(chatAction)
 
-	ragContext, foundDocs := tb.ragPipeline.ProcessQuery(question)
+	ragContext, sources, report := tb.ragPipeline.ProcessConversation(question, tb.history.get(message.Chat.ID, message.From.ID), tb.searchScope(message))
 
-	log.Printf("RAG нашел %d релевантные документы для: %s", len(foundDocs), question)
+	log.Printf("RAG нашел %d релевантные документы для: %s", len(sources), question)
 
 	var prompt string
-	if len(foundDocs) > 0 {
-		prompt = ragContext + "\n\nНа основе контекста выше, ответь на вопрос: " + question + "\n\nБудь кратким и информативным. " +
-			"Если в контексте нет точного ответа, используй свои знания."
+	if len(sources) > 0 {
+		prompt = rag.AnswerPrompt(ragContext, question)
 	} else {
 		prompt = "Вопрос: " + question + "\n\nОтветь как полезный ассистент на русском языке. Будь кратким и информативным."
 	}
@@ -326,14 +728,21 @@ func (tb *TelegramBot) processAIQuestion(message *tgbotapi.Message, question str
 		return
 	}
 
-	var prefix string
-	if len(foundDocs) > 0 {
-		prefix = "🔍 *На основе базы знаний:*\n\n"
-	} else {
-		prefix = "🤖 *Ответ:*\n\n"
+	cited := citedSources(answer, sources)
+	id := answerID(message)
+	tb.history.add(message.Chat.ID, message.From.ID, rag.Turn{Question: question, Answer: answer, Sources: sourceIDs(cited)})
+	tb.answers.add(rag.Feedback{
+		AnswerID: id,
+		ChatID:   message.Chat.ID,
+		Question: question,
+		Answer:   answer,
+		Sources:  sourceIDs(cited),
+	})
+
+	if len(sources) == 0 {
+		tb.sendSplitMessageWithKeyboard(message.Chat.ID, "🤖 *Ответ:*\n\n"+answer, message.MessageID, answerKeyboard(nil, id))
+		return
 	}
 
-	fullAnswer := prefix + answer
-
-	tb.sendSplitMessage(message.Chat.ID, fullAnswer, message.MessageID)
+	tb.sendAnswerWithSources(message.Chat.ID, "🔍 *На основе базы знаний:*\n\n"+answer+contextNote(report, sources), cited, message.MessageID, answerKeyboard(cited, id))
 }
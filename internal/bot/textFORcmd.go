@@ -11,7 +11,19 @@ const commandHelper = `📖 Помощь по командам
 /help - показать это сообщение
 /ask - режим вопроса (после команды напишите свой вопрос)
 /info - информация о технологиях бота
-/rag_add - добавить новые знания в базу
+/rag_add - добавить новые знания в базу (#теги попадут в метаданные)
+Можно прислать файл txt, md, html, csv, json или jsonl - он тоже попадёт в базу
+/rag_find - поиск по базе знаний с фильтром
+/rag_del - удалить свой документ по ID
+/rag_edit - исправить текст своего документа по ID
+/rag_coll_list - список коллекций
+/rag_coll_new - создать коллекцию и сделать её активной
+/rag_coll_use - переключить активную коллекцию
+/rag_coll_drop - удалить коллекцию вместе с документами
+/rag_dups - почти одинаковые документы (для администраторов)
+/rag_export - выгрузить базу знаний файлом JSONL (для администраторов)
+/rag_import - загрузить документы из JSONL (для администраторов)
+/rag_feedback - оценки ответов и худшие документы (для администраторов)
 
 Как использовать:
 1. Просто напишите любой вопрос - я отвечу используя AI
@@ -64,3 +76,103 @@ const waitYourASK = "❓ Можете задать мне любой вопро
 //--------------------------------------------------------------------------------------------------------------------
 
 const errorRequest = "❌ Не удалось обработать запрос.\n"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const ragFindUsage = `🔍 Поиск по базе знаний с фильтром
+
+Формат: /rag_find <фильтр> | <запрос>
+
+Примеры:
+/rag_find tag in (docker, go) | как собрать образ
+/rag_find chat = -100123 and created after 2025-01-01 | деплой
+/rag_find | без фильтра
+
+Поля: tag, chat, author, source, lang, created, meta.<ключ>
+Операторы: = != in > < >= <= after before, and, or, not, скобки`
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const ragDeleteUsage = "🗑 Укажите ID документа: /rag_del <id>\n\nID выдаётся при добавлении и виден в /rag_find"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const ragEditUsage = "✏️ Укажите ID документа и новый текст: /rag_edit <id> <текст>"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const contextTrimmedNote = "✂️ Сокращены, чтобы поместиться в контекст модели: %s"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const contextDroppedNote = "✂️ Не поместились в контекст модели, источников: %d"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const accessDenied = "⛔ Изменять и удалять документ может его автор, владелец коллекции или администратор"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const unsupportedFile = "❌ Этот формат не поддерживается. Пришлите файл txt, md, html, csv, json или jsonl"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const collectionNewUsage = `📚 Создание коллекции
+
+Формат: /rag_coll_new <имя> [global]
+
+В личном чате коллекция будет вашей, в группе - общей для участников.
+С флагом global создаётся общая коллекция для всех чатов (только для администраторов).
+
+Пример: /rag_coll_new рецепты`
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const collectionDropUsage = `🗑 Удаление коллекции
+
+Формат: /rag_coll_drop <имя>
+
+Удаляются все документы коллекции. Коллекция по умолчанию (default) только очищается.`
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const globalReadOnly = "⛔ Активна общая коллекция %s, добавлять в неё могут только администраторы. Переключитесь: /rag_coll_use default"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const adminOnly = "⛔ Команда доступна только администраторам бота"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const collectionAccessDenied = "⛔ Удалить коллекцию может её владелец, администратор группы или бота"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const noDuplicates = "✅ Почти одинаковых документов не найдено"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const noFeedback = "📊 Ответы ещё никто не оценивал"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const feedbackSaved = "Спасибо за оценку!"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const feedbackAlreadySaved = "Оценка уже учтена"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const feedbackExpired = "Этот ответ уже нельзя оценить"
+
+//--------------------------------------------------------------------------------------------------------------------
+
+const importUsage = `📥 Импорт документов
+
+Пришлите файл .jsonl с подписью /rag_import. Каждая строка - один документ:
+{"id": "faq-1", "content": "текст", "metadata": {"tags": ["faq"], "collection": "global/docs"}}
+
+id и metadata необязательны. Документ с уже существующим id заменяется, записи без коллекции попадают в активную коллекцию чата. Ошибочные строки пропускаются и перечисляются в отчёте.
+
+Файл в этом формате присылает /rag_export.`
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"GolangtgBot/internal/rag"
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxReportedErrors - сколько ошибок импорта показывать в чате
+const maxReportedErrors = 20
+
+// captionCommand возвращает команду из подписи к файлу без / и @имени бота.
+func captionCommand(message *tgbotapi.Message) string {
+	fields := strings.Fields(message.Caption)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	command, _, _ := strings.Cut(fields[0][1:], "@")
+	return command
+}
+
+// handleExportCommand отправляет администратору всю базу знаний файлом
+// JSONL. С аргументом vectors в файл попадают и векторы.
+func (tb *TelegramBot) handleExportCommand(message *tgbotapi.Message) {
+	if !tb.isAdmin(message.From.ID) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, adminOnly)
+		tb.bot.Send(msg)
+		return
+	}
+
+	tb.bot.Send(tgbotapi.NewChatAction(message.Chat.ID, tgbotapi.ChatUploadDocument))
+
+	var buffer bytes.Buffer
+	count, err := tb.ragPipeline.Export(&buffer, rag.ExportOptions{
+		Vectors: strings.TrimSpace(message.CommandArguments()) == "vectors",
+	})
+	if err != nil {
+		log.Printf("Ошибка выгрузки базы знаний: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Ошибка выгрузки: "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	document := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("knowledge-%s.jsonl", time.Now().Format("2006-01-02")),
+		Bytes: buffer.Bytes(),
+	})
+	document.Caption = fmt.Sprintf("📤 Документов: %d", count)
+	document.ReplyToMessageID = message.MessageID
+
+	if _, err := tb.bot.Send(document); err != nil {
+		log.Printf("Ошибка отправки выгрузки: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Не удалось отправить файл: "+err.Error())
+		tb.bot.Send(msg)
+	}
+}
+
+// handleImportUpload загружает JSONL, присланный с подписью /rag_import.
+// Записи без коллекции попадают в активную коллекцию чата.
+func (tb *TelegramBot) handleImportUpload(message *tgbotapi.Message) {
+	if !tb.isAdmin(message.From.ID) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, adminOnly)
+		tb.bot.Send(msg)
+		return
+	}
+
+	document := message.Document
+	if document.FileSize > maxUploadSize {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Файл слишком большой, максимум %d МБ", maxUploadSize>>20))
+		tb.bot.Send(msg)
+		return
+	}
+
+	tb.bot.Send(tgbotapi.NewChatAction(message.Chat.ID, tgbotapi.ChatTyping))
+
+	data, err := tb.downloadFile(document.FileID)
+	if err != nil {
+		log.Printf("Ошибка загрузки файла %s: %v", document.FileName, err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Не удалось скачать файл: "+err.Error())
+		tb.bot.Send(msg)
+		return
+	}
+
+	collection := tb.ragPipeline.Collections().Active(scopeOf(message))
+	report, err := tb.ragPipeline.Import(bytes.NewReader(data), rag.ImportOptions{
+		Collection: collection.Name,
+		Source:     "import",
+	})
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("📥 Импорт %s\n\nДобавлено: %d\nОбновлено: %d\nОбъединено с похожими: %d\nБез изменений: %d\nОшибок: %d",
+		document.FileName, report.Added, report.Updated, report.Merged, report.Unchanged, len(report.Errors)))
+
+	if err != nil {
+		builder.WriteString("\n\n❌ Чтение остановлено: " + err.Error())
+	}
+
+	if len(report.Errors) > 0 {
+		builder.WriteString("\n\n")
+		for i, lineErr := range report.Errors {
+			if i == maxReportedErrors {
+				builder.WriteString(fmt.Sprintf("… и ещё %d\n", len(report.Errors)-maxReportedErrors))
+				break
+			}
+			builder.WriteString("• " + lineErr.Error() + "\n")
+		}
+	}
+
+	log.Printf("Импорт %s: добавлено %d, обновлено %d, ошибок %d", document.FileName, report.Added, report.Updated, len(report.Errors))
+	tb.sendSplitMessage(message.Chat.ID, builder.String(), message.MessageID)
+}
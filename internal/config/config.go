@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +16,81 @@ type Config struct {
 	OpenRouterToken string
 	DeepSeekToken   string
 	DebugMode       bool
+	AdminIDs        []int64
+
+	RAGStoragePath      string
+	RAGSnapshotInterval time.Duration
+	RAGSnapshotEvery    int
+
+	RAGSeed           []string
+	RAGSeedCollection string
+	RAGSeedInterval   time.Duration
+
+	RAGScorer string
+	RAGBM25K1 float64
+	RAGBM25B  float64
+
+	RAGLanguages []string
+	RAGStemming  bool
+
+	RAGFuzzy         bool
+	RAGFuzzyMaxEdits int
+	RAGFuzzyWeight   float64
+
+	RAGChunkStrategy  string
+	RAGChunkMaxTokens int
+	RAGChunkOverlap   int
+	RAGChunkExpand    int
+
+	LLMContextWindow int
+	LLMAnswerTokens  int
+
+	RAGSnippetLength   int
+	RAGContextSnippets bool
+
+	RAGDedup          string
+	RAGDedupThreshold float64
+
+	EmbeddingProvider string
+	EmbeddingURL      string
+	EmbeddingToken    string
+	EmbeddingModel    string
+
+	RAGRetrieval     string
+	RAGFusion        string
+	RAGLexicalWeight float64
+	RAGDenseWeight   float64
+	RAGRRFK          int
+	RAGDenseMinScore float64
+
+	RAGDenseIndex         string
+	RAGHNSWM              int
+	RAGHNSWEfConstruction int
+	RAGHNSWEfSearch       int
+
+	RAGBackend       string
+	QdrantURL        string
+	QdrantAPIKey     string
+	QdrantCollection string
+	QdrantTimeout    time.Duration
+
+	RAGRerank           string
+	RAGRerankCandidates int
+	RAGRerankTop        int
+	RAGRerankTimeout    time.Duration
+	RAGRerankCache      int
+
+	RAGRewrite        bool
+	RAGHyDE           bool
+	RAGRewriteTimeout time.Duration
+
+	RAGConversationTurns  int
+	RAGConversationWeight float64
+	RAGStickyTurns        int
+	RAGStickyWeight       float64
+	RAGStickyMinMatch     float64
+
+	RAGFeedbackWeight float64
 }
 
 func Load() *Config {
@@ -29,9 +106,110 @@ func Load() *Config {
 		OpenRouterToken: getEnv("OPENROUTER_TOKEN", ""),
 		DeepSeekToken:   getEnv("DEEPSEEK_TOKEN", ""),
 		DebugMode:       getEnvAsBool("DEBUG_MODE", true),
+		AdminIDs:        getEnvAsIDs("ADMIN_IDS"),
+
+		RAGStoragePath:      getEnv("RAG_STORAGE_PATH", "data"),
+		RAGSnapshotInterval: getEnvAsDuration("RAG_SNAPSHOT_INTERVAL", 10*time.Minute),
+		RAGSnapshotEvery:    getEnvAsInt("RAG_SNAPSHOT_EVERY", 100),
+
+		RAGSeed:           getEnvAsList("RAG_SEED", nil),
+		RAGSeedCollection: getEnv("RAG_SEED_COLLECTION", ""),
+		RAGSeedInterval:   getEnvAsDuration("RAG_SEED_INTERVAL", 0),
+
+		RAGScorer: getEnv("RAG_SCORER", "bm25"),
+		RAGBM25K1: getEnvAsFloat("RAG_BM25_K1", 1.2),
+		RAGBM25B:  getEnvAsFloat("RAG_BM25_B", 0.75),
+
+		RAGLanguages: getEnvAsList("RAG_LANGUAGES", []string{"ru", "en"}),
+		RAGStemming:  getEnvAsBool("RAG_STEMMING", true),
+
+		RAGFuzzy:         getEnvAsBool("RAG_FUZZY", true),
+		RAGFuzzyMaxEdits: getEnvAsInt("RAG_FUZZY_MAX_EDITS", 2),
+		RAGFuzzyWeight:   getEnvAsFloat("RAG_FUZZY_WEIGHT", 0.5),
+
+		RAGChunkStrategy:  getEnv("RAG_CHUNK_STRATEGY", "markdown"),
+		RAGChunkMaxTokens: getEnvAsInt("RAG_CHUNK_MAX_TOKENS", 200),
+		RAGChunkOverlap:   getEnvAsInt("RAG_CHUNK_OVERLAP", 30),
+		RAGChunkExpand:    getEnvAsInt("RAG_CHUNK_EXPAND", 1),
+
+		LLMContextWindow: getEnvAsInt("LLM_CONTEXT_WINDOW", 8192),
+		LLMAnswerTokens:  getEnvAsInt("LLM_ANSWER_TOKENS", 1024),
+
+		RAGSnippetLength:   getEnvAsInt("RAG_SNIPPET_LENGTH", 200),
+		RAGContextSnippets: getEnvAsBool("RAG_CONTEXT_SNIPPETS", false),
+
+		RAGDedup:          getEnv("RAG_DEDUP", "reject"),
+		RAGDedupThreshold: getEnvAsFloat("RAG_DEDUP_THRESHOLD", 0.75),
+
+		EmbeddingProvider: getEnv("EMBEDDING_PROVIDER", "off"),
+		EmbeddingURL:      getEnv("EMBEDDING_URL", ""),
+		EmbeddingToken:    getEnv("EMBEDDING_TOKEN", ""),
+		EmbeddingModel:    getEnv("EMBEDDING_MODEL", ""),
+
+		RAGRetrieval:     getEnv("RAG_RETRIEVAL", "hybrid"),
+		RAGFusion:        getEnv("RAG_FUSION", "rrf"),
+		RAGLexicalWeight: getEnvAsFloat("RAG_LEXICAL_WEIGHT", 1),
+		RAGDenseWeight:   getEnvAsFloat("RAG_DENSE_WEIGHT", 1),
+		RAGRRFK:          getEnvAsInt("RAG_RRF_K", 60),
+		RAGDenseMinScore: getEnvAsFloat("RAG_DENSE_MIN_SCORE", 0.3),
+
+		RAGDenseIndex:         getEnv("RAG_DENSE_INDEX", "hnsw"),
+		RAGHNSWM:              getEnvAsInt("RAG_HNSW_M", 16),
+		RAGHNSWEfConstruction: getEnvAsInt("RAG_HNSW_EF_CONSTRUCTION", 200),
+		RAGHNSWEfSearch:       getEnvAsInt("RAG_HNSW_EF_SEARCH", 64),
+
+		RAGBackend:       getEnv("RAG_BACKEND", "memory"),
+		QdrantURL:        getEnv("QDRANT_URL", "http://localhost:6333"),
+		QdrantAPIKey:     getEnv("QDRANT_API_KEY", ""),
+		QdrantCollection: getEnv("QDRANT_COLLECTION", "knowledge"),
+		QdrantTimeout:    getEnvAsDuration("QDRANT_TIMEOUT", 10*time.Second),
+
+		RAGRerank:           getEnv("RAG_RERANK", "off"),
+		RAGRerankCandidates: getEnvAsInt("RAG_RERANK_CANDIDATES", 30),
+		RAGRerankTop:        getEnvAsInt("RAG_RERANK_TOP", 5),
+		RAGRerankTimeout:    getEnvAsDuration("RAG_RERANK_TIMEOUT", 8*time.Second),
+		RAGRerankCache:      getEnvAsInt("RAG_RERANK_CACHE", 256),
+
+		RAGRewrite:        getEnvAsBool("RAG_REWRITE", false),
+		RAGHyDE:           getEnvAsBool("RAG_HYDE", false),
+		RAGRewriteTimeout: getEnvAsDuration("RAG_REWRITE_TIMEOUT", 8*time.Second),
+
+		RAGConversationTurns:  getEnvAsInt("RAG_CONVERSATION_TURNS", 2),
+		RAGConversationWeight: getEnvAsFloat("RAG_CONVERSATION_WEIGHT", 0.5),
+		RAGStickyTurns:        getEnvAsInt("RAG_STICKY_TURNS", 2),
+		RAGStickyWeight:       getEnvAsFloat("RAG_STICKY_WEIGHT", 0.3),
+		RAGStickyMinMatch:     getEnvAsFloat("RAG_STICKY_MIN_MATCH", 0.2),
+
+		RAGFeedbackWeight: getEnvAsFloat("RAG_FEEDBACK_WEIGHT", 0.2),
 	}
 }
 
+// LoadWith загружает настройки так, будто переменные из overrides
+// заданы в окружении. Нужен для сравнения конфигураций в ragctl.
+func LoadWith(overrides map[string]string) *Config {
+	previous := make(map[string]*string, len(overrides))
+	for key, value := range overrides {
+		if old, found := os.LookupEnv(key); found {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+		os.Setenv(key, value)
+	}
+
+	defer func() {
+		for key, old := range previous {
+			if old == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *old)
+			}
+		}
+	}()
+
+	return Load()
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -47,3 +225,59 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvAsIDs читает список Telegram ID через запятую, неверные пропускает.
+func getEnvAsIDs(key string) []int64 {
+	var ids []int64
+	for _, item := range getEnvAsList(key, nil) {
+		id, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			log.Printf("Неверный ID в %s: %s", key, item)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"GolangtgBot/internal/ai"
+	"GolangtgBot/internal/rag"
+	"log"
+)
+
+// Embedder создаёт эмбеддер по EMBEDDING_PROVIDER; nil - эмбеддинги отключены.
+func (c *Config) Embedder() ai.Embedder {
+	switch c.EmbeddingProvider {
+	case "openai":
+		embedder := ai.NewEmbeddingClient(c.EmbeddingToken, c.EmbeddingURL, c.EmbeddingModel)
+		log.Printf("Эмбеддинги: %s", embedder.Name())
+		return embedder
+
+	case "hash":
+		// Хеш-эмбеддер не понимает смысла текста, только для проверки без API
+		log.Println("Эмбеддинги: локальный хеш-эмбеддер")
+		return ai.NewHashEmbedder(0)
+
+	default:
+		log.Println("Эмбеддинги отключены, работает только лексический поиск")
+		return nil
+	}
+}
+
+// RAGOptions собирает настройки базы знаний. llm нужен для
+// переранжирования и переписывания запросов, может быть nil.
+func (c *Config) RAGOptions(llm ai.AIClient) rag.Options {
+	return rag.Options{
+		StoragePath:      c.RAGStoragePath,
+		SnapshotInterval: c.RAGSnapshotInterval,
+		SnapshotEvery:    c.RAGSnapshotEvery,
+		Scorer:           c.RAGScorer,
+		BM25K1:           c.RAGBM25K1,
+		BM25B:            c.RAGBM25B,
+		Languages:        c.RAGLanguages,
+		Stemming:         c.RAGStemming,
+		Fuzzy: rag.FuzzyOptions{
+			Enabled:  c.RAGFuzzy,
+			MaxEdits: c.RAGFuzzyMaxEdits,
+			Weight:   c.RAGFuzzyWeight,
+		},
+		Chunking: rag.ChunkOptions{
+			Strategy:  c.RAGChunkStrategy,
+			MaxTokens: c.RAGChunkMaxTokens,
+			Overlap:   c.RAGChunkOverlap,
+		},
+		ChunkExpand: c.RAGChunkExpand,
+		Context: rag.ContextOptions{
+			Window:       c.LLMContextWindow,
+			AnswerTokens: c.LLMAnswerTokens,
+		},
+		Snippets: rag.SnippetOptions{
+			Length:  c.RAGSnippetLength,
+			Context: c.RAGContextSnippets,
+		},
+		Dedup: rag.DedupOptions{
+			Policy:    c.RAGDedup,
+			Threshold: c.RAGDedupThreshold,
+		},
+		Embedder: c.Embedder(),
+		Retrieval: rag.RetrievalOptions{
+			Mode:          c.RAGRetrieval,
+			Fusion:        c.RAGFusion,
+			LexicalWeight: c.RAGLexicalWeight,
+			DenseWeight:   c.RAGDenseWeight,
+			RRFK:          c.RAGRRFK,
+			DenseMinScore: c.RAGDenseMinScore,
+		},
+		DenseIndex: c.RAGDenseIndex,
+		HNSW: rag.HNSWOptions{
+			M:              c.RAGHNSWM,
+			EfConstruction: c.RAGHNSWEfConstruction,
+			EfSearch:       c.RAGHNSWEfSearch,
+		},
+		Backend: c.RAGBackend,
+		Qdrant: rag.QdrantOptions{
+			URL:        c.QdrantURL,
+			APIKey:     c.QdrantAPIKey,
+			Collection: c.QdrantCollection,
+			Timeout:    c.QdrantTimeout,
+		},
+		LLM: llm,
+		Rerank: rag.RerankOptions{
+			Mode:       c.RAGRerank,
+			Candidates: c.RAGRerankCandidates,
+			TopN:       c.RAGRerankTop,
+			Timeout:    c.RAGRerankTimeout,
+			CacheSize:  c.RAGRerankCache,
+		},
+		Rewrite: rag.RewriteOptions{
+			Enabled: c.RAGRewrite,
+			HyDE:    c.RAGHyDE,
+			Timeout: c.RAGRewriteTimeout,
+		},
+		Conversation: rag.ConversationOptions{
+			Turns:          c.RAGConversationTurns,
+			Weight:         c.RAGConversationWeight,
+			StickyTurns:    c.RAGStickyTurns,
+			StickyWeight:   c.RAGStickyWeight,
+			StickyMinMatch: c.RAGStickyMinMatch,
+		},
+		Feedback: rag.FeedbackOptions{
+			Weight: c.RAGFeedbackWeight,
+		},
+		Seed: rag.SeedOptions{
+			Paths:      c.RAGSeed,
+			Collection: c.RAGSeedCollection,
+			Interval:   c.RAGSeedInterval,
+		},
+		Debug: c.DebugMode,
+	}
+}
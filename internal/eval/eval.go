@@ -0,0 +1,212 @@
+// Package eval измеряет качество поиска на эталонном наборе запросов:
+// recall@k, precision@k, MRR и nDCG@k.
+package eval
+
+import (
+	"GolangtgBot/internal/rag"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Case - эталонный запрос и ID документов, которые должны найтись.
+type Case struct {
+	Query    string   `json:"query"`
+	Relevant []string `json:"relevant"`
+	Filter   string   `json:"filter,omitempty"`
+}
+
+type Metrics struct {
+	Recall    float64
+	Precision float64
+	MRR       float64
+	NDCG      float64
+}
+
+type CaseResult struct {
+	Case      Case
+	Retrieved []string
+	Metrics   Metrics
+}
+
+type Report struct {
+	Name  string
+	K     int
+	Cases []CaseResult
+	Mean  Metrics
+}
+
+// Retriever - функция поиска, например RAGPipeline.Retrieve.
+type Retriever func(query string, topK int, filters ...rag.Filter) []rag.SearchHit
+
+// LoadCases читает JSONL вида {"query": "...", "relevant": ["doc_1"]}.
+func LoadCases(path string) ([]Case, error) {
+	var cases []Case
+
+	err := readJSONL(path, func(line int, data []byte) error {
+		var c Case
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		if strings.TrimSpace(c.Query) == "" {
+			return fmt.Errorf("пустой запрос")
+		}
+		if len(c.Relevant) == 0 {
+			return fmt.Errorf("не указаны релевантные документы")
+		}
+		cases = append(cases, c)
+		return nil
+	})
+
+	return cases, err
+}
+
+// LoadCorpus читает JSONL документов {"id", "content", "metadata"}.
+// ID обязательны - на них ссылаются эталонные запросы.
+func LoadCorpus(path string) ([]rag.Document, error) {
+	var docs []rag.Document
+
+	err := readJSONL(path, func(line int, data []byte) error {
+		var doc rag.Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if doc.ID == "" || strings.TrimSpace(doc.Content) == "" {
+			return fmt.Errorf("у документа должны быть id и content")
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+
+	return docs, err
+}
+
+func readJSONL(path string, handle func(line int, data []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		if err := handle(line, data); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Run прогоняет все запросы и усредняет метрики. Фрагменты считаются
+// своим исходным документом, повторы одного документа схлопываются.
+func Run(name string, retrieve Retriever, cases []Case, k int) (Report, error) {
+	report := Report{Name: name, K: k}
+
+	for _, c := range cases {
+		var filters []rag.Filter
+		if c.Filter != "" {
+			filter, err := rag.ParseFilter(c.Filter)
+			if err != nil {
+				return report, fmt.Errorf("запрос %q: %v", c.Query, err)
+			}
+			filters = append(filters, filter)
+		}
+
+		// Берём с запасом: после схлопывания фрагментов может не хватить
+		retrieved := documentIDs(retrieve(c.Query, k*3, filters...), k)
+		metrics := Score(retrieved, c.Relevant, k)
+
+		report.Cases = append(report.Cases, CaseResult{Case: c, Retrieved: retrieved, Metrics: metrics})
+		report.Mean.Recall += metrics.Recall
+		report.Mean.Precision += metrics.Precision
+		report.Mean.MRR += metrics.MRR
+		report.Mean.NDCG += metrics.NDCG
+	}
+
+	if n := float64(len(cases)); n > 0 {
+		report.Mean.Recall /= n
+		report.Mean.Precision /= n
+		report.Mean.MRR /= n
+		report.Mean.NDCG /= n
+	}
+
+	return report, nil
+}
+
+func documentIDs(hits []rag.SearchHit, k int) []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0, k)
+
+	for _, hit := range hits {
+		id := hit.Document.ID
+		if hit.Document.Chunk != nil {
+			id = hit.Document.Chunk.ParentID
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		if len(ids) == k {
+			break
+		}
+	}
+
+	return ids
+}
+
+// Score считает метрики для одного запроса с бинарной релевантностью.
+func Score(retrieved, relevant []string, k int) Metrics {
+	relevantSet := make(map[string]bool, len(relevant))
+	for _, id := range relevant {
+		relevantSet[id] = true
+	}
+
+	if len(retrieved) > k {
+		retrieved = retrieved[:k]
+	}
+
+	var metrics Metrics
+	hits := 0
+	dcg := 0.0
+
+	for i, id := range retrieved {
+		if !relevantSet[id] {
+			continue
+		}
+		hits++
+		dcg += 1 / math.Log2(float64(i+2))
+		if metrics.MRR == 0 {
+			metrics.MRR = 1 / float64(i+1)
+		}
+	}
+
+	idcg := 0.0
+	for i := 0; i < len(relevantSet) && i < k; i++ {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+
+	if len(relevantSet) > 0 {
+		metrics.Recall = float64(hits) / float64(len(relevantSet))
+	}
+	if k > 0 {
+		metrics.Precision = float64(hits) / float64(k)
+	}
+	if idcg > 0 {
+		metrics.NDCG = dcg / idcg
+	}
+
+	return metrics
+}
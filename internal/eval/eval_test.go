@@ -0,0 +1,88 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		retrieved []string
+		relevant  []string
+		k         int
+		want      Metrics
+	}{
+		{
+			name:      "всё найдено по порядку",
+			retrieved: []string{"a", "b"},
+			relevant:  []string{"a", "b"},
+			k:         2,
+			want:      Metrics{Recall: 1, Precision: 1, MRR: 1, NDCG: 1},
+		},
+		{
+			name:      "ничего не найдено",
+			retrieved: []string{"x", "y"},
+			relevant:  []string{"a"},
+			k:         2,
+		},
+		{
+			name:      "релевантный на втором месте",
+			retrieved: []string{"x", "a", "y"},
+			relevant:  []string{"a"},
+			k:         3,
+			want:      Metrics{Recall: 1, Precision: 1.0 / 3, MRR: 0.5, NDCG: 1 / math.Log2(3)},
+		},
+		{
+			name:      "за пределами k не считается",
+			retrieved: []string{"x", "y", "a"},
+			relevant:  []string{"a"},
+			k:         2,
+		},
+		{
+			name:      "найден один из двух",
+			retrieved: []string{"a", "x", "y"},
+			relevant:  []string{"a", "b"},
+			k:         3,
+			want:      Metrics{Recall: 0.5, Precision: 1.0 / 3, MRR: 1, NDCG: 1 / (1 + 1/math.Log2(3))},
+		},
+		{
+			name:      "найдено меньше k",
+			retrieved: []string{"a"},
+			relevant:  []string{"a"},
+			k:         5,
+			want:      Metrics{Recall: 1, Precision: 0.2, MRR: 1, NDCG: 1},
+		},
+		{
+			name:      "повторы в эталоне",
+			retrieved: []string{"a"},
+			relevant:  []string{"a", "a"},
+			k:         1,
+			want:      Metrics{Recall: 1, Precision: 1, MRR: 1, NDCG: 1},
+		},
+		{
+			name:      "пустой эталон",
+			retrieved: []string{"a"},
+			k:         1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(tt.retrieved, tt.relevant, tt.k)
+			for _, metric := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"recall", got.Recall, tt.want.Recall},
+				{"precision", got.Precision, tt.want.Precision},
+				{"MRR", got.MRR, tt.want.MRR},
+				{"nDCG", got.NDCG, tt.want.NDCG},
+			} {
+				if math.Abs(metric.got-metric.want) > 1e-9 {
+					t.Errorf("%s = %.4f, ожидалось %.4f", metric.name, metric.got, metric.want)
+				}
+			}
+		})
+	}
+}
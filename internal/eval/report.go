@@ -0,0 +1,76 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteReport печатает средние метрики одной конфигурации.
+func WriteReport(w io.Writer, report Report) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "метрика\t%s\n", report.Name)
+	for _, row := range metricRows(report.K) {
+		fmt.Fprintf(table, "%s\t%.4f\n", row.name, row.value(report.Mean))
+	}
+	table.Flush()
+}
+
+// WriteComparison печатает метрики двух конфигураций рядом с разницей,
+// а затем запросы, где выдача изменилась.
+func WriteComparison(w io.Writer, a, b Report, verbose bool) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "метрика\t%s\t%s\tразница\n", a.Name, b.Name)
+	for _, row := range metricRows(a.K) {
+		before, after := row.value(a.Mean), row.value(b.Mean)
+		fmt.Fprintf(table, "%s\t%.4f\t%.4f\t%s\n", row.name, before, after, formatDelta(after-before))
+	}
+	table.Flush()
+
+	if !verbose || len(a.Cases) != len(b.Cases) {
+		return
+	}
+
+	fmt.Fprintln(w)
+	changed := 0
+	for i := range a.Cases {
+		before, after := a.Cases[i], b.Cases[i]
+		if strings.Join(before.Retrieved, ",") == strings.Join(after.Retrieved, ",") {
+			continue
+		}
+		changed++
+
+		fmt.Fprintf(w, "%q  nDCG %.3f -> %.3f (%s)\n", before.Case.Query,
+			before.Metrics.NDCG, after.Metrics.NDCG, formatDelta(after.Metrics.NDCG-before.Metrics.NDCG))
+		fmt.Fprintf(w, "  ожидались: %s\n", strings.Join(before.Case.Relevant, ", "))
+		fmt.Fprintf(w, "  %s: %s\n", a.Name, strings.Join(before.Retrieved, ", "))
+		fmt.Fprintf(w, "  %s: %s\n", b.Name, strings.Join(after.Retrieved, ", "))
+	}
+	fmt.Fprintf(w, "Выдача изменилась для %d из %d запросов\n", changed, len(a.Cases))
+}
+
+type metricRow struct {
+	name  string
+	value func(Metrics) float64
+}
+
+func metricRows(k int) []metricRow {
+	return []metricRow{
+		{fmt.Sprintf("recall@%d", k), func(m Metrics) float64 { return m.Recall }},
+		{fmt.Sprintf("precision@%d", k), func(m Metrics) float64 { return m.Precision }},
+		{"MRR", func(m Metrics) float64 { return m.MRR }},
+		{fmt.Sprintf("nDCG@%d", k), func(m Metrics) float64 { return m.NDCG }},
+	}
+}
+
+func formatDelta(delta float64) string {
+	switch {
+	case delta > 0.00005:
+		return fmt.Sprintf("+%.4f", delta)
+	case delta < -0.00005:
+		return fmt.Sprintf("%.4f", delta)
+	default:
+		return "="
+	}
+}
@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"log"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minTrimmedTokens - меньше этого обрезанный источник бесполезен
+	minTrimmedTokens = 40
+	// sourceOverheadTokens - номер [n] и переводы строк у каждого источника
+	sourceOverheadTokens = 4
+	// unlimitedBudget - окно модели не задано, источники не ограничиваются
+	unlimitedBudget = -1
+)
+
+// ContextOptions задают бюджет контекста: окно модели минус ожидаемая
+// длина ответа. Нулевое окно - без ограничения.
+type ContextOptions struct {
+	Window       int
+	AnswerTokens int
+}
+
+// ContextReport - что попало в контекст, а что не поместилось.
+type ContextReport struct {
+	Budget   int
+	Used     int
+	Included []string
+	Trimmed  []string
+	Dropped  []string
+}
+
+// EstimateTokens грубо оценивает число токенов без словаря модели.
+// BPE-токенизаторы режут кириллицу мельче латиницы: в среднем около
+// 4 символов латиницы и 2.5 символов кириллицы на токен, цифры и знаки
+// препинания почти всегда идут отдельными токенами.
+func EstimateTokens(text string) int {
+	var latin, cyrillic, other float64
+
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.IsLetter(r):
+			// Остальные алфавиты и иероглифы - примерно токен на символ
+			other += 1.5
+		default:
+			other++
+		}
+	}
+
+	tokens := latin/4 + cyrillic/2.5 + other/1.5
+	if tokens == 0 {
+		return 0
+	}
+	return int(math.Ceil(tokens))
+}
+
+// contextBudget - сколько токенов можно отдать под источники: всё,
+// что остаётся от промпта AnswerPrompt без них. Если не остаётся
+// ничего, источники в промпт не попадают.
+func (o ContextOptions) contextBudget(question string) int {
+	if o.Window <= 0 {
+		return unlimitedBudget
+	}
+
+	prompt := EstimateTokens(AnswerPrompt(contextHeader+contextFooter, question))
+	return max(o.Window-o.AnswerTokens-prompt, 0)
+}
+
+// checkBudget предупреждает, если окна модели не хватает даже на промпт
+// с коротким вопросом.
+func (o ContextOptions) checkBudget() {
+	if o.Window > 0 && o.contextBudget("") < minTrimmedTokens {
+		log.Printf("Окна модели %d токенов не хватает на ответ в %d токенов и источники: контекст из базы знаний не будет передаваться",
+			o.Window, o.AnswerTokens)
+	}
+}
+
+// fitBudget заполняет бюджет источниками по порядку выдачи. Источник,
+// который не влезает целиком, обрезается по границе предложения, если
+// от бюджета осталось достаточно; остальные отбрасываются.
+func fitBudget(hits []SearchHit, budget int) ([]SearchHit, ContextReport) {
+	report := ContextReport{Budget: budget}
+
+	if budget == unlimitedBudget {
+		for _, hit := range hits {
+			report.Used += EstimateTokens(hit.Document.Content)
+			report.Included = append(report.Included, hit.Document.ID)
+		}
+		return hits, report
+	}
+
+	fitted := make([]SearchHit, 0, len(hits))
+	for _, hit := range hits {
+		remaining := budget - report.Used - sourceOverheadTokens
+		tokens := EstimateTokens(hit.Document.Content)
+
+		switch {
+		case tokens <= remaining:
+			report.Used += tokens + sourceOverheadTokens
+			report.Included = append(report.Included, hit.Document.ID)
+			fitted = append(fitted, hit)
+
+		case remaining >= minTrimmedTokens:
+			hit.Document.Content = trimToTokens(hit.Document.Content, remaining)
+			report.Used += EstimateTokens(hit.Document.Content) + sourceOverheadTokens
+			report.Trimmed = append(report.Trimmed, hit.Document.ID)
+			fitted = append(fitted, hit)
+
+		default:
+			report.Dropped = append(report.Dropped, hit.Document.ID)
+		}
+	}
+
+	return fitted, report
+}
+
+// trimToTokens укорачивает текст до limit токенов, стараясь закончить
+// на конце предложения или строки.
+func trimToTokens(text string, limit int) string {
+	// Запас на многоточие
+	limit--
+
+	runes := []rune(text)
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if EstimateTokens(string(runes[:mid])) <= limit {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+
+	cut := string(runes[:low])
+	if boundary := strings.LastIndexAny(cut, ".!?\n"); boundary >= len(cut)/2 {
+		cut = cut[:boundary+1]
+	}
+
+	return strings.TrimSpace(cut) + "…"
+}
@@ -0,0 +1,171 @@
+package rag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestContextBudget(t *testing.T) {
+	question := "Как развернуть Docker?"
+	prompt := EstimateTokens(AnswerPrompt(contextHeader+contextFooter, question))
+
+	tests := []struct {
+		name string
+		opts ContextOptions
+		want int
+	}{
+		{name: "окно не задано", opts: ContextOptions{}, want: unlimitedBudget},
+		{name: "остаток окна", opts: ContextOptions{Window: 4096, AnswerTokens: 1024}, want: 4096 - 1024 - prompt},
+		{name: "ровно на промпт", opts: ContextOptions{Window: 1024 + prompt, AnswerTokens: 1024}, want: 0},
+		{name: "окно меньше ответа", opts: ContextOptions{Window: 500, AnswerTokens: 1024}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.contextBudget(question); got != tt.want {
+				t.Errorf("contextBudget = %d, ожидалось %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitBudget(t *testing.T) {
+	short := "Docker упаковывает приложение в контейнер."
+	long := strings.Repeat("Контейнер запускается одной командой. ", 40)
+	shortTokens := EstimateTokens(short) + sourceOverheadTokens
+
+	hitsOf := func(contents ...string) []SearchHit {
+		hits := make([]SearchHit, len(contents))
+		for i, content := range contents {
+			hits[i] = SearchHit{Document: Document{ID: string(rune('a' + i)), Content: content}}
+		}
+		return hits
+	}
+
+	tests := []struct {
+		name     string
+		hits     []SearchHit
+		budget   int
+		ids      []string
+		included []string
+		trimmed  []string
+		dropped  []string
+	}{
+		{
+			name:     "без ограничения",
+			hits:     hitsOf(short, long),
+			budget:   unlimitedBudget,
+			ids:      []string{"a", "b"},
+			included: []string{"a", "b"},
+		},
+		{
+			name:     "всё помещается",
+			hits:     hitsOf(short, short),
+			budget:   2 * shortTokens,
+			ids:      []string{"a", "b"},
+			included: []string{"a", "b"},
+		},
+		{
+			name:     "длинный обрезается",
+			hits:     hitsOf(short, long),
+			budget:   shortTokens + sourceOverheadTokens + 2*minTrimmedTokens,
+			ids:      []string{"a", "b"},
+			included: []string{"a"},
+			trimmed:  []string{"b"},
+		},
+		{
+			name:     "на обрезку не хватает, следующий короткий влезает",
+			hits:     hitsOf(short, long, short),
+			budget:   2 * shortTokens,
+			ids:      []string{"a", "c"},
+			included: []string{"a", "c"},
+			dropped:  []string{"b"},
+		},
+		{
+			name:    "нулевой бюджет",
+			hits:    hitsOf(short, long),
+			budget:  0,
+			dropped: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fitted, report := fitBudget(tt.hits, tt.budget)
+
+			var ids []string
+			for _, hit := range fitted {
+				ids = append(ids, hit.Document.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("в контексте %v, ожидалось %v", ids, tt.ids)
+			}
+			if !reflect.DeepEqual(report.Included, tt.included) || !reflect.DeepEqual(report.Trimmed, tt.trimmed) ||
+				!reflect.DeepEqual(report.Dropped, tt.dropped) {
+				t.Errorf("отчёт %+v, ожидались целиком %v, обрезаны %v, отброшены %v", report, tt.included, tt.trimmed, tt.dropped)
+			}
+			if report.Budget != tt.budget {
+				t.Errorf("бюджет в отчёте %d, ожидался %d", report.Budget, tt.budget)
+			}
+			if tt.budget != unlimitedBudget && report.Used > tt.budget {
+				t.Errorf("занято %d токенов из %d", report.Used, tt.budget)
+			}
+
+			used := 0
+			for _, hit := range fitted {
+				used += EstimateTokens(hit.Document.Content)
+				if tt.budget != unlimitedBudget {
+					used += sourceOverheadTokens
+				}
+			}
+			if used != report.Used {
+				t.Errorf("в отчёте занято %d токенов, по источникам %d", report.Used, used)
+			}
+		})
+	}
+}
+
+func TestTrimToTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{
+			name:  "по концу предложения",
+			text:  "Первое предложение. Второе предложение подлиннее",
+			limit: 12,
+			want:  "Первое предложение.…",
+		},
+		{
+			name:  "граница слишком рано - режется по символам",
+			text:  "Да. Длинное продолжение без точек до самого конца текста",
+			limit: 10,
+			want:  "Да. Длинное продолжение…",
+		},
+		{
+			name:  "по переводу строки",
+			text:  "Заголовок раздела\nОсновной текст раздела",
+			limit: 11,
+			want:  "Заголовок раздела…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trimToTokens(tt.text, tt.limit)
+			if got != tt.want {
+				t.Errorf("trimToTokens = %q, ожидалось %q", got, tt.want)
+			}
+			if tokens := EstimateTokens(got); tokens > tt.limit {
+				t.Errorf("%q - %d токенов, больше %d", got, tokens, tt.limit)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("%q - обрезан посреди символа", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	ChunkNone      = "none"
+	ChunkSentence  = "sentence"
+	ChunkParagraph = "paragraph"
+	ChunkTokens    = "tokens"
+	ChunkMarkdown  = "markdown"
+
+	DefaultChunkMaxTokens = 200
+	DefaultChunkOverlap   = 30
+)
+
+var (
+	sentenceEndRegexp  = regexp.MustCompile(`[.!?…]+["»)\]]*\s+`)
+	paragraphRegexp    = regexp.MustCompile(`\n[ \t]*\n`)
+	wordSpanRegexp     = regexp.MustCompile(`\S+`)
+	markdownHeadRegexp = regexp.MustCompile(`(?m)^(#{1,6})[ \t]+(.+?)[ \t#]*$`)
+)
+
+type ChunkOptions struct {
+	Strategy  string
+	MaxTokens int
+	Overlap   int
+}
+
+// Chunk - фрагмент исходного текста. Start и End - байтовые смещения
+// в исходном тексте, по ним соседние фрагменты склеиваются обратно.
+type Chunk struct {
+	Text     string
+	Position int
+	Start    int
+	End      int
+	Heading  string
+}
+
+type Chunker struct {
+	opts ChunkOptions
+}
+
+type textSpan struct {
+	start  int
+	end    int
+	tokens int
+}
+
+func NewChunker(opts ChunkOptions) (*Chunker, error) {
+	switch opts.Strategy {
+	case "":
+		opts.Strategy = ChunkMarkdown
+	case ChunkNone, ChunkSentence, ChunkParagraph, ChunkTokens, ChunkMarkdown:
+	default:
+		return nil, fmt.Errorf("неизвестная стратегия разбиения: %s", opts.Strategy)
+	}
+
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = DefaultChunkMaxTokens
+	}
+	if opts.Overlap < 0 || opts.Overlap >= opts.MaxTokens {
+		opts.Overlap = 0
+	}
+
+	return &Chunker{opts: opts}, nil
+}
+
+// Split делит текст на фрагменты. Текст, который укладывается в бюджет,
+// возвращается одним фрагментом.
+func (c *Chunker) Split(text string) []Chunk {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	if c.opts.Strategy == ChunkNone || countWords(text) <= c.opts.MaxTokens {
+		return []Chunk{{Text: strings.TrimSpace(text), Start: 0, End: len(text)}}
+	}
+
+	var chunks []Chunk
+	switch c.opts.Strategy {
+	case ChunkMarkdown:
+		chunks = c.splitMarkdown(text)
+	default:
+		for _, span := range c.splitSpans(text, 0, len(text), c.opts.Strategy) {
+			chunks = append(chunks, newChunk(text, span, ""))
+		}
+	}
+
+	for i := range chunks {
+		chunks[i].Position = i
+	}
+
+	return chunks
+}
+
+func (c *Chunker) splitMarkdown(text string) []Chunk {
+	headings := markdownHeadRegexp.FindAllStringSubmatchIndex(text, -1)
+	if len(headings) == 0 {
+		var chunks []Chunk
+		for _, span := range c.splitSpans(text, 0, len(text), ChunkParagraph) {
+			chunks = append(chunks, newChunk(text, span, ""))
+		}
+		return chunks
+	}
+
+	var chunks []Chunk
+	var path []string
+	var levels []int
+
+	addSection := func(start, end int, heading string) {
+		for _, span := range c.splitSpans(text, start, end, ChunkParagraph) {
+			chunks = append(chunks, newChunk(text, span, heading))
+		}
+	}
+
+	addSection(0, headings[0][0], "")
+
+	for i, match := range headings {
+		level := match[3] - match[2]
+		title := strings.TrimSpace(text[match[4]:match[5]])
+
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		levels = append(levels, level)
+		path = append(path, title)
+
+		end := len(text)
+		if i+1 < len(headings) {
+			end = headings[i+1][0]
+		}
+		addSection(match[1], end, strings.Join(path, " > "))
+	}
+
+	return chunks
+}
+
+// splitSpans делит участок text[start:end] на сегменты по стратегии и
+// упаковывает их во фрагменты с учётом бюджета и перекрытия.
+func (c *Chunker) splitSpans(text string, start, end int, strategy string) []textSpan {
+	var segments []textSpan
+
+	switch strategy {
+	case ChunkTokens:
+		return c.tokenWindows(text, start, end)
+	case ChunkSentence:
+		segments = splitByRegexp(text, start, end, sentenceEndRegexp)
+	default:
+		segments = splitByRegexp(text, start, end, paragraphRegexp)
+	}
+
+	var units []textSpan
+	for _, segment := range segments {
+		if segment.tokens <= c.opts.MaxTokens {
+			units = append(units, segment)
+			continue
+		}
+
+		// Слишком длинный абзац делим по предложениям, длинное предложение - по словам
+		if strategy == ChunkParagraph {
+			units = append(units, c.splitSpans(text, segment.start, segment.end, ChunkSentence)...)
+		} else {
+			units = append(units, c.tokenWindows(text, segment.start, segment.end)...)
+		}
+	}
+
+	return c.pack(units)
+}
+
+func (c *Chunker) pack(units []textSpan) []textSpan {
+	var result []textSpan
+
+	for i := 0; i < len(units); {
+		tokens := 0
+		j := i
+		for j < len(units) && (j == i || tokens+units[j].tokens <= c.opts.MaxTokens) {
+			tokens += units[j].tokens
+			j++
+		}
+
+		result = append(result, textSpan{start: units[i].start, end: units[j-1].end, tokens: tokens})
+		if j >= len(units) {
+			break
+		}
+
+		next := j
+		overlap := 0
+		for next-1 > i && overlap+units[next-1].tokens <= c.opts.Overlap {
+			next--
+			overlap += units[next].tokens
+		}
+		i = next
+	}
+
+	return result
+}
+
+func (c *Chunker) tokenWindows(text string, start, end int) []textSpan {
+	words := wordSpanRegexp.FindAllStringIndex(text[start:end], -1)
+	if len(words) == 0 {
+		return nil
+	}
+
+	step := c.opts.MaxTokens - c.opts.Overlap
+	if step <= 0 {
+		step = c.opts.MaxTokens
+	}
+
+	var result []textSpan
+	for i := 0; i < len(words); i += step {
+		j := i + c.opts.MaxTokens
+		if j > len(words) {
+			j = len(words)
+		}
+
+		result = append(result, textSpan{start: start + words[i][0], end: start + words[j-1][1], tokens: j - i})
+		if j == len(words) {
+			break
+		}
+	}
+
+	return result
+}
+
+func splitByRegexp(text string, start, end int, separator *regexp.Regexp) []textSpan {
+	var spans []textSpan
+	segmentStart := start
+
+	addSpan := func(from, to int) {
+		segment := text[from:to]
+		trimmedLeft := strings.TrimLeft(segment, " \t\r\n")
+		from += len(segment) - len(trimmedLeft)
+		to = from + len(strings.TrimRight(trimmedLeft, " \t\r\n"))
+		if to > from {
+			spans = append(spans, textSpan{start: from, end: to, tokens: countWords(text[from:to])})
+		}
+	}
+
+	for _, match := range separator.FindAllStringIndex(text[start:end], -1) {
+		// Знак конца предложения остаётся в предыдущем сегменте
+		cut := start + match[0] + len(strings.TrimRight(text[start+match[0]:start+match[1]], " \t\r\n"))
+		addSpan(segmentStart, cut)
+		segmentStart = start + match[1]
+	}
+	addSpan(segmentStart, end)
+
+	return spans
+}
+
+func newChunk(text string, span textSpan, heading string) Chunk {
+	return Chunk{
+		Text:    text[span.start:span.end],
+		Start:   span.start,
+		End:     span.end,
+		Heading: heading,
+	}
+}
+
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunkerSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ChunkOptions
+		text     string
+		texts    []string
+		headings []string
+	}{
+		{
+			name: "пустой текст",
+			opts: ChunkOptions{Strategy: ChunkSentence, MaxTokens: 3},
+			text: " \n ",
+		},
+		{
+			name:  "текст в бюджете",
+			opts:  ChunkOptions{Strategy: ChunkSentence, MaxTokens: 10},
+			text:  "  Раз два. Три.  ",
+			texts: []string{"Раз два. Три."},
+		},
+		{
+			name:  "без разбиения",
+			opts:  ChunkOptions{Strategy: ChunkNone, MaxTokens: 2},
+			text:  "Раз два три четыре",
+			texts: []string{"Раз два три четыре"},
+		},
+		{
+			name:  "окна по словам с перекрытием",
+			opts:  ChunkOptions{Strategy: ChunkTokens, MaxTokens: 3, Overlap: 1},
+			text:  "a b c d e f g",
+			texts: []string{"a b c", "c d e", "e f g"},
+		},
+		{
+			name:  "по предложениям",
+			opts:  ChunkOptions{Strategy: ChunkSentence, MaxTokens: 4},
+			text:  "Раз два. Три четыре! Пять шесть?",
+			texts: []string{"Раз два. Три четыре!", "Пять шесть?"},
+		},
+		{
+			name:  "по предложениям с перекрытием",
+			opts:  ChunkOptions{Strategy: ChunkSentence, MaxTokens: 4, Overlap: 2},
+			text:  "Раз два. Три четыре. Пять шесть.",
+			texts: []string{"Раз два. Три четыре.", "Три четыре. Пять шесть."},
+		},
+		{
+			name:  "длинное предложение делится по словам",
+			opts:  ChunkOptions{Strategy: ChunkSentence, MaxTokens: 2},
+			text:  "Раз два три. Четыре",
+			texts: []string{"Раз два", "три. Четыре"},
+		},
+		{
+			name:  "по абзацам",
+			opts:  ChunkOptions{Strategy: ChunkParagraph, MaxTokens: 3},
+			text:  "Первый абзац текста\n\nВторой абзац текста",
+			texts: []string{"Первый абзац текста", "Второй абзац текста"},
+		},
+		{
+			name:     "по заголовкам markdown",
+			opts:     ChunkOptions{Strategy: ChunkMarkdown, MaxTokens: 3},
+			text:     "# Установка\nскачайте и распакуйте\n## Настройка\nукажите токен бота\n# Запуск\nвыполните команду",
+			texts:    []string{"скачайте и распакуйте", "укажите токен бота", "выполните команду"},
+			headings: []string{"Установка", "Установка > Настройка", "Запуск"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunker, err := NewChunker(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chunks := chunker.Split(tt.text)
+
+			var texts, headings []string
+			for i, chunk := range chunks {
+				texts = append(texts, chunk.Text)
+				if tt.headings != nil {
+					headings = append(headings, chunk.Heading)
+				}
+				if chunk.Position != i {
+					t.Errorf("фрагмент %d: Position = %d", i, chunk.Position)
+				}
+				if len(chunks) > 1 && tt.text[chunk.Start:chunk.End] != chunk.Text {
+					t.Errorf("фрагмент %d: смещения %d:%d не совпадают с текстом %q", i, chunk.Start, chunk.End, chunk.Text)
+				}
+			}
+
+			if !reflect.DeepEqual(texts, tt.texts) {
+				t.Errorf("Split = %q, ожидалось %q", texts, tt.texts)
+			}
+			if !reflect.DeepEqual(headings, tt.headings) {
+				t.Errorf("заголовки %q, ожидалось %q", headings, tt.headings)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CollectionPersonal = "personal"
+	CollectionGroup    = "group"
+	CollectionGlobal   = "global"
+
+	// GlobalCollection - общая коллекция по умолчанию. В неё попадают
+	// документы без коллекции, например демо-данные и всё, что было
+	// добавлено до появления коллекций.
+	GlobalCollection = "global"
+
+	collectionsFile = "collections.json"
+)
+
+var collectionNameRegexp = regexp.MustCompile(`^[\p{L}\p{N}_-]{1,32}$`)
+
+// Collection - именованный раздел базы знаний. Полное имя включает
+// пространство владельца: user:42/notes, chat:-100123/faq, global/docs.
+type Collection struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	OwnerID   int64     `json:"owner_id,omitempty"`
+	CreatedBy int64     `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShortName - имя без пространства владельца, как его вводит пользователь.
+func (c Collection) ShortName() string {
+	if _, short, found := strings.Cut(c.Name, "/"); found {
+		return short
+	}
+	return c.Name
+}
+
+// IsDefault - личная коллекция пользователя или общая коллекция группы,
+// которые существуют всегда и не создаются явно.
+func (c Collection) IsDefault() bool {
+	return !strings.Contains(c.Name, "/")
+}
+
+// Scope - где выполняется команда: личный чат пользователя или группа.
+type Scope struct {
+	ChatID  int64
+	UserID  int64
+	Private bool
+}
+
+func (s Scope) namespace() string {
+	if s.Private {
+		return PersonalCollection(s.UserID)
+	}
+	return GroupCollection(s.ChatID)
+}
+
+func (s Scope) defaultCollection() Collection {
+	if s.Private {
+		return Collection{Name: PersonalCollection(s.UserID), Kind: CollectionPersonal, OwnerID: s.UserID}
+	}
+	return Collection{Name: GroupCollection(s.ChatID), Kind: CollectionGroup, OwnerID: s.ChatID}
+}
+
+func PersonalCollection(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+func GroupCollection(chatID int64) string {
+	return "chat:" + strconv.FormatInt(chatID, 10)
+}
+
+// ParseCollection разбирает полное имя коллекции: global, global/docs,
+// user:42, user:42/notes, chat:-100123, chat:-100123/faq.
+func ParseCollection(name string) (Collection, error) {
+	namespace, short, custom := strings.Cut(name, "/")
+	if custom && !collectionNameRegexp.MatchString(short) {
+		return Collection{}, fmt.Errorf("недопустимая коллекция %q", name)
+	}
+
+	collection := Collection{Name: name}
+	switch {
+	case namespace == GlobalCollection:
+		collection.Kind = CollectionGlobal
+		return collection, nil
+	case strings.HasPrefix(namespace, "user:"):
+		collection.Kind = CollectionPersonal
+	case strings.HasPrefix(namespace, "chat:"):
+		collection.Kind = CollectionGroup
+	default:
+		return Collection{}, fmt.Errorf("недопустимая коллекция %q", name)
+	}
+
+	_, owner, _ := strings.Cut(namespace, ":")
+	ownerID, err := strconv.ParseInt(owner, 10, 64)
+	if err != nil {
+		return Collection{}, fmt.Errorf("недопустимая коллекция %q", name)
+	}
+	collection.OwnerID = ownerID
+
+	return collection, nil
+}
+
+// InCollections оставляет документы из перечисленных коллекций.
+func InCollections(names ...string) Filter {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return fieldFilter{
+		field:  filterFieldCollection,
+		values: names,
+		match: func(doc Document) bool {
+			return set[documentCollection(doc)]
+		},
+	}
+}
+
+func documentCollection(doc Document) string {
+	if doc.Metadata.Collection == "" {
+		return GlobalCollection
+	}
+	return doc.Metadata.Collection
+}
+
+// Collections хранит созданные коллекции и активную коллекцию каждого
+// чата. Состояние сохраняется в collections.json рядом с базой.
+type Collections struct {
+	path        string
+	collections map[string]Collection
+	active      map[int64]string
+	mu          sync.RWMutex
+}
+
+type collectionsState struct {
+	Collections []Collection     `json:"collections"`
+	Active      map[int64]string `json:"active"`
+}
+
+// OpenCollections загружает реестр из dir; пустой dir - реестр только в памяти.
+func OpenCollections(dir string) (*Collections, error) {
+	c := &Collections{
+		collections: make(map[string]Collection),
+		active:      make(map[int64]string),
+	}
+	c.collections[GlobalCollection] = Collection{Name: GlobalCollection, Kind: CollectionGlobal}
+
+	if dir == "" {
+		return c, nil
+	}
+	c.path = filepath.Join(dir, collectionsFile)
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения списка коллекций: %v", err)
+	}
+
+	var state collectionsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("повреждён файл коллекций: %v", err)
+	}
+
+	for _, collection := range state.Collections {
+		c.collections[collection.Name] = collection
+	}
+	for chatID, name := range state.Active {
+		c.active[chatID] = name
+	}
+
+	return c, nil
+}
+
+// save вызывается под блокировкой c.mu
+func (c *Collections) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	state := collectionsState{Active: c.active}
+	for _, collection := range c.collections {
+		if collection.Name != GlobalCollection {
+			state.Collections = append(state.Collections, collection)
+		}
+	}
+	sort.Slice(state.Collections, func(i, j int) bool {
+		return state.Collections[i].Name < state.Collections[j].Name
+	})
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, data)
+}
+
+// Create создаёт коллекцию в пространстве scope, а при global - общую.
+func (c *Collections) Create(scope Scope, name string, global bool) (Collection, error) {
+	if !collectionNameRegexp.MatchString(name) {
+		return Collection{}, fmt.Errorf("имя коллекции может содержать только буквы, цифры, _ и - (до 32 символов)")
+	}
+
+	collection := Collection{
+		Name:      scope.namespace() + "/" + name,
+		Kind:      scope.defaultCollection().Kind,
+		OwnerID:   scope.defaultCollection().OwnerID,
+		CreatedBy: scope.UserID,
+		CreatedAt: time.Now(),
+	}
+	if global {
+		collection.Name = GlobalCollection + "/" + name
+		collection.Kind = CollectionGlobal
+		collection.OwnerID = 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.collections[collection.Name]; exists {
+		return Collection{}, fmt.Errorf("коллекция %s уже существует", name)
+	}
+
+	c.collections[collection.Name] = collection
+	if err := c.save(); err != nil {
+		delete(c.collections, collection.Name)
+		return Collection{}, err
+	}
+
+	return collection, nil
+}
+
+// ensure регистрирует коллекцию, которая пришла с импортом документов.
+func (c *Collections) ensure(collection Collection) error {
+	if collection.IsDefault() {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.collections[collection.Name]; exists {
+		return nil
+	}
+
+	collection.CreatedAt = time.Now()
+	c.collections[collection.Name] = collection
+	return c.save()
+}
+
+// Resolve находит коллекцию по короткому или полному имени. Сначала
+// ищется в пространстве текущего чата, затем среди общих.
+func (c *Collections) Resolve(scope Scope, name string) (Collection, error) {
+	def := scope.defaultCollection()
+	if name == "" || name == "default" || name == def.Name {
+		return def, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, candidate := range []string{scope.namespace() + "/" + name, GlobalCollection + "/" + name, name} {
+		if collection, exists := c.collections[candidate]; exists {
+			if c.visible(scope, collection) {
+				return collection, nil
+			}
+		}
+	}
+
+	return Collection{}, fmt.Errorf("коллекция %s не найдена", name)
+}
+
+// visible вызывается под блокировкой c.mu: чужие личные коллекции и
+// коллекции других групп недоступны.
+func (c *Collections) visible(scope Scope, collection Collection) bool {
+	switch collection.Kind {
+	case CollectionGlobal:
+		return true
+	case CollectionPersonal:
+		return scope.Private && collection.OwnerID == scope.UserID
+	default:
+		return !scope.Private && collection.OwnerID == scope.ChatID
+	}
+}
+
+// Active возвращает коллекцию, в которую чат пишет и по которой ищет.
+func (c *Collections) Active(scope Scope) Collection {
+	c.mu.RLock()
+	name, found := c.active[scope.ChatID]
+	collection, exists := c.collections[name]
+	c.mu.RUnlock()
+
+	if found && exists {
+		return collection
+	}
+	return scope.defaultCollection()
+}
+
+func (c *Collections) SetActive(scope Scope, collection Collection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if collection.Name == scope.defaultCollection().Name {
+		delete(c.active, scope.ChatID)
+	} else {
+		c.active[scope.ChatID] = collection.Name
+	}
+	return c.save()
+}
+
+// OfDocument возвращает коллекцию документа. Коллекции по умолчанию
+// не хранятся в реестре и восстанавливаются по имени.
+func (c *Collections) OfDocument(doc Document) Collection {
+	name := documentCollection(doc)
+
+	c.mu.RLock()
+	collection, exists := c.collections[name]
+	c.mu.RUnlock()
+
+	if exists {
+		return collection
+	}
+	collection, _ = ParseCollection(name)
+	return collection
+}
+
+// SearchScope - коллекции, по которым ищет чат: активная и все общие.
+func (c *Collections) SearchScope(scope Scope) []string {
+	names := []string{c.Active(scope).Name}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, collection := range c.collections {
+		if collection.Kind == CollectionGlobal && name != names[0] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// List возвращает коллекции, доступные в чате: коллекцию по умолчанию,
+// созданные в этом чате и общие.
+func (c *Collections) List(scope Scope) []Collection {
+	result := []Collection{scope.defaultCollection()}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var rest []Collection
+	for _, collection := range c.collections {
+		if c.visible(scope, collection) {
+			rest = append(rest, collection)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		if rest[i].Kind != rest[j].Kind {
+			return rest[i].Kind != CollectionGlobal
+		}
+		return rest[i].Name < rest[j].Name
+	})
+
+	return append(result, rest...)
+}
+
+// Remove удаляет коллекцию из реестра. Чаты, где она была активной,
+// возвращаются к коллекции по умолчанию.
+func (c *Collections) Remove(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.collections, name)
+	for chatID, active := range c.active {
+		if active == name {
+			delete(c.active, chatID)
+		}
+	}
+	return c.save()
+}
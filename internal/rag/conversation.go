@@ -0,0 +1,184 @@
+package rag
+
+import (
+	"log"
+	"strings"
+)
+
+const (
+	// Списки, которые сливаются при поиске с историей диалога
+	RetrieverQuestion     = "question"
+	RetrieverConversation = "conversation"
+	RetrieverSticky       = "sticky"
+
+	DefaultConversationWeight = 0.5
+	DefaultStickyWeight       = 0.3
+	DefaultStickyMinMatch     = 0.2
+)
+
+// ConversationOptions задают поиск с учётом диалога. Кроме поиска по
+// самому вопросу ищется склейка последних Turns вопросов с текущим, её
+// результаты идут с весом Weight. Документы, на которые опирались ответы
+// последних StickyTurns реплик, остаются в выдаче с весом StickyWeight,
+// если ещё видны по фильтрам и содержат не меньше StickyMinMatch
+// терминов текущего вопроса. Переписывание вопроса моделью (Rewrite)
+// работает независимо и может сочетаться со склейкой.
+type ConversationOptions struct {
+	Turns          int
+	Weight         float64
+	StickyTurns    int
+	StickyWeight   float64
+	StickyMinMatch float64
+}
+
+func (o ConversationOptions) withDefaults() ConversationOptions {
+	if o.Weight <= 0 {
+		o.Weight = DefaultConversationWeight
+	}
+	if o.StickyWeight <= 0 {
+		o.StickyWeight = DefaultStickyWeight
+	}
+	if o.StickyMinMatch <= 0 {
+		o.StickyMinMatch = DefaultStickyMinMatch
+	}
+	return o
+}
+
+// contextText склеивает предыдущие вопросы с текущим, от старых к новым.
+func (o ConversationOptions) contextText(question string, history []Turn) string {
+	if o.Turns <= 0 || len(history) == 0 {
+		return ""
+	}
+	if len(history) > o.Turns {
+		history = history[len(history)-o.Turns:]
+	}
+
+	parts := make([]string, 0, len(history)+1)
+	for _, turn := range history {
+		if text := strings.TrimSpace(turn.Question); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(append(parts, question), "\n")
+}
+
+// retrieveConversation ищет по вопросу, а при непустой истории сливает
+// выдачу с поиском по склейке вопросов и с документами прошлых ответов.
+func (p *RAGPipeline) retrieveConversation(query Query, history []Turn, topK int, filters []Filter) []SearchHit {
+	hits := p.retrieve(query, topK, filters)
+	if len(history) == 0 {
+		return hits
+	}
+
+	lists := map[string][]SearchHit{RetrieverQuestion: hits}
+	weights := map[string]float64{RetrieverQuestion: 1}
+
+	if text := p.conversation.contextText(query.Original, history); text != "" {
+		lists[RetrieverConversation] = p.retrieve(Query{Original: text, Text: text, DenseText: text}, topK, filters)
+		weights[RetrieverConversation] = p.conversation.Weight
+	}
+
+	if sticky := p.stickyHits(query.Text, history, filters); len(sticky) > 0 {
+		lists[RetrieverSticky] = sticky
+		weights[RetrieverSticky] = p.conversation.StickyWeight
+	}
+
+	if len(lists) == 1 {
+		return hits
+	}
+
+	var fused []SearchHit
+	if p.retrieval.Fusion == FusionWeighted {
+		fused = fuseWeighted(lists, weights)
+	} else {
+		fused = fuseRRF(lists, weights, p.retrieval.RRFK)
+	}
+
+	if len(fused) > topK {
+		fused = fused[:topK]
+	}
+
+	p.logHits("RAG: с учётом диалога", fused)
+
+	return fused
+}
+
+// stickyHits - документы, на которые опирались ответы последних
+// StickyTurns реплик, от новых к старым. Удалённые, не подходящие под
+// фильтры и не связанные с текущим вопросом документы пропускаются.
+func (p *RAGPipeline) stickyHits(question string, history []Turn, filters []Filter) []SearchHit {
+	if p.conversation.StickyTurns <= 0 {
+		return nil
+	}
+	if len(history) > p.conversation.StickyTurns {
+		history = history[len(history)-p.conversation.StickyTurns:]
+	}
+
+	terms := uniqueTerms(p.tokenizer.Tokenize(question))
+
+	seen := make(map[string]bool)
+	var hits []SearchHit
+	for i := len(history) - 1; i >= 0; i-- {
+		for _, id := range history[i].Sources {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			doc, found := p.store.Get(id)
+			if !found || !matchAll(doc, filters) {
+				continue
+			}
+			if match := p.termMatch(terms, doc); match < p.conversation.StickyMinMatch {
+				if p.debug {
+					log.Printf("RAG: документ %s из прошлого ответа не связан с вопросом (%.2f)", id, match)
+				}
+				continue
+			}
+			hits = append(hits, SearchHit{
+				Document:   doc,
+				Score:      1 / float64(len(history)-i),
+				Retrievers: map[string]float64{RetrieverSticky: 1},
+			})
+		}
+	}
+
+	return hits
+}
+
+// termMatch - доля терминов вопроса, которые есть в документе. Вопрос
+// из одних местоимений вроде «а как его?» ни с чем не сравнить, такой
+// документ считается связанным.
+func (p *RAGPipeline) termMatch(terms []string, doc Document) float64 {
+	if len(terms) == 0 {
+		return 1
+	}
+
+	docTerms := make(map[string]bool)
+	for _, term := range p.tokenizer.Tokenize(doc.indexText()) {
+		docTerms[term] = true
+	}
+
+	matched := 0
+	for _, term := range terms {
+		if docTerms[term] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(terms))
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	terms := tokens[:0]
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,262 @@
+package rag
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+const (
+	DedupOff    = "off"
+	DedupReject = "reject"
+	DedupMerge  = "merge"
+	DedupLink   = "link"
+
+	DefaultDedupThreshold = 0.75
+
+	// 16 полос по 4 строки: пары с Jaccard от 0.75 становятся
+	// кандидатами с вероятностью больше 99%
+	minHashSize = 64
+	lshBands    = 16
+	lshRows     = minHashSize / lshBands
+)
+
+var minHashSeeds = func() [minHashSize]uint64 {
+	var seeds [minHashSize]uint64
+	for i := range seeds {
+		seeds[i] = mix64(uint64(i) + 0x9e3779b97f4a7c15)
+	}
+	return seeds
+}()
+
+type DedupOptions struct {
+	Policy    string
+	Threshold float64
+}
+
+func (o DedupOptions) validate() (DedupOptions, error) {
+	switch o.Policy {
+	case "":
+		o.Policy = DedupOff
+	case DedupOff, DedupReject, DedupMerge, DedupLink:
+	default:
+		return o, fmt.Errorf("неизвестная политика дубликатов: %s", o.Policy)
+	}
+
+	if o.Threshold <= 0 || o.Threshold > 1 {
+		o.Threshold = DefaultDedupThreshold
+	}
+	return o, nil
+}
+
+// Duplicate - похожий документ и оценка сходства Жаккара по MinHash.
+type Duplicate struct {
+	ID         string
+	Similarity float64
+}
+
+// DuplicateError возвращается, когда политика reject не даёт добавить
+// почти точную копию существующего документа.
+type DuplicateError struct {
+	Duplicate
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("похожий документ уже есть: %s (сходство %.0f%%)", e.ID, e.Similarity*100)
+}
+
+// mix64 - финализатор splitmix64, превращает хеш шингла в значение
+// для i-й хеш-функции MinHash.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// minHashSignature строит подпись по словам и парам соседних слов.
+// Токены уже прошли стемминг и стоп-слова, поэтому «упаковывать
+// приложения» и «упаковать приложение» дают одинаковые шинглы.
+func minHashSignature(tokens []string) []uint64 {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	signature := make([]uint64, minHashSize)
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+
+	add := func(shingle string) {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(shingle))
+		h := hasher.Sum64()
+
+		for i, seed := range minHashSeeds {
+			if v := mix64(h ^ seed); v < signature[i] {
+				signature[i] = v
+			}
+		}
+	}
+
+	for i, token := range tokens {
+		add(token)
+		if i > 0 {
+			add(tokens[i-1] + " " + token)
+		}
+	}
+
+	return signature
+}
+
+func signatureSimilarity(a, b []uint64) float64 {
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+// duplicateIndex хранит подписи документов и LSH-корзины. Фрагменты
+// одного документа объединяются: подпись объединения множеств - это
+// поэлементный минимум подписей.
+type duplicateIndex struct {
+	signatures map[string][]uint64
+	buckets    map[uint64][]string
+}
+
+func newDuplicateIndex() *duplicateIndex {
+	return &duplicateIndex{
+		signatures: make(map[string][]uint64),
+		buckets:    make(map[uint64][]string),
+	}
+}
+
+func bandKeys(signature []uint64) []uint64 {
+	keys := make([]uint64, lshBands)
+	for band := 0; band < lshBands; band++ {
+		key := mix64(uint64(band) + 1)
+		for _, value := range signature[band*lshRows : (band+1)*lshRows] {
+			key = mix64(key ^ value)
+		}
+		keys[band] = key
+	}
+	return keys
+}
+
+func (d *duplicateIndex) add(group string, signature []uint64) {
+	if existing, found := d.signatures[group]; found {
+		merged := make([]uint64, minHashSize)
+		for i := range merged {
+			merged[i] = min(existing[i], signature[i])
+		}
+		d.remove(group)
+		signature = merged
+	}
+
+	d.signatures[group] = signature
+	for _, key := range bandKeys(signature) {
+		d.buckets[key] = append(d.buckets[key], group)
+	}
+}
+
+func (d *duplicateIndex) remove(group string) {
+	signature, found := d.signatures[group]
+	if !found {
+		return
+	}
+
+	for _, key := range bandKeys(signature) {
+		groups := d.buckets[key]
+		for i, candidate := range groups {
+			if candidate == group {
+				groups = append(groups[:i], groups[i+1:]...)
+				break
+			}
+		}
+		if len(groups) == 0 {
+			delete(d.buckets, key)
+		} else {
+			d.buckets[key] = groups
+		}
+	}
+	delete(d.signatures, group)
+}
+
+// similar находит документы со сходством не ниже threshold.
+func (d *duplicateIndex) similar(signature []uint64, threshold float64, accept func(group string) bool) []Duplicate {
+	seen := make(map[string]bool)
+	var result []Duplicate
+
+	for _, key := range bandKeys(signature) {
+		for _, group := range d.buckets[key] {
+			if seen[group] {
+				continue
+			}
+			seen[group] = true
+
+			similarity := signatureSimilarity(signature, d.signatures[group])
+			if similarity >= threshold && accept(group) {
+				result = append(result, Duplicate{ID: group, Similarity: similarity})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Similarity != result[j].Similarity {
+			return result[i].Similarity > result[j].Similarity
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// clusters объединяет попарно похожие документы в группы (union-find).
+func (d *duplicateIndex) clusters(threshold float64) [][]string {
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(x string) string {
+		if parent[x] != x {
+			parent[x] = find(parent[x])
+		}
+		return parent[x]
+	}
+
+	for group := range d.signatures {
+		parent[group] = group
+	}
+
+	for group, signature := range d.signatures {
+		for _, duplicate := range d.similar(signature, threshold, func(other string) bool { return other != group }) {
+			if a, b := find(group), find(duplicate.ID); a != b {
+				parent[a] = b
+			}
+		}
+	}
+
+	members := make(map[string][]string)
+	for group := range d.signatures {
+		root := find(group)
+		members[root] = append(members[root], group)
+	}
+
+	var result [][]string
+	for _, cluster := range members {
+		if len(cluster) > 1 {
+			sort.Strings(cluster)
+			result = append(result, cluster)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i]) != len(result[j]) {
+			return len(result[i]) > len(result[j])
+		}
+		return result[i][0] < result[j][0]
+	})
+	return result
+}
@@ -0,0 +1,153 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// chunkedText - текст из n разных предложений, который чанкер режет на
+// несколько фрагментов.
+func chunkedText(topic string, n int) string {
+	sentences := make([]string, n)
+	for i := range sentences {
+		sentences[i] = fmt.Sprintf("%s номер %d описывает отдельный шаг %d настройки сервиса.", topic, i, i*7)
+	}
+	return strings.Join(sentences, " ")
+}
+
+func chunkStore(t *testing.T, parentID, text string) (*VectorStore, []Document) {
+	t.Helper()
+
+	chunker, err := NewChunker(ChunkOptions{Strategy: ChunkSentence, MaxTokens: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := chunker.Split(text)
+	if len(chunks) < 3 {
+		t.Fatalf("текст разбит на %d фрагментов, нужно хотя бы 3", len(chunks))
+	}
+
+	vs := NewVectorStore()
+	docs := ChunkDocuments(parentID, chunks, Metadata{})
+	if _, err := vs.AddDocuments(docs); err != nil {
+		t.Fatal(err)
+	}
+	return vs, docs
+}
+
+func TestDeleteChunkedDocumentDropsSignature(t *testing.T) {
+	text := chunkedText("Инструкция", 12)
+	vs, _ := chunkStore(t, "doc", text)
+	vs.AddDocument(text, Metadata{})
+
+	if duplicates := vs.FindDuplicates(text, 0.9); len(duplicates) != 2 {
+		t.Fatalf("до удаления найдено %v, ожидались оба документа", duplicates)
+	}
+	if clusters := vs.DuplicateClusters(0.9); len(clusters) != 1 {
+		t.Fatalf("до удаления кластеры %v, ожидался один", clusters)
+	}
+
+	if _, err := vs.DeleteDocument("doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, duplicate := range vs.FindDuplicates(text, 0.5) {
+		if duplicate.ID == "doc" {
+			t.Errorf("удалённый документ найден как дубликат: %v", duplicate)
+		}
+	}
+	if clusters := vs.DuplicateClusters(0.5); len(clusters) != 0 {
+		t.Errorf("после удаления остались кластеры %v", clusters)
+	}
+}
+
+func TestDeleteChunkKeepsGroupSignature(t *testing.T) {
+	text := chunkedText("Инструкция", 12)
+	vs, docs := chunkStore(t, "doc", text)
+
+	if _, err := vs.DeleteDocument(docs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Подпись группы собрана из оставшихся фрагментов и совпадает с
+	// подписью их общего текста
+	var rest []string
+	for _, doc := range docs[1:] {
+		rest = append(rest, doc.Content)
+	}
+	duplicates := vs.FindDuplicates(strings.Join(rest, " "), 0.9)
+	if len(duplicates) != 1 || duplicates[0].ID != "doc" {
+		t.Fatalf("по оставшимся фрагментам найдено %v, ожидался doc", duplicates)
+	}
+}
+
+func TestPipelineDedupPolicies(t *testing.T) {
+	original := "Docker позволяет упаковывать приложения в контейнеры для удобного развертывания на любом сервере"
+	longer := original + " и в облаке"
+
+	tests := []struct {
+		name      string
+		policy    string
+		author    int64
+		wantErr   bool
+		merged    bool
+		documents int
+		content   string
+		link      bool
+	}{
+		{name: "reject", policy: DedupReject, author: 1, wantErr: true, documents: 1, content: original},
+		{name: "merge того же автора", policy: DedupMerge, author: 1, merged: true, documents: 1, content: longer},
+		{name: "merge чужого становится link", policy: DedupMerge, author: 2, documents: 2, content: original, link: true},
+		{name: "link", policy: DedupLink, author: 1, documents: 2, content: original, link: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewRAGPipeline(Options{Stemming: true, Dedup: DedupOptions{Policy: tt.policy}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first, err := p.AddDocument(original, Metadata{AuthorID: 1, Tags: []string{"docker"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := p.AddDocument(longer, Metadata{AuthorID: tt.author, Tags: []string{"devops"}})
+			var duplicateErr *DuplicateError
+			if tt.wantErr != errors.As(err, &duplicateErr) {
+				t.Fatalf("ошибка %v, ожидался DuplicateError: %v", err, tt.wantErr)
+			}
+			if result.Duplicate == nil || result.Duplicate.ID != first.ID {
+				t.Fatalf("найден дубликат %v, ожидался %s", result.Duplicate, first.ID)
+			}
+			if result.Merged != tt.merged {
+				t.Errorf("Merged = %v, ожидалось %v", result.Merged, tt.merged)
+			}
+
+			if documents := p.store.Len(); documents != tt.documents {
+				t.Errorf("в базе %d документов, ожидалось %d", documents, tt.documents)
+			}
+
+			existing, _ := p.GetDocument(first.ID)
+			if existing.Content != tt.content {
+				t.Errorf("текст исходного документа %q, ожидался %q", existing.Content, tt.content)
+			}
+			if tt.merged && !existing.Metadata.HasTag("devops") {
+				t.Errorf("теги не объединены: %v", existing.Metadata.Tags)
+			}
+			if existing.Metadata.AuthorID != 1 {
+				t.Errorf("автор исходного документа %d, ожидался 1", existing.Metadata.AuthorID)
+			}
+
+			if tt.link {
+				added, _ := p.GetDocument(result.ID)
+				if result.ID == first.ID || added.Metadata.Extra["duplicate_of"] != first.ID {
+					t.Errorf("новый документ %s без ссылки на %s: %v", result.ID, first.ID, added.Metadata.Extra)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package rag
+
+import (
+	"math"
+	"sort"
+)
+
+// DenseHit - номер документа в хранилище и косинусная близость к запросу.
+type DenseHit struct {
+	DocNum int
+	Score  float64
+}
+
+// DenseIndex ищет ближайшие нормированные векторы по косинусной близости.
+type DenseIndex interface {
+	Add(docNum int, vector []float64)
+	Remove(docNum int)
+	Search(query []float64, topK int, accept func(docNum int) bool) []DenseHit
+	Len() int
+}
+
+// FlatIndex - точный поиск полным перебором.
+type FlatIndex struct {
+	vectors map[int][]float64
+}
+
+func NewFlatIndex() *FlatIndex {
+	return &FlatIndex{
+		vectors: make(map[int][]float64),
+	}
+}
+
+func (idx *FlatIndex) Add(docNum int, vector []float64) {
+	idx.vectors[docNum] = vector
+}
+
+func (idx *FlatIndex) Remove(docNum int) {
+	delete(idx.vectors, docNum)
+}
+
+func (idx *FlatIndex) Len() int {
+	return len(idx.vectors)
+}
+
+func (idx *FlatIndex) Search(query []float64, topK int, accept func(docNum int) bool) []DenseHit {
+	hits := make([]DenseHit, 0, len(idx.vectors))
+	for docNum, vector := range idx.vectors {
+		if accept != nil && !accept(docNum) {
+			continue
+		}
+		hits = append(hits, DenseHit{DocNum: docNum, Score: dotProduct(query, vector)})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].DocNum < hits[j].DocNum
+	})
+
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	return hits
+}
+
+func dotProduct(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// normalizeVector приводит вектор к единичной длине и к точности float32,
+// с которой векторы сохраняются на диск: так восстановленный вектор
+// совпадает с исходным, и сохранённый граф HNSW остаётся годным.
+func normalizeVector(vector []float64) []float64 {
+	norm := 0.0
+	for _, value := range vector {
+		norm += value * value
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	norm = math.Sqrt(norm)
+	normalized := make([]float64, len(vector))
+	for i, value := range vector {
+		normalized[i] = float64(float32(value / norm))
+	}
+	return normalized
+}
@@ -0,0 +1,280 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatCSV      = "csv"
+	FormatJSON     = "json"
+	FormatJSONL    = "jsonl"
+)
+
+var (
+	htmlDropRegexp  = regexp.MustCompile(`(?is)<(script|style|head|noscript|template)\b.*?</(script|style|head|noscript|template)\s*>|<!--.*?-->`)
+	htmlBlockRegexp = regexp.MustCompile(`(?i)</?(p|div|br|li|ul|ol|tr|table|h[1-6]|section|article|header|footer|blockquote|pre)\b[^>]*>`)
+	htmlTagRegexp   = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankRunRegexp  = regexp.MustCompile(`\n[ \t]*\n(\s*\n)+`)
+	spaceRunRegexp  = regexp.MustCompile(`[ \t\f\r]+`)
+)
+
+// DetectFormat выбирает извлекатель по расширению файла, а если оно
+// незнакомое - по MIME-типу.
+func DetectFormat(filename, mimeType string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt", ".text", ".log":
+		return FormatText
+	case ".md", ".markdown":
+		return FormatMarkdown
+	case ".html", ".htm":
+		return FormatHTML
+	case ".csv", ".tsv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	}
+
+	mimeType, _, _ = strings.Cut(strings.ToLower(mimeType), ";")
+	switch strings.TrimSpace(mimeType) {
+	case "text/plain":
+		return FormatText
+	case "text/markdown", "text/x-markdown":
+		return FormatMarkdown
+	case "text/html", "application/xhtml+xml":
+		return FormatHTML
+	case "text/csv", "text/tab-separated-values":
+		return FormatCSV
+	case "application/json":
+		return FormatJSON
+	case "application/x-ndjson", "application/jsonl":
+		return FormatJSONL
+	}
+
+	return ""
+}
+
+// ExtractText достаёт из файла текст для индексации. Строки CSV и
+// записи JSON разделяются пустой строкой, чтобы чанкер не склеивал
+// середину одной записи с началом другой.
+func ExtractText(filename, mimeType string, data []byte) (string, error) {
+	format := DetectFormat(filename, mimeType)
+	if format == "" {
+		return "", fmt.Errorf("неподдерживаемый формат файла %s (%s)", filename, mimeType)
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("файл %s не в кодировке UTF-8", filename)
+	}
+
+	var text string
+	var err error
+
+	switch format {
+	case FormatHTML:
+		text = htmlToText(string(data))
+	case FormatCSV:
+		text, err = csvToText(data)
+	case FormatJSON:
+		text, err = jsonToText(data)
+	case FormatJSONL:
+		text, err = jsonlToText(data)
+	default:
+		text = string(data)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("в файле %s нет текста", filename)
+	}
+	return text, nil
+}
+
+func htmlToText(source string) string {
+	text := htmlDropRegexp.ReplaceAllString(source, " ")
+	text = htmlBlockRegexp.ReplaceAllString(text, "\n")
+	text = htmlTagRegexp.ReplaceAllString(text, " ")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaceRunRegexp.ReplaceAllString(line, " "))
+	}
+
+	return blankRunRegexp.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
+
+// csvToText превращает каждую строку в «колонка: значение; ...» по
+// заголовку из первой строки.
+func csvToText(data []byte) (string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("ошибка разбора CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	header := rows[0]
+	records := make([]string, 0, len(rows)-1)
+
+	for _, row := range rows[1:] {
+		var fields []string
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if i < len(header) && strings.TrimSpace(header[i]) != "" {
+				value = strings.TrimSpace(header[i]) + ": " + value
+			}
+			fields = append(fields, value)
+		}
+		if len(fields) > 0 {
+			records = append(records, strings.Join(fields, "; "))
+		}
+	}
+
+	return strings.Join(records, "\n\n"), nil
+}
+
+func detectDelimiter(data []byte) rune {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+
+	best, bestCount := ',', 0
+	for _, delimiter := range []rune{',', ';', '\t', '|'} {
+		if count := bytes.Count(firstLine, []byte(string(delimiter))); count > bestCount {
+			best, bestCount = delimiter, count
+		}
+	}
+	return best
+}
+
+func jsonToText(data []byte) (string, error) {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return "", fmt.Errorf("ошибка разбора JSON: %v", err)
+	}
+
+	// Массив верхнего уровня - это список записей
+	if items, ok := value.([]interface{}); ok {
+		records := make([]string, 0, len(items))
+		for _, item := range items {
+			if record := flattenJSON(item); record != "" {
+				records = append(records, record)
+			}
+		}
+		return strings.Join(records, "\n\n"), nil
+	}
+
+	return flattenJSON(value), nil
+}
+
+func jsonlToText(data []byte) (string, error) {
+	var records []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		value, err := decodeJSON(line)
+		if err != nil {
+			return "", fmt.Errorf("ошибка разбора JSONL в строке %d: %v", lineNumber, err)
+		}
+		if record := flattenJSON(value); record != "" {
+			records = append(records, record)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return strings.Join(records, "\n\n"), nil
+}
+
+// decodeJSON сохраняет числа как есть, без перевода в 1e+06.
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// flattenJSON записывает объект построчно как «путь.к.полю: значение».
+func flattenJSON(value interface{}) string {
+	var lines []string
+	flattenJSONValue("", value, &lines)
+	return strings.Join(lines, "\n")
+}
+
+func flattenJSONValue(path string, value interface{}, lines *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			flattenJSONValue(childPath, v[key], lines)
+		}
+
+	case []interface{}:
+		for _, item := range v {
+			flattenJSONValue(path, item, lines)
+		}
+
+	case nil:
+
+	default:
+		text := strings.TrimSpace(fmt.Sprint(v))
+		if text == "" {
+			return
+		}
+		if path != "" {
+			text = path + ": " + text
+		}
+		*lines = append(*lines, text)
+	}
+}
@@ -0,0 +1,246 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	feedbackFile = "feedback.jsonl"
+
+	RatingUp   = 1
+	RatingDown = -1
+)
+
+// Feedback - оценка ответа пользователем вместе с вопросом, ответом и
+// ID документов, на которые ответ опирался. Повторная оценка того же
+// ответа тем же пользователем заменяет прежнюю.
+type Feedback struct {
+	AnswerID  string    `json:"answer_id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	Rating    int       `json:"rating"`
+	Question  string    `json:"question"`
+	Answer    string    `json:"answer"`
+	Sources   []string  `json:"sources,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (f Feedback) key() string {
+	return fmt.Sprintf("%s/%d", f.AnswerID, f.UserID)
+}
+
+// FeedbackOptions: Weight - насколько оценки двигают документ в выдаче,
+// балл умножается на множитель от 1-Weight до 1+Weight. Ноль - оценки
+// только копятся для отчёта.
+type FeedbackOptions struct {
+	Weight float64
+}
+
+// DocumentRating - оценки ответов, которые опирались на документ.
+type DocumentRating struct {
+	ID           string
+	Up           int
+	Down         int
+	LastQuestion string
+}
+
+// Score - доля положительных оценок со сглаживанием Лапласа: у документа
+// без оценок 0.5, одна оценка не делает его ни лучшим, ни худшим.
+func (r DocumentRating) Score() float64 {
+	return float64(r.Up+1) / float64(r.Up+r.Down+2)
+}
+
+// FeedbackStore копит оценки в памяти и дописывает их в feedback.jsonl
+// рядом с базой; при открытии журнал перечитывается.
+type FeedbackStore struct {
+	path    string
+	weight  float64
+	votes   map[string]Feedback
+	ratings map[string]*DocumentRating
+	mu      sync.RWMutex
+}
+
+// OpenFeedback загружает оценки из dir; пустой dir - оценки только в памяти.
+func OpenFeedback(dir string, opts FeedbackOptions) (*FeedbackStore, error) {
+	f := &FeedbackStore{
+		weight:  min(max(opts.Weight, 0), 1),
+		votes:   make(map[string]Feedback),
+		ratings: make(map[string]*DocumentRating),
+	}
+
+	if dir == "" {
+		return f, nil
+	}
+	f.path = filepath.Join(dir, feedbackFile)
+
+	err := replayLog(f.path, func(line []byte) error {
+		var feedback Feedback
+		if err := json.Unmarshal(line, &feedback); err != nil {
+			return err
+		}
+		f.apply(feedback)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения оценок: %v", err)
+	}
+
+	return f, nil
+}
+
+// Add сохраняет оценку. changed == false, если пользователь уже
+// поставил этому ответу такую же.
+func (f *FeedbackStore) Add(feedback Feedback) (changed bool, err error) {
+	if feedback.Rating != RatingUp && feedback.Rating != RatingDown {
+		return false, fmt.Errorf("неизвестная оценка: %d", feedback.Rating)
+	}
+	if feedback.CreatedAt.IsZero() {
+		feedback.CreatedAt = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if previous, found := f.votes[feedback.key()]; found && previous.Rating == feedback.Rating {
+		return false, nil
+	}
+
+	if err := f.persist(feedback); err != nil {
+		return false, err
+	}
+	f.apply(feedback)
+	return true, nil
+}
+
+// persist дописывает оценку в журнал. Вызывается под блокировкой.
+func (f *FeedbackStore) persist(feedback Feedback) error {
+	if f.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(feedback)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия журнала оценок: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("ошибка записи оценки: %v", err)
+	}
+	return file.Sync()
+}
+
+// apply учитывает оценку в сводке по документам, отменяя прежнюю оценку
+// того же пользователя. Вызывается под блокировкой.
+func (f *FeedbackStore) apply(feedback Feedback) {
+	if previous, found := f.votes[feedback.key()]; found {
+		for _, id := range previous.Sources {
+			if rating := f.ratings[id]; rating != nil {
+				if previous.Rating == RatingUp {
+					rating.Up--
+				} else {
+					rating.Down--
+				}
+			}
+		}
+	}
+	f.votes[feedback.key()] = feedback
+
+	for _, id := range feedback.Sources {
+		rating := f.ratings[id]
+		if rating == nil {
+			rating = &DocumentRating{ID: id}
+			f.ratings[id] = rating
+		}
+		if feedback.Rating == RatingUp {
+			rating.Up++
+		} else {
+			rating.Down++
+			rating.LastQuestion = feedback.Question
+		}
+	}
+}
+
+// Totals - число положительных и отрицательных оценок ответов.
+func (f *FeedbackStore) Totals() (up, down int) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, feedback := range f.votes {
+		if feedback.Rating == RatingUp {
+			up++
+		} else {
+			down++
+		}
+	}
+	return up, down
+}
+
+// Worst - документы хотя бы с одной отрицательной оценкой, от худших
+// к лучшим.
+func (f *FeedbackStore) Worst(limit int) []DocumentRating {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var worst []DocumentRating
+	for _, rating := range f.ratings {
+		if rating.Down > 0 {
+			worst = append(worst, *rating)
+		}
+	}
+
+	sort.Slice(worst, func(i, j int) bool {
+		if si, sj := worst[i].Score(), worst[j].Score(); si != sj {
+			return si < sj
+		}
+		if worst[i].Down != worst[j].Down {
+			return worst[i].Down > worst[j].Down
+		}
+		return worst[i].ID < worst[j].ID
+	})
+
+	if limit > 0 && len(worst) > limit {
+		worst = worst[:limit]
+	}
+	return worst
+}
+
+// active - есть ли оценки, которые меняют выдачу.
+func (f *FeedbackStore) active() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.weight > 0 && len(f.ratings) > 0
+}
+
+// adjust умножает баллы документов на множитель от их оценок и
+// пересортировывает выдачу.
+func (f *FeedbackStore) adjust(hits []SearchHit) []SearchHit {
+	if !f.active() {
+		return hits
+	}
+
+	f.mu.RLock()
+	for i := range hits {
+		if rating, found := f.ratings[hits[i].Document.ID]; found {
+			hits[i].Score *= 1 + f.weight*(2*rating.Score()-1)
+		}
+	}
+	f.mu.RUnlock()
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	return hits
+}
@@ -0,0 +1,177 @@
+package rag
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func vote(answerID string, userID int64, rating int, sources ...string) Feedback {
+	return Feedback{AnswerID: answerID, UserID: userID, Rating: rating, Question: "вопрос " + answerID, Sources: sources}
+}
+
+func TestFeedbackRevote(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenFeedback(dir, FeedbackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		feedback Feedback
+		changed  bool
+	}{
+		{vote("ans1", 1, RatingUp, "a", "b"), true},
+		{vote("ans1", 1, RatingUp, "a", "b"), false},
+		{vote("ans1", 1, RatingDown, "a", "b"), true},
+		{vote("ans1", 2, RatingUp, "a"), true},
+	}
+	for i, step := range steps {
+		changed, err := store.Add(step.feedback)
+		if err != nil {
+			t.Fatalf("шаг %d: %v", i, err)
+		}
+		if changed != step.changed {
+			t.Errorf("шаг %d: changed = %v, ожидалось %v", i, changed, step.changed)
+		}
+	}
+
+	want := map[string]DocumentRating{
+		"a": {ID: "a", Up: 1, Down: 1, LastQuestion: "вопрос ans1"},
+		"b": {ID: "b", Up: 0, Down: 1, LastQuestion: "вопрос ans1"},
+	}
+
+	check := func(label string, store *FeedbackStore) {
+		t.Helper()
+
+		for id, rating := range want {
+			if got := *store.ratings[id]; got != rating {
+				t.Errorf("%s: оценки %s = %+v, ожидалось %+v", label, id, got, rating)
+			}
+		}
+		if up, down := store.Totals(); up != 1 || down != 1 {
+			t.Errorf("%s: всего %d+ %d-, ожидалось 1+ 1-", label, up, down)
+		}
+	}
+
+	check("до перезапуска", store)
+
+	reopened, err := OpenFeedback(dir, FeedbackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("после перезапуска", reopened)
+
+	// Повтор той же оценки после перезапуска тоже ничего не меняет
+	if changed, _ := reopened.Add(vote("ans1", 1, RatingDown, "a", "b")); changed {
+		t.Error("повторная оценка после перезапуска засчитана")
+	}
+}
+
+func TestFeedbackAdjust(t *testing.T) {
+	ratings := []Feedback{
+		vote("ans1", 1, RatingDown, "a"),
+		vote("ans2", 1, RatingDown, "a"),
+		vote("ans3", 1, RatingUp, "c"),
+		vote("ans4", 1, RatingUp, "c"),
+	}
+
+	tests := []struct {
+		name   string
+		weight float64
+		ids    []string
+		scores []float64
+	}{
+		{
+			name:   "без веса выдача не меняется",
+			weight: 0,
+			ids:    []string{"a", "b", "c"},
+			scores: []float64{3, 2, 1.5},
+		},
+		{
+			name:   "оценки двигают документы",
+			weight: 1,
+			ids:    []string{"c", "b", "a"},
+			// Сглаженные доли: a - 1/4, c - 3/4, множитель 1 + (2*доля - 1)
+			scores: []float64{2.25, 2, 1.5},
+		},
+		{
+			name:   "половинный вес",
+			weight: 0.5,
+			ids:    []string{"a", "b", "c"},
+			scores: []float64{2.25, 2, 1.875},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := OpenFeedback("", FeedbackOptions{Weight: tt.weight})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, feedback := range ratings {
+				if _, err := store.Add(feedback); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			hits := []SearchHit{
+				{Document: Document{ID: "a"}, Score: 3},
+				{Document: Document{ID: "b"}, Score: 2},
+				{Document: Document{ID: "c"}, Score: 1.5},
+			}
+			hits = store.adjust(hits)
+
+			for i, hit := range hits {
+				if hit.Document.ID != tt.ids[i] || math.Abs(hit.Score-tt.scores[i]) > 1e-9 {
+					t.Errorf("место %d: %s %.3f, ожидалось %s %.3f", i, hit.Document.ID, hit.Score, tt.ids[i], tt.scores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFeedbackWorst(t *testing.T) {
+	store, err := OpenFeedback("", FeedbackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, feedback := range []Feedback{
+		// a: 0+ 1- - доля 1/3
+		vote("1", 1, RatingDown, "a"),
+		// b: 1+ 3- - доля 2/6, как у a, но минусов больше
+		vote("2", 1, RatingDown, "b"),
+		vote("3", 1, RatingDown, "b"),
+		vote("4", 1, RatingDown, "b"),
+		vote("5", 1, RatingUp, "b"),
+		// c: 0+ 3- - доля 1/5, хуже всех
+		vote("6", 1, RatingDown, "c"),
+		vote("7", 1, RatingDown, "c"),
+		vote("8", 1, RatingDown, "c"),
+		// d: 3+ 1- - доля 4/6
+		vote("9", 1, RatingDown, "d"),
+		vote("10", 1, RatingUp, "d"),
+		vote("11", 1, RatingUp, "d"),
+		vote("12", 1, RatingUp, "d"),
+		// e: без минусов в отчёт не попадает
+		vote("13", 1, RatingUp, "e"),
+	} {
+		if _, err := store.Add(feedback); err != nil {
+			t.Fatalf("оценка %d: %v", i, err)
+		}
+	}
+
+	var ids []string
+	for _, rating := range store.Worst(0) {
+		ids = append(ids, rating.ID)
+	}
+	if want := []string{"c", "b", "a", "d"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Worst = %v, ожидалось %v", ids, want)
+	}
+
+	if worst := store.Worst(2); len(worst) != 2 || worst[0].ID != "c" {
+		t.Errorf("Worst(2) = %v, ожидались два худших", worst)
+	}
+}
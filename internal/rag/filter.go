@@ -0,0 +1,467 @@
+package rag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter отбирает документы по метаданным до ранжирования.
+type Filter interface {
+	Match(doc Document) bool
+}
+
+type FilterFunc func(doc Document) bool
+
+func (f FilterFunc) Match(doc Document) bool {
+	return f(doc)
+}
+
+// allOf - фильтры, связанные через and. Отдельный тип, чтобы внешнее
+// хранилище могло разобрать их по одному, см. fieldFilter.
+type allOf []Filter
+
+func (a allOf) Match(doc Document) bool {
+	for _, f := range a {
+		if !f.Match(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+func And(filters ...Filter) Filter {
+	return allOf(filters)
+}
+
+func Or(filters ...Filter) Filter {
+	return FilterFunc(func(doc Document) bool {
+		for _, f := range filters {
+			if f.Match(doc) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func Not(filter Filter) Filter {
+	return FilterFunc(func(doc Document) bool {
+		return !filter.Match(doc)
+	})
+}
+
+const (
+	filterFieldCollection = "collection"
+	filterFieldTags       = "tags"
+)
+
+// fieldFilter пропускает документы, у которых поле field принимает одно
+// из значений values. Такой фильтр Qdrant проверяет у себя, а не по
+// локальной копии документов.
+type fieldFilter struct {
+	field  string
+	values []string
+	match  FilterFunc
+}
+
+func (f fieldFilter) Match(doc Document) bool {
+	return f.match(doc)
+}
+
+// TagIn пропускает документы хотя бы с одним из тегов, без учёта регистра.
+func TagIn(tags ...string) Filter {
+	lowered := make([]string, len(tags))
+	for i, tag := range tags {
+		lowered[i] = strings.ToLower(tag)
+	}
+
+	return fieldFilter{
+		field:  filterFieldTags,
+		values: lowered,
+		match: func(doc Document) bool {
+			for _, tag := range tags {
+				if doc.Metadata.HasTag(tag) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+func ChatIs(chatID int64) Filter {
+	return FilterFunc(func(doc Document) bool {
+		return doc.Metadata.ChatID == chatID
+	})
+}
+
+func AuthorIs(userID int64) Filter {
+	return FilterFunc(func(doc Document) bool {
+		return doc.Metadata.AuthorID == userID
+	})
+}
+
+func CreatedAfter(t time.Time) Filter {
+	return FilterFunc(func(doc Document) bool {
+		return doc.Metadata.CreatedAt.After(t)
+	})
+}
+
+func CreatedBefore(t time.Time) Filter {
+	return FilterFunc(func(doc Document) bool {
+		return doc.Metadata.CreatedAt.Before(t)
+	})
+}
+
+func matchAll(doc Document, filters []Filter) bool {
+	for _, f := range filters {
+		if f != nil && !f.Match(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseFilter разбирает выражения вида
+//
+//	tag in (docker, go) and chat = -100123 or created after 2025-01-01
+//
+// Поля: tag, chat, author, source, collection, lang, created и meta.<ключ>.
+// Операторы: = != in > < >= <= after before, связки and, or, not и скобки.
+func ParseFilter(expr string) (Filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &filterParser{tokens: tokens}
+	filter, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.done() {
+		return nil, fmt.Errorf("лишний текст в фильтре: %s", parser.peek())
+	}
+
+	return filter, nil
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *filterParser) keyword(word string) bool {
+	if strings.EqualFold(p.peek(), word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []Filter{left}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, right)
+	}
+
+	if len(filters) == 1 {
+		return left, nil
+	}
+	return Or(filters...), nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []Filter{left}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, right)
+	}
+
+	if len(filters) == 1 {
+		return left, nil
+	}
+	return And(filters...), nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	if p.keyword("not") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(inner), nil
+	}
+
+	if p.peek() == "(" {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("в фильтре не хватает закрывающей скобки")
+		}
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (Filter, error) {
+	field := strings.ToLower(p.next())
+	if field == "" {
+		return nil, fmt.Errorf("неожиданный конец фильтра")
+	}
+
+	op := strings.ToLower(p.next())
+
+	var values []string
+	if op == "in" {
+		if p.next() != "(" {
+			return nil, fmt.Errorf("после in ожидается список в скобках")
+		}
+		for {
+			value := p.next()
+			if value == "" {
+				return nil, fmt.Errorf("список значений не закрыт")
+			}
+			if value == ")" {
+				break
+			}
+			if value != "," {
+				values = append(values, value)
+			}
+		}
+	} else {
+		value := p.next()
+		if value == "" {
+			return nil, fmt.Errorf("не указано значение для поля %s", field)
+		}
+		values = []string{value}
+	}
+
+	return buildComparison(field, op, values)
+}
+
+func buildComparison(field, op string, values []string) (Filter, error) {
+	switch {
+	case (field == "tag" || field == "tags") && (op == "=" || op == "in"):
+		return TagIn(values...), nil
+
+	case field == "tag" || field == "tags":
+		return buildSetComparison(op, values, func(doc Document, value string) bool {
+			return doc.Metadata.HasTag(value)
+		})
+
+	case field == "source":
+		return buildStringComparison(op, values, func(doc Document) string { return doc.Metadata.Source })
+
+	case field == "collection":
+		return buildStringComparison(op, values, documentCollection)
+
+	case field == "lang" || field == "language":
+		return buildStringComparison(op, values, func(doc Document) string { return doc.Metadata.Language })
+
+	case strings.HasPrefix(field, "meta."):
+		key := strings.TrimPrefix(field, "meta.")
+		return buildStringComparison(op, values, func(doc Document) string { return doc.Metadata.Extra[key] })
+
+	case field == "chat":
+		return buildIntComparison(op, values, func(doc Document) int64 { return doc.Metadata.ChatID })
+
+	case field == "author" || field == "user":
+		return buildIntComparison(op, values, func(doc Document) int64 { return doc.Metadata.AuthorID })
+
+	case field == "created":
+		return buildTimeComparison(op, values)
+	}
+
+	return nil, fmt.Errorf("неизвестное поле фильтра: %s", field)
+}
+
+func buildSetComparison(op string, values []string, has func(Document, string) bool) (Filter, error) {
+	anyOf := FilterFunc(func(doc Document) bool {
+		for _, value := range values {
+			if has(doc, value) {
+				return true
+			}
+		}
+		return false
+	})
+
+	switch op {
+	case "=", "in":
+		return anyOf, nil
+	case "!=":
+		return Not(anyOf), nil
+	}
+	return nil, fmt.Errorf("оператор %s не поддерживается для тегов", op)
+}
+
+func buildStringComparison(op string, values []string, get func(Document) string) (Filter, error) {
+	return buildSetComparison(op, values, func(doc Document, value string) bool {
+		return strings.EqualFold(get(doc), value)
+	})
+}
+
+func buildIntComparison(op string, values []string, get func(Document) int64) (Filter, error) {
+	numbers := make([]int64, len(values))
+	for i, value := range values {
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ожидалось число, получено %s", value)
+		}
+		numbers[i] = number
+	}
+
+	compare := func(cmp func(a, b int64) bool) Filter {
+		return FilterFunc(func(doc Document) bool {
+			return cmp(get(doc), numbers[0])
+		})
+	}
+
+	switch op {
+	case "=", "in", "!=":
+		anyOf := FilterFunc(func(doc Document) bool {
+			actual := get(doc)
+			for _, number := range numbers {
+				if actual == number {
+					return true
+				}
+			}
+			return false
+		})
+		if op == "!=" {
+			return Not(anyOf), nil
+		}
+		return anyOf, nil
+	case ">":
+		return compare(func(a, b int64) bool { return a > b }), nil
+	case "<":
+		return compare(func(a, b int64) bool { return a < b }), nil
+	case ">=":
+		return compare(func(a, b int64) bool { return a >= b }), nil
+	case "<=":
+		return compare(func(a, b int64) bool { return a <= b }), nil
+	}
+	return nil, fmt.Errorf("оператор %s не поддерживается для чисел", op)
+}
+
+func buildTimeComparison(op string, values []string) (Filter, error) {
+	if len(values) != 1 {
+		return nil, fmt.Errorf("для даты ожидается одно значение")
+	}
+
+	t, err := parseFilterTime(values[0])
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "after", ">":
+		return CreatedAfter(t), nil
+	case "before", "<":
+		return CreatedBefore(t), nil
+	case ">=":
+		return Not(CreatedBefore(t)), nil
+	case "<=":
+		return Not(CreatedAfter(t)), nil
+	}
+	return nil, fmt.Errorf("оператор %s не поддерживается для дат", op)
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("не удалось разобрать дату: %s", value)
+}
+
+func lexFilter(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, string(r))
+			i++
+
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, string(runes[i:i+2]))
+				i += 2
+			} else if r == '!' {
+				return nil, fmt.Errorf("ожидался оператор != в позиции %d", i)
+			} else {
+				tokens = append(tokens, string(r))
+				i++
+			}
+
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("незакрытая кавычка в фильтре")
+			}
+			tokens = append(tokens, string(runes[i+1:end]))
+			i = end + 1
+
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("(),=!<>\"'", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		}
+	}
+
+	return tokens, nil
+}
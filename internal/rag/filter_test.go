@@ -0,0 +1,83 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	docs := []Document{
+		{ID: "docker", Metadata: Metadata{Tags: []string{"Docker", "devops"}, ChatID: -100, AuthorID: 1,
+			Source: "file", CreatedAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), Language: LanguageRussian,
+			Extra: map[string]string{"filename": "docker.md"}}},
+		{ID: "go", Metadata: Metadata{Tags: []string{"go"}, ChatID: -100, AuthorID: 2, Collection: "code",
+			CreatedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Language: LanguageEnglish}},
+		{ID: "cats", Metadata: Metadata{ChatID: 42, AuthorID: 2, Source: "text",
+			CreatedAt: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}},
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"tag = docker", []string{"docker"}},
+		{"tags in (go, DevOps)", []string{"docker", "go"}},
+		{"tag != docker", []string{"go", "cats"}},
+		{"chat = -100", []string{"docker", "go"}},
+		{"author in (1, 3)", []string{"docker"}},
+		{"author >= 2", []string{"go", "cats"}},
+		{"source = 'file'", []string{"docker"}},
+		{"collection = global", []string{"docker", "cats"}},
+		{"lang = en", []string{"go"}},
+		{`meta.filename = "docker.md"`, []string{"docker"}},
+		{"created after 2025-01-01", []string{"docker", "cats"}},
+		{"created before 2025-01-01T12:00", []string{"go"}},
+		{"created >= 2025-01-01T12:00:00Z", []string{"docker", "cats"}},
+		{"tag = go or chat = 42", []string{"go", "cats"}},
+		{"chat = -100 and not tag = go", []string{"docker"}},
+		{"(tag = go or tag = docker) and author = 2", []string{"go"}},
+		{"NOT (chat = -100) AND author = 2", []string{"cats"}},
+	}
+
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.expr, err)
+			continue
+		}
+
+		var matched []string
+		for _, doc := range docs {
+			if filter.Match(doc) {
+				matched = append(matched, doc.ID)
+			}
+		}
+		if !reflect.DeepEqual(matched, tt.want) {
+			t.Errorf("ParseFilter(%q) пропускает %v, ожидалось %v", tt.expr, matched, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"tag",
+		"tag =",
+		"color = red",
+		"tag > docker",
+		"author = abc",
+		"created after вчера",
+		"created in (2025-01-01, 2025-02-01)",
+		"(tag = go",
+		"tag in go",
+		"tag in (go",
+		"tag = 'go",
+		"tag ! go",
+		"tag = go chat = 1",
+	} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q) не вернул ошибку", expr)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package rag
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultFuzzyMaxEdits = 2
+	DefaultFuzzyWeight   = 0.5
+
+	// fuzzyExpansions - сколько терминов словаря подставляется вместо
+	// одного незнакомого термина запроса
+	fuzzyExpansions = 3
+)
+
+// FuzzyOptions включают поиск с опечатками: термин запроса, которого нет
+// в словаре, заменяется близкими по расстоянию редактирования терминами
+// словаря, в том числе после транслитерации. Их вклад в балл умножается
+// на Weight и на степень сходства.
+type FuzzyOptions struct {
+	Enabled  bool
+	MaxEdits int
+	Weight   float64
+}
+
+func (o FuzzyOptions) withDefaults() FuzzyOptions {
+	if o.MaxEdits <= 0 {
+		o.MaxEdits = DefaultFuzzyMaxEdits
+	}
+	if o.Weight <= 0 || o.Weight > 1 {
+		o.Weight = DefaultFuzzyWeight
+	}
+	return o
+}
+
+// maxEdits - допустимое число правок для термина: в коротких словах
+// одна опечатка уже меняет смысл, поэтому для них правки не допускаются,
+// остаётся только совпадение после транслитерации.
+func (o FuzzyOptions) maxEdits(term string) int {
+	var edits int
+	switch length := utf8.RuneCountInString(term); {
+	case length <= 3:
+		edits = 0
+	case length <= 5:
+		edits = 1
+	default:
+		edits = 2
+	}
+	return min(edits, o.MaxEdits)
+}
+
+// trigramIndex сопоставляет триграммы символов терминам словаря.
+type trigramIndex struct {
+	terms map[string]map[string]bool
+}
+
+func newTrigramIndex() *trigramIndex {
+	return &trigramIndex{terms: make(map[string]map[string]bool)}
+}
+
+// trigrams разбивает термин с маркерами начала и конца на триграммы,
+// так что у «кот» их три: «$ко», «кот», «от$».
+func trigrams(term string) []string {
+	runes := []rune("$" + term + "$")
+	if len(runes) < 3 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(runes)-2)
+	result := make([]string, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		gram := string(runes[i : i+3])
+		if !seen[gram] {
+			seen[gram] = true
+			result = append(result, gram)
+		}
+	}
+	return result
+}
+
+func (t *trigramIndex) add(term string) {
+	for _, gram := range trigrams(term) {
+		terms, exists := t.terms[gram]
+		if !exists {
+			terms = make(map[string]bool)
+			t.terms[gram] = terms
+		}
+		terms[term] = true
+	}
+}
+
+func (t *trigramIndex) remove(term string) {
+	for _, gram := range trigrams(term) {
+		terms := t.terms[gram]
+		delete(terms, term)
+		if len(terms) == 0 {
+			delete(t.terms, gram)
+		}
+	}
+}
+
+// fuzzyMatch - термин словаря, найденный вместо термина запроса.
+type fuzzyMatch struct {
+	term       string
+	distance   int
+	similarity float64
+}
+
+// similar находит термины словаря на расстоянии не больше maxEdits.
+// Каждая правка портит не больше трёх триграмм, поэтому у подходящего
+// термина общих триграмм не меньше len(grams) - 3*maxEdits.
+func (t *trigramIndex) similar(term string, maxEdits int) []fuzzyMatch {
+	grams := trigrams(term)
+	shared := make(map[string]int)
+	for _, gram := range grams {
+		for candidate := range t.terms[gram] {
+			shared[candidate]++
+		}
+	}
+
+	required := max(1, len(grams)-3*maxEdits)
+	length := utf8.RuneCountInString(term)
+
+	var matches []fuzzyMatch
+	for candidate, count := range shared {
+		if count < required || candidate == term {
+			continue
+		}
+		candidateLength := utf8.RuneCountInString(candidate)
+		if abs(candidateLength-length) > maxEdits {
+			continue
+		}
+
+		distance := editDistance(term, candidate, maxEdits)
+		if distance > maxEdits {
+			continue
+		}
+		matches = append(matches, fuzzyMatch{
+			term:       candidate,
+			distance:   distance,
+			similarity: 1 - float64(distance)/float64(max(length, candidateLength)),
+		})
+	}
+	return matches
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// editDistance - расстояние Дамерау-Левенштейна (перестановка соседних
+// букв считается одной правкой). Счёт прекращается, как только
+// расстояние превысило limit, тогда возвращается limit+1.
+func editDistance(a, b string, limit int) int {
+	source, target := []rune(a), []rune(b)
+
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	beforePrevious := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		rowMin := current[0]
+
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && source[i-1] == target[j-2] && source[i-2] == target[j-1] {
+				current[j] = min(current[j], beforePrevious[j-2]+1)
+			}
+			rowMin = min(rowMin, current[j])
+		}
+
+		if rowMin > limit {
+			return limit + 1
+		}
+		beforePrevious, previous, current = previous, current, beforePrevious
+	}
+
+	return previous[len(target)]
+}
+
+// fuzzyTerms подбирает термины словаря для терминов запроса из текста
+// query. Вызывается под блокировкой.
+func (vs *VectorStore) fuzzyTerms(query string, queryTerms map[string]int) map[string]float64 {
+	if !vs.fuzzy.Enabled {
+		return nil
+	}
+	return vs.index.fuzzyTerms(queryTerms, vs.translitTerms(query), vs.fuzzy)
+}
+
+// translitTerms транслитерирует слова запроса до стемминга: основа
+// «kontejner» после транслитерации уже не похожа на «контейнер», а
+// целое слово переводится в «контейнер» и стеммится как русское.
+func (vs *VectorStore) translitTerms(query string) map[string][]string {
+	variants := make(map[string][]string)
+	for _, word := range splitWords(strings.ToLower(query)) {
+		translit := transliterate(word)
+		if translit == word {
+			continue
+		}
+
+		terms, translitTerms := vs.tokenize(word), vs.tokenize(translit)
+		if len(terms) == 1 && len(translitTerms) == 1 && terms[0] != translitTerms[0] {
+			variants[terms[0]] = append(variants[terms[0]], translitTerms[0])
+		}
+	}
+	return variants
+}
+
+// fuzzyTerms подбирает термины словаря для терминов запроса, которых в
+// словаре нет, и возвращает их с весами. Кроме самого термина и его
+// транслитерации проверяются варианты из translit.
+func (idx *InvertedIndex) fuzzyTerms(query map[string]int, translit map[string][]string, opts FuzzyOptions) map[string]float64 {
+	if !opts.Enabled {
+		return nil
+	}
+
+	weights := make(map[string]float64)
+	for term := range query {
+		if idx.DocFreq(term) > 0 {
+			continue
+		}
+
+		best := make(map[string]fuzzyMatch)
+		for _, variant := range append(termVariants(term), translit[term]...) {
+			// Транслитерация неоднозначна (python - «питон»), поэтому для
+			// неё допускается лишняя правка
+			edits := opts.maxEdits(term)
+			if variant != term && edits > 0 {
+				edits = min(edits+1, opts.MaxEdits)
+			}
+
+			for _, match := range idx.trigrams.similar(variant, edits) {
+				if previous, found := best[match.term]; !found || match.distance < previous.distance {
+					best[match.term] = match
+				}
+			}
+			// Транслитерация даёт точное совпадение и для коротких слов
+			if variant != term && idx.DocFreq(variant) > 0 {
+				best[variant] = fuzzyMatch{term: variant, similarity: 1}
+			}
+		}
+
+		matches := make([]fuzzyMatch, 0, len(best))
+		for _, match := range best {
+			matches = append(matches, match)
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if matches[i].distance != matches[j].distance {
+				return matches[i].distance < matches[j].distance
+			}
+			if df1, df2 := idx.DocFreq(matches[i].term), idx.DocFreq(matches[j].term); df1 != df2 {
+				return df1 > df2
+			}
+			return matches[i].term < matches[j].term
+		})
+		if len(matches) > fuzzyExpansions {
+			matches = matches[:fuzzyExpansions]
+		}
+
+		for _, match := range matches {
+			weight := opts.Weight * match.similarity
+			if _, exact := query[match.term]; !exact && weight > weights[match.term] {
+				weights[match.term] = weight
+			}
+		}
+	}
+
+	return weights
+}
+
+// termVariants - термин и его транслитерация в другой алфавит:
+// «докер» ищется и как «doker».
+func termVariants(term string) []string {
+	variants := []string{term}
+	if translit := transliterate(term); translit != term && translit != "" {
+		variants = append(variants, translit)
+	}
+	return variants
+}
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// latinToCyrillic проверяется по порядку: сначала сочетания букв. После
+// гласной j читается как й (kontejner), иначе как дж (java).
+var latinToCyrillic = []struct {
+	latin    string
+	cyrillic string
+}{
+	{"sch", "щ"}, {"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ch", "ч"},
+	{"sh", "ш"}, {"yu", "ю"}, {"ya", "я"}, {"ck", "к"}, {"ph", "ф"},
+	{"a", "а"}, {"b", "б"}, {"c", "к"}, {"d", "д"}, {"e", "е"}, {"f", "ф"},
+	{"g", "г"}, {"h", "х"}, {"i", "и"}, {"j", "дж"}, {"k", "к"}, {"l", "л"},
+	{"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"}, {"q", "к"}, {"r", "р"},
+	{"s", "с"}, {"t", "т"}, {"u", "у"}, {"v", "в"}, {"w", "в"}, {"x", "кс"},
+	{"y", "й"}, {"z", "з"},
+}
+
+// transliterate переводит слово из кириллицы в латиницу и обратно.
+// Слова из смешанных алфавитов, цифр и знаков не трогаются.
+func transliterate(word string) string {
+	var builder strings.Builder
+
+	cyrillic, latin := false, false
+	for _, r := range word {
+		switch {
+		case r >= 'a' && r <= 'z':
+			latin = true
+		case cyrillicToLatin[r] != "" || r == 'ъ' || r == 'ь':
+			cyrillic = true
+		default:
+			return word
+		}
+	}
+
+	switch {
+	case cyrillic && !latin:
+		for _, r := range word {
+			builder.WriteString(cyrillicToLatin[r])
+		}
+	case latin && !cyrillic:
+		for rest := word; rest != ""; {
+			if rest[0] == 'j' && len(rest) < len(word) && strings.IndexByte("aeiouy", word[len(word)-len(rest)-1]) >= 0 {
+				builder.WriteString("й")
+				rest = rest[1:]
+				continue
+			}
+			for _, pair := range latinToCyrillic {
+				if strings.HasPrefix(rest, pair.latin) {
+					builder.WriteString(pair.cyrillic)
+					rest = rest[len(pair.latin):]
+					break
+				}
+			}
+		}
+	default:
+		return word
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,80 @@
+package rag
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"", "", 2, 0},
+		{"кот", "кот", 2, 0},
+		{"кот", "код", 2, 1},
+		{"контейнер", "контенер", 2, 1},
+		{"горутины", "горутинны", 2, 1},
+		{"docker", "doker", 2, 1},
+		{"ёж", "еж", 2, 1},
+		{"kitten", "sitting", 5, 3},
+		{"", "abc", 5, 3},
+		{"abc", "", 5, 3},
+		// Перестановка соседних букв - одна правка
+		{"ab", "ba", 2, 1},
+		{"докре", "докер", 2, 1},
+		// Подстрока не правится дважды: ca -> abc за три правки, а не за две
+		{"ca", "abc", 5, 3},
+		// При превышении limit возвращается limit+1
+		{"kitten", "sitting", 1, 2},
+		{"abc", "", 1, 2},
+		{"контейнер", "docker", 2, 3},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, ожидалось %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"докер", "doker"},
+		{"щука", "schuka"},
+		{"docker", "докер"},
+		{"kontejner", "контейнер"},
+		{"java", "джава"},
+		{"jenkins", "дженкинс"},
+		{"python", "пйтхон"},
+		// Смешанные алфавиты, цифры и знаки не трогаются
+		{"go1.25", "go1.25"},
+		{"snake_case", "snake_case"},
+		{"dockerфайл", "dockerфайл"},
+	}
+
+	for _, tt := range tests {
+		if got := transliterate(tt.word); got != tt.want {
+			t.Errorf("transliterate(%q) = %q, ожидалось %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyTransliteratesBeforeStemming(t *testing.T) {
+	vs := NewVectorStore()
+	vs.SetFuzzy(FuzzyOptions{Enabled: true, Weight: 0.5})
+	vs.AddDocument("Контейнеры запускаются командой docker run", Metadata{})
+
+	// Основа kontejnerov отличается от «контейнер» на две правки, а
+	// транслитерация целого слова совпадает с ней точно
+	query := "kontejnerov"
+	weights := vs.fuzzyTerms(query, termFrequencies(vs.tokenize(query)))
+	if weight := weights["контейнер"]; weight != 0.5 {
+		t.Fatalf("вес термина «контейнер» %.3f, ожидался 0.5 (%v)", weight, weights)
+	}
+
+	if hits := vs.SearchLexical(query, 5); len(hits) != 1 {
+		t.Fatalf("по запросу %s найдено %d документов, ожидался 1", query, len(hits))
+	}
+}
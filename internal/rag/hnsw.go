@@ -0,0 +1,556 @@
+package rag
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	DenseIndexFlat = "flat"
+	DenseIndexHNSW = "hnsw"
+
+	DefaultHNSWM              = 16
+	DefaultHNSWEfConstruction = 200
+	DefaultHNSWEfSearch       = 64
+
+	hnswFileVersion = 1
+)
+
+// HNSWOptions: M - число связей узла на верхних уровнях (на нижнем 2M),
+// EfConstruction и EfSearch - ширина поиска при вставке и запросе.
+// Чем они больше, тем выше полнота и медленнее работа.
+type HNSWOptions struct {
+	M              int
+	EfConstruction int
+	EfSearch       int
+}
+
+func (o HNSWOptions) withDefaults() HNSWOptions {
+	if o.M < 2 {
+		o.M = DefaultHNSWM
+	}
+	if o.EfConstruction < o.M {
+		o.EfConstruction = DefaultHNSWEfConstruction
+	}
+	if o.EfSearch <= 0 {
+		o.EfSearch = DefaultHNSWEfSearch
+	}
+	return o
+}
+
+// persistentIndex - плотный индекс, который сохраняется рядом со
+// снапшотом и переносится между номерами документов по их ID.
+type persistentIndex interface {
+	DenseIndex
+	Save(w io.Writer, idOf func(docNum int) string) error
+	Load(r io.Reader, resolve func(id string) (docNum int, vector []float64, ok bool)) error
+	Contains(docNum int) bool
+}
+
+type hnswNode struct {
+	vector []float64
+	// links[l] - соседи узла на уровне l
+	links [][]int
+}
+
+// HNSWIndex - приближённый поиск ближайших векторов по иерархическому
+// графу (Malkov, Yashunin, 2016). Вставка и удаление инкрементальные,
+// при удалении соседи узла перевязываются между собой.
+type HNSWIndex struct {
+	opts      HNSWOptions
+	nodes     map[int]*hnswNode
+	entry     int
+	maxLevel  int
+	levelMult float64
+	random    *rand.Rand
+}
+
+func NewHNSWIndex(opts HNSWOptions) *HNSWIndex {
+	opts = opts.withDefaults()
+	return &HNSWIndex{
+		opts:      opts,
+		nodes:     make(map[int]*hnswNode),
+		maxLevel:  -1,
+		levelMult: 1 / math.Log(float64(opts.M)),
+		// Фиксированное зерно - одинаковые данные дают одинаковый граф
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+func (h *HNSWIndex) Len() int {
+	return len(h.nodes)
+}
+
+func (h *HNSWIndex) Contains(docNum int) bool {
+	_, exists := h.nodes[docNum]
+	return exists
+}
+
+// SetEfSearch меняет ширину поиска без перестройки графа.
+func (h *HNSWIndex) SetEfSearch(ef int) {
+	if ef > 0 {
+		h.opts.EfSearch = ef
+	}
+}
+
+func (h *HNSWIndex) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * h.opts.M
+	}
+	return h.opts.M
+}
+
+func (h *HNSWIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.random.Float64()) * h.levelMult))
+}
+
+func (h *HNSWIndex) Add(docNum int, vector []float64) {
+	if _, exists := h.nodes[docNum]; exists {
+		h.Remove(docNum)
+	}
+
+	level := h.randomLevel()
+	node := &hnswNode{vector: vector, links: make([][]int, level+1)}
+	h.nodes[docNum] = node
+
+	if h.maxLevel < 0 {
+		h.entry, h.maxLevel = docNum, level
+		return
+	}
+
+	entry := []DenseHit{{DocNum: h.entry, Score: dotProduct(vector, h.nodes[h.entry].vector)}}
+	for l := h.maxLevel; l > level; l-- {
+		entry = h.searchLayer(vector, entry, 1, l)
+	}
+
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(vector, entry, h.opts.EfConstruction, l)
+
+		// Старые ссылки на этот номер могли остаться после удаления
+		filtered := candidates[:0:0]
+		for _, candidate := range candidates {
+			if candidate.DocNum != docNum {
+				filtered = append(filtered, candidate)
+			}
+		}
+
+		node.links[l] = h.selectNeighbors(filtered, h.opts.M)
+		for _, neighbor := range node.links[l] {
+			h.connect(neighbor, docNum, l)
+		}
+
+		if len(filtered) > 0 {
+			entry = filtered
+		}
+	}
+
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = docNum, level
+	}
+}
+
+// connect добавляет ссылку from -> to и, если соседей стало слишком
+// много, оставляет лучших по эвристике выбора соседей.
+func (h *HNSWIndex) connect(from, to, level int) {
+	node := h.nodes[from]
+	if node == nil || level >= len(node.links) {
+		return
+	}
+
+	node.links[level] = append(node.links[level], to)
+	if len(node.links[level]) <= h.maxLinks(level) {
+		return
+	}
+
+	node.links[level] = h.selectNeighbors(h.scoreLinks(node.vector, node.links[level], -1), h.maxLinks(level))
+}
+
+// scoreLinks считает близость кандидатов к vector и сортирует их по
+// убыванию. Удалённые узлы и skip пропускаются.
+func (h *HNSWIndex) scoreLinks(vector []float64, links []int, skip int) []DenseHit {
+	seen := make(map[int]bool, len(links))
+	candidates := make([]DenseHit, 0, len(links))
+
+	for _, link := range links {
+		if link == skip || seen[link] {
+			continue
+		}
+		seen[link] = true
+
+		if other := h.nodes[link]; other != nil {
+			candidates = append(candidates, DenseHit{DocNum: link, Score: dotProduct(vector, other.vector)})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// selectNeighbors - эвристика из статьи: кандидат берётся, если он
+// ближе к узлу, чем к уже выбранным соседям. Так связи расходятся в
+// разные стороны, а не собираются в одном кластере. Свободные места
+// добираются отброшенными кандидатами.
+func (h *HNSWIndex) selectNeighbors(candidates []DenseHit, m int) []int {
+	selected := make([]int, 0, m)
+	var pruned []int
+
+	for _, candidate := range candidates {
+		if len(selected) == m {
+			break
+		}
+
+		vector := h.nodes[candidate.DocNum].vector
+		diverse := true
+		for _, chosen := range selected {
+			if dotProduct(vector, h.nodes[chosen].vector) > candidate.Score {
+				diverse = false
+				break
+			}
+		}
+
+		if diverse {
+			selected = append(selected, candidate.DocNum)
+		} else {
+			pruned = append(pruned, candidate.DocNum)
+		}
+	}
+
+	for _, docNum := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, docNum)
+	}
+
+	return selected
+}
+
+// Remove удаляет узел. Каждый сосед, ссылавшийся на него, выбирает
+// новых соседей из своих связей и связей удалённого узла.
+func (h *HNSWIndex) Remove(docNum int) {
+	node, exists := h.nodes[docNum]
+	if !exists {
+		return
+	}
+	delete(h.nodes, docNum)
+
+	for level, links := range node.links {
+		for _, neighbor := range links {
+			other := h.nodes[neighbor]
+			if other == nil || level >= len(other.links) {
+				continue
+			}
+
+			linked := false
+			for _, link := range other.links[level] {
+				if link == docNum {
+					linked = true
+					break
+				}
+			}
+			if !linked {
+				continue
+			}
+
+			pool := append(append([]int(nil), other.links[level]...), links...)
+			other.links[level] = h.selectNeighbors(h.scoreLinks(other.vector, pool, neighbor), h.maxLinks(level))
+		}
+	}
+
+	if h.entry == docNum {
+		h.resetEntry()
+	}
+}
+
+// resetEntry выбирает точкой входа узел с самым высоким уровнем.
+func (h *HNSWIndex) resetEntry() {
+	h.entry, h.maxLevel = 0, -1
+	for docNum, node := range h.nodes {
+		level := len(node.links) - 1
+		if level > h.maxLevel || (level == h.maxLevel && docNum < h.entry) {
+			h.entry, h.maxLevel = docNum, level
+		}
+	}
+}
+
+// Search спускается по верхним уровням к ближайшему узлу и ищет на
+// нижнем уровне с шириной efSearch. Если фильтр отсёк почти всех
+// кандидатов, ширина растёт, а для очень узких фильтров поиск
+// переходит на полный перебор.
+func (h *HNSWIndex) Search(query []float64, topK int, accept func(docNum int) bool) []DenseHit {
+	if h.maxLevel < 0 || topK <= 0 {
+		return nil
+	}
+
+	entry := []DenseHit{{DocNum: h.entry, Score: dotProduct(query, h.nodes[h.entry].vector)}}
+	for l := h.maxLevel; l > 0; l-- {
+		entry = h.searchLayer(query, entry, 1, l)
+	}
+
+	ef := max(h.opts.EfSearch, topK)
+	for {
+		found := h.searchLayer(query, entry, ef, 0)
+
+		hits := make([]DenseHit, 0, topK)
+		for _, hit := range found {
+			if accept == nil || accept(hit.DocNum) {
+				hits = append(hits, hit)
+				if len(hits) == topK {
+					return hits
+				}
+			}
+		}
+
+		if len(found) < ef || accept == nil {
+			return hits
+		}
+
+		ef *= 4
+		if ef*2 >= len(h.nodes) {
+			return h.scan(query, topK, accept)
+		}
+	}
+}
+
+func (h *HNSWIndex) scan(query []float64, topK int, accept func(docNum int) bool) []DenseHit {
+	hits := make([]DenseHit, 0, topK)
+	for docNum, node := range h.nodes {
+		if accept == nil || accept(docNum) {
+			hits = append(hits, DenseHit{DocNum: docNum, Score: dotProduct(query, node.vector)})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].DocNum < hits[j].DocNum
+	})
+
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	return hits
+}
+
+// searchLayer - жадный поиск ef ближайших к query узлов на уровне level.
+// Результат отсортирован по убыванию близости.
+func (h *HNSWIndex) searchLayer(query []float64, entry []DenseHit, ef, level int) []DenseHit {
+	visited := make(map[int]bool, ef*4)
+	candidates := &hitHeap{best: true}
+	results := &hitHeap{}
+
+	for _, hit := range entry {
+		if visited[hit.DocNum] {
+			continue
+		}
+		visited[hit.DocNum] = true
+		heap.Push(candidates, hit)
+		heap.Push(results, hit)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(DenseHit)
+		if results.Len() >= ef && current.Score < results.hits[0].Score {
+			break
+		}
+
+		node := h.nodes[current.DocNum]
+		if node == nil || level >= len(node.links) {
+			continue
+		}
+
+		for _, neighbor := range node.links[level] {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+
+			other := h.nodes[neighbor]
+			if other == nil {
+				continue
+			}
+
+			score := dotProduct(query, other.vector)
+			if results.Len() < ef || score > results.hits[0].Score {
+				hit := DenseHit{DocNum: neighbor, Score: score}
+				heap.Push(candidates, hit)
+				heap.Push(results, hit)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := make([]DenseHit, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(DenseHit)
+	}
+	return sorted
+}
+
+// hitHeap - куча по близости: best - сверху самый близкий, иначе
+// самый далёкий.
+type hitHeap struct {
+	hits []DenseHit
+	best bool
+}
+
+func (q *hitHeap) Len() int { return len(q.hits) }
+
+func (q *hitHeap) Less(i, j int) bool {
+	if q.best {
+		return q.hits[i].Score > q.hits[j].Score
+	}
+	return q.hits[i].Score < q.hits[j].Score
+}
+
+func (q *hitHeap) Swap(i, j int) { q.hits[i], q.hits[j] = q.hits[j], q.hits[i] }
+
+func (q *hitHeap) Push(x any) { q.hits = append(q.hits, x.(DenseHit)) }
+
+func (q *hitHeap) Pop() any {
+	last := q.hits[len(q.hits)-1]
+	q.hits = q.hits[:len(q.hits)-1]
+	return last
+}
+
+// hnswFile - граф на диске. Узлы хранятся по ID документов, связи - по
+// позициям в Nodes, а отпечаток вектора отсекает узлы, чей документ
+// изменился после сохранения.
+type hnswFile struct {
+	Version        int
+	M              int
+	EfConstruction int
+	Entry          int
+	Nodes          []hnswFileNode
+}
+
+type hnswFileNode struct {
+	ID          string
+	Fingerprint uint64
+	Links       [][]int32
+}
+
+func vectorFingerprint(vector []float64) uint64 {
+	hasher := fnv.New64a()
+	var buf [8]byte
+	for _, value := range vector {
+		bits := math.Float64bits(value)
+		for i := range buf {
+			buf[i] = byte(bits >> (8 * i))
+		}
+		hasher.Write(buf[:])
+	}
+	return hasher.Sum64()
+}
+
+func (h *HNSWIndex) Save(w io.Writer, idOf func(docNum int) string) error {
+	docNums := make([]int, 0, len(h.nodes))
+	for docNum := range h.nodes {
+		docNums = append(docNums, docNum)
+	}
+	sort.Ints(docNums)
+
+	positions := make(map[int]int32, len(docNums))
+	for i, docNum := range docNums {
+		positions[docNum] = int32(i)
+	}
+
+	file := hnswFile{
+		Version:        hnswFileVersion,
+		M:              h.opts.M,
+		EfConstruction: h.opts.EfConstruction,
+		Entry:          -1,
+		Nodes:          make([]hnswFileNode, len(docNums)),
+	}
+	if h.maxLevel >= 0 {
+		file.Entry = int(positions[h.entry])
+	}
+
+	for i, docNum := range docNums {
+		node := h.nodes[docNum]
+		saved := hnswFileNode{
+			ID:          idOf(docNum),
+			Fingerprint: vectorFingerprint(node.vector),
+			Links:       make([][]int32, len(node.links)),
+		}
+		for level, links := range node.links {
+			saved.Links[level] = make([]int32, 0, len(links))
+			for _, link := range links {
+				if position, exists := positions[link]; exists {
+					saved.Links[level] = append(saved.Links[level], position)
+				}
+			}
+		}
+		file.Nodes[i] = saved
+	}
+
+	return gob.NewEncoder(w).Encode(file)
+}
+
+// Load заменяет граф сохранённым. Узлы документов, которых больше нет
+// или у которых изменился вектор, отбрасываются - их нужно добавить
+// заново через Add.
+func (h *HNSWIndex) Load(r io.Reader, resolve func(id string) (docNum int, vector []float64, ok bool)) error {
+	var file hnswFile
+	if err := gob.NewDecoder(r).Decode(&file); err != nil {
+		return fmt.Errorf("повреждён файл индекса: %v", err)
+	}
+	if file.Version != hnswFileVersion {
+		return fmt.Errorf("неподдерживаемая версия индекса: %d", file.Version)
+	}
+	if file.M != h.opts.M || file.EfConstruction != h.opts.EfConstruction {
+		return errors.New("параметры HNSW изменились")
+	}
+
+	docNums := make([]int, len(file.Nodes))
+	nodes := make(map[int]*hnswNode, len(file.Nodes))
+	for i, saved := range file.Nodes {
+		docNums[i] = -1
+		docNum, vector, ok := resolve(saved.ID)
+		if !ok || vectorFingerprint(vector) != saved.Fingerprint {
+			continue
+		}
+		docNums[i] = docNum
+		nodes[docNum] = &hnswNode{vector: vector, links: make([][]int, len(saved.Links))}
+	}
+
+	for i, saved := range file.Nodes {
+		node := nodes[docNums[i]]
+		if docNums[i] < 0 || node == nil {
+			continue
+		}
+		for level, links := range saved.Links {
+			node.links[level] = make([]int, 0, len(links))
+			for _, position := range links {
+				if int(position) < len(docNums) && docNums[position] >= 0 {
+					node.links[level] = append(node.links[level], docNums[position])
+				}
+			}
+		}
+	}
+
+	h.nodes = nodes
+	if file.Entry >= 0 && file.Entry < len(docNums) && docNums[file.Entry] >= 0 {
+		h.entry = docNums[file.Entry]
+		h.maxLevel = len(nodes[h.entry].links) - 1
+	} else {
+		h.resetEntry()
+	}
+
+	return nil
+}
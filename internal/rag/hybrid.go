@@ -0,0 +1,220 @@
+package rag
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	RetrieverLexical = "lexical"
+	RetrieverDense   = "dense"
+
+	RetrievalLexical = "lexical"
+	RetrievalDense   = "dense"
+	RetrievalHybrid  = "hybrid"
+
+	FusionRRF      = "rrf"
+	FusionWeighted = "weighted"
+
+	DefaultRRFK = 60
+)
+
+// SearchHit - найденный документ, итоговый балл, место в выдаче
+// (с единицы), баллы каждого ретривера, который его нашёл, и выдержка
+// вокруг совпадений с запросом.
+type SearchHit struct {
+	Document   Document
+	Score      float64
+	Rank       int
+	Retrievers map[string]float64
+	Snippet    Snippet
+}
+
+func rankHits(hits []SearchHit) []SearchHit {
+	for i := range hits {
+		hits[i].Rank = i + 1
+	}
+	return hits
+}
+
+type RetrievalOptions struct {
+	Mode          string
+	Fusion        string
+	LexicalWeight float64
+	DenseWeight   float64
+	RRFK          int
+	// DenseMinScore отсекает слабые совпадения по эмбеддингам, которые
+	// иначе попадают в выдачу всегда, даже если запрос не по теме
+	DenseMinScore float64
+}
+
+func (o RetrievalOptions) validate() (RetrievalOptions, error) {
+	switch o.Mode {
+	case "":
+		o.Mode = RetrievalHybrid
+	case RetrievalLexical, RetrievalDense, RetrievalHybrid:
+	default:
+		return o, fmt.Errorf("неизвестный режим поиска: %s", o.Mode)
+	}
+
+	switch o.Fusion {
+	case "":
+		o.Fusion = FusionRRF
+	case FusionRRF, FusionWeighted:
+	default:
+		return o, fmt.Errorf("неизвестный способ слияния результатов: %s", o.Fusion)
+	}
+
+	if o.LexicalWeight <= 0 && o.DenseWeight <= 0 {
+		o.LexicalWeight, o.DenseWeight = 1, 1
+	}
+	if o.RRFK <= 0 {
+		o.RRFK = DefaultRRFK
+	}
+
+	return o, nil
+}
+
+// hybridSearch запускает лексический и векторный поиск параллельно и
+// сливает списки. Векторный поиск идёт по query.DenseText.
+func hybridSearch(retriever Retriever, query Query, topK int, opts RetrievalOptions, filters []Filter) []SearchHit {
+	candidates := topK * 4
+
+	var lexical, dense []SearchHit
+	var wg sync.WaitGroup
+
+	if opts.Mode != RetrievalDense && opts.LexicalWeight > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lexical = retriever.SearchLexical(query.Text, candidates, filters...)
+		}()
+	}
+
+	if opts.Mode != RetrievalLexical && opts.DenseWeight > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dense = withMinScore(retriever.SearchDense(query.DenseText, candidates, filters...), opts.DenseMinScore)
+		}()
+	}
+
+	wg.Wait()
+
+	lists := map[string][]SearchHit{
+		RetrieverLexical: lexical,
+		RetrieverDense:   dense,
+	}
+	weights := map[string]float64{
+		RetrieverLexical: opts.LexicalWeight,
+		RetrieverDense:   opts.DenseWeight,
+	}
+
+	var fused []SearchHit
+	if opts.Fusion == FusionWeighted {
+		fused = fuseWeighted(lists, weights)
+	} else {
+		fused = fuseRRF(lists, weights, opts.RRFK)
+	}
+
+	if len(fused) > topK {
+		fused = fused[:topK]
+	}
+	return fused
+}
+
+func withMinScore(hits []SearchHit, minScore float64) []SearchHit {
+	filtered := hits[:0]
+	for _, hit := range hits {
+		if hit.Score >= minScore {
+			filtered = append(filtered, hit)
+		}
+	}
+	return filtered
+}
+
+// fuseRRF - reciprocal rank fusion: документ получает sum(w / (k + rank)).
+func fuseRRF(lists map[string][]SearchHit, weights map[string]float64, k int) []SearchHit {
+	merged := make(map[string]*SearchHit)
+
+	for retriever, hits := range lists {
+		for rank, hit := range hits {
+			entry := mergeHit(merged, hit, retriever)
+			entry.Retrievers[retriever] = hit.Score
+			entry.Score += weights[retriever] / float64(k+rank+1)
+		}
+	}
+
+	return sortHits(merged)
+}
+
+// fuseWeighted нормирует баллы каждого ретривера в [0, 1] и складывает
+// их с весами.
+func fuseWeighted(lists map[string][]SearchHit, weights map[string]float64) []SearchHit {
+	merged := make(map[string]*SearchHit)
+
+	for retriever, hits := range lists {
+		if len(hits) == 0 {
+			continue
+		}
+
+		maxScore, minScore := hits[0].Score, hits[0].Score
+		for _, hit := range hits {
+			if hit.Score > maxScore {
+				maxScore = hit.Score
+			}
+			if hit.Score < minScore {
+				minScore = hit.Score
+			}
+		}
+
+		for _, hit := range hits {
+			normalized := 1.0
+			if maxScore > minScore {
+				normalized = (hit.Score - minScore) / (maxScore - minScore)
+			}
+
+			entry := mergeHit(merged, hit, retriever)
+			entry.Retrievers[retriever] = hit.Score
+			entry.Score += weights[retriever] * normalized
+		}
+	}
+
+	return sortHits(merged)
+}
+
+// mergeHit находит или создаёт запись документа. Выдержка берётся от
+// лексического поиска и поиска по самому вопросу: векторный ищет по
+// HyDE-ответу, а поиск с историей - по склейке вопросов, и совпадения с
+// ними в выдержке не то, что спрашивал пользователь.
+func mergeHit(merged map[string]*SearchHit, hit SearchHit, retriever string) *SearchHit {
+	entry, exists := merged[hit.Document.ID]
+	if !exists {
+		entry = &SearchHit{
+			Document:   hit.Document,
+			Retrievers: make(map[string]float64),
+		}
+		merged[hit.Document.ID] = entry
+	}
+	if entry.Snippet.Text == "" || retriever == RetrieverLexical || retriever == RetrieverQuestion {
+		entry.Snippet = hit.Snippet
+	}
+	return entry
+}
+
+func sortHits(merged map[string]*SearchHit) []SearchHit {
+	result := make([]SearchHit, 0, len(merged))
+	for _, hit := range merged {
+		result = append(result, *hit)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Document.ID < result[j].Document.ID
+	})
+
+	return result
+}
@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"math"
+	"testing"
+)
+
+func hitsOf(ids ...string) []SearchHit {
+	hits := make([]SearchHit, len(ids))
+	for i, id := range ids {
+		hits[i] = SearchHit{Document: Document{ID: id}, Score: float64(len(ids) - i)}
+	}
+	return hits
+}
+
+func TestFuseRRF(t *testing.T) {
+	tests := []struct {
+		name    string
+		lists   map[string][]SearchHit
+		weights map[string]float64
+		k       int
+		ids     []string
+		scores  []float64
+	}{
+		{
+			name:    "равные веса, ничья по ID",
+			lists:   map[string][]SearchHit{RetrieverLexical: hitsOf("a", "b", "c"), RetrieverDense: hitsOf("b", "a", "d")},
+			weights: map[string]float64{RetrieverLexical: 1, RetrieverDense: 1},
+			k:       60,
+			ids:     []string{"a", "b", "c", "d"},
+			scores:  []float64{1.0/61 + 1.0/62, 1.0/62 + 1.0/61, 1.0 / 63, 1.0 / 63},
+		},
+		{
+			name:    "вес векторного поиска выше",
+			lists:   map[string][]SearchHit{RetrieverLexical: hitsOf("a", "b", "c"), RetrieverDense: hitsOf("b", "a", "d")},
+			weights: map[string]float64{RetrieverLexical: 1, RetrieverDense: 3},
+			k:       60,
+			ids:     []string{"b", "a", "d", "c"},
+			scores:  []float64{1.0/62 + 3.0/61, 1.0/61 + 3.0/62, 3.0 / 63, 1.0 / 63},
+		},
+		{
+			name:    "один пустой список",
+			lists:   map[string][]SearchHit{RetrieverLexical: hitsOf("x", "y"), RetrieverDense: nil},
+			weights: map[string]float64{RetrieverLexical: 1, RetrieverDense: 1},
+			k:       1,
+			ids:     []string{"x", "y"},
+			scores:  []float64{1.0 / 2, 1.0 / 3},
+		},
+		{
+			name:    "список без веса не влияет на балл",
+			lists:   map[string][]SearchHit{RetrieverLexical: hitsOf("x"), RetrieverSticky: hitsOf("z")},
+			weights: map[string]float64{RetrieverLexical: 1},
+			k:       60,
+			ids:     []string{"x", "z"},
+			scores:  []float64{1.0 / 61, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fused := fuseRRF(tt.lists, tt.weights, tt.k)
+			if len(fused) != len(tt.ids) {
+				t.Fatalf("fuseRRF вернул %d документов, ожидалось %d", len(fused), len(tt.ids))
+			}
+
+			for i, hit := range fused {
+				if hit.Document.ID != tt.ids[i] || math.Abs(hit.Score-tt.scores[i]) > 1e-12 {
+					t.Errorf("место %d: %s %.6f, ожидалось %s %.6f", i, hit.Document.ID, hit.Score, tt.ids[i], tt.scores[i])
+				}
+				for retriever, hits := range tt.lists {
+					for _, source := range hits {
+						if source.Document.ID == hit.Document.ID && hit.Retrievers[retriever] != source.Score {
+							t.Errorf("%s: балл %s = %v, ожидался исходный %v", hit.Document.ID, retriever, hit.Retrievers[retriever], source.Score)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRRFKeepsLexicalSnippet(t *testing.T) {
+	lexical := hitsOf("a")
+	lexical[0].Snippet = Snippet{Text: "лексическая"}
+	dense := hitsOf("a")
+	dense[0].Snippet = Snippet{Text: "векторная"}
+
+	for range 10 {
+		fused := fuseRRF(map[string][]SearchHit{RetrieverLexical: lexical, RetrieverDense: dense}, nil, 60)
+		if fused[0].Snippet.Text != "лексическая" {
+			t.Fatalf("выдержка %q, ожидалась выдержка лексического поиска", fused[0].Snippet.Text)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewDocumentID генерирует ULID с префиксом doc_: 48 бит времени в
+// миллисекундах и 80 случайных бит. ID сортируются по времени создания
+// и не зависят от количества документов в хранилище.
+func NewDocumentID() string {
+	var data [16]byte
+
+	ms := uint64(time.Now().UnixMilli())
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], ms)
+	copy(data[:6], timestamp[2:])
+
+	if _, err := rand.Read(data[6:]); err != nil {
+		// crypto/rand в Linux не возвращает ошибок, но на всякий случай
+		// добиваем уникальность наносекундами
+		binary.BigEndian.PutUint64(data[8:], uint64(time.Now().UnixNano()))
+	}
+
+	return "doc_" + encodeULID(data)
+}
+
+func encodeULID(data [16]byte) string {
+	// 128 бит кодируются в 26 символов base32, старший символ несёт 3 бита
+	out := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(data[:8])
+	lo := binary.BigEndian.Uint64(data[8:])
+
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out)
+}
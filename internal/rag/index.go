@@ -0,0 +1,109 @@
+package rag
+
+// InvertedIndex хранит разреженные списки вхождений терминов и
+// обновляется инкрементально при добавлении и удалении документов.
+// Триграммы словаря нужны для поиска с опечатками.
+type InvertedIndex struct {
+	postings map[string]map[int]int
+	docs     map[int]DocStats
+	totalLen int
+	trigrams *trigramIndex
+}
+
+func NewInvertedIndex() *InvertedIndex {
+	return &InvertedIndex{
+		postings: make(map[string]map[int]int),
+		docs:     make(map[int]DocStats),
+		trigrams: newTrigramIndex(),
+	}
+}
+
+func (idx *InvertedIndex) Add(docNum int, tokens []string) {
+	if _, exists := idx.docs[docNum]; exists {
+		idx.Remove(docNum)
+	}
+
+	tf := termFrequencies(tokens)
+	idx.docs[docNum] = DocStats{TermFreq: tf, Length: len(tokens)}
+	idx.totalLen += len(tokens)
+
+	for term, freq := range tf {
+		list, exists := idx.postings[term]
+		if !exists {
+			list = make(map[int]int)
+			idx.postings[term] = list
+			idx.trigrams.add(term)
+		}
+		list[docNum] = freq
+	}
+}
+
+func (idx *InvertedIndex) Remove(docNum int) {
+	stats, exists := idx.docs[docNum]
+	if !exists {
+		return
+	}
+
+	for term := range stats.TermFreq {
+		list := idx.postings[term]
+		delete(list, docNum)
+		if len(list) == 0 {
+			delete(idx.postings, term)
+			idx.trigrams.remove(term)
+		}
+	}
+
+	idx.totalLen -= stats.Length
+	delete(idx.docs, docNum)
+}
+
+// Candidates возвращает документы, содержащие хотя бы один термин запроса
+// или один из терминов, подобранных по опечатке.
+func (idx *InvertedIndex) Candidates(query map[string]int, fuzzy map[string]float64) []int {
+	seen := make(map[int]bool)
+	var result []int
+
+	add := func(term string) {
+		for docNum := range idx.postings[term] {
+			if !seen[docNum] {
+				seen[docNum] = true
+				result = append(result, docNum)
+			}
+		}
+	}
+
+	for term := range query {
+		add(term)
+	}
+	for term := range fuzzy {
+		add(term)
+	}
+
+	return result
+}
+
+func (idx *InvertedIndex) DocStats(docNum int) (DocStats, bool) {
+	stats, exists := idx.docs[docNum]
+	return stats, exists
+}
+
+func (idx *InvertedIndex) Corpus() CorpusStats {
+	stats := CorpusStats{
+		DocCount: len(idx.docs),
+		DocFreq:  idx.DocFreq,
+	}
+
+	if len(idx.docs) > 0 {
+		stats.AvgDocLen = float64(idx.totalLen) / float64(len(idx.docs))
+	}
+
+	return stats
+}
+
+func (idx *InvertedIndex) DocFreq(term string) int {
+	return len(idx.postings[term])
+}
+
+func (idx *InvertedIndex) VocabularySize() int {
+	return len(idx.postings)
+}
@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Metadata struct {
+	Source     string            `json:"source,omitempty"`
+	Collection string            `json:"collection,omitempty"`
+	AuthorID   int64             `json:"author_id,omitempty"`
+	ChatID     int64             `json:"chat_id,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Tags       []string          `json:"tags,omitempty"`
+	Language   string            `json:"language,omitempty"`
+	Extra      map[string]string `json:"extra,omitempty"`
+}
+
+func (m Metadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectLanguage грубо определяет язык текста по преобладающему алфавиту.
+func DetectLanguage(text string) string {
+	cyrillic, latin := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	switch {
+	case cyrillic == 0 && latin == 0:
+		return ""
+	case cyrillic >= latin:
+		return LanguageRussian
+	default:
+		return LanguageEnglish
+	}
+}
+
+// ExtractHashtags собирает #теги из текста без символа решётки.
+func ExtractHashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+
+		tag := strings.ToLower(strings.TrimFunc(word[1:], func(r rune) bool {
+			return !isWordRune(r)
+		}))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
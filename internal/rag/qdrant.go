@@ -0,0 +1,620 @@
+package rag
+
+import (
+	"GolangtgBot/internal/ai"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultQdrantURL        = "http://localhost:6333"
+	DefaultQdrantCollection = "knowledge"
+	DefaultQdrantTimeout    = 10 * time.Second
+
+	// qdrantBatchSize - точек в одном запросе на запись или чтение
+	qdrantBatchSize = 128
+	// qdrantMaxPages - сколько страниц выдачи просматривается, пока
+	// фильтры, которые Qdrant не проверяет сам, не наберут topK
+	qdrantMaxPages = 5
+)
+
+type QdrantOptions struct {
+	URL        string
+	APIKey     string
+	Collection string
+	Timeout    time.Duration
+}
+
+func (o QdrantOptions) withDefaults() QdrantOptions {
+	if o.URL == "" {
+		o.URL = DefaultQdrantURL
+	}
+	if o.Collection == "" {
+		o.Collection = DefaultQdrantCollection
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultQdrantTimeout
+	}
+	o.URL = strings.TrimRight(o.URL, "/")
+	return o
+}
+
+// QdrantStore хранит документы и векторы в коллекции Qdrant, а для
+// лексического поиска и работы с фрагментами держит копию документов
+// без векторов в памяти. Копия собирается из Qdrant при открытии, так
+// что локальный журнал не нужен. Изменения сначала записываются в
+// Qdrant и только после успешного ответа попадают в копию.
+type QdrantStore struct {
+	opts     QdrantOptions
+	client   *http.Client
+	embedder ai.Embedder
+	local    *VectorStore
+	mu       sync.Mutex
+}
+
+// qdrantPayload - документ в payload точки Qdrant. Collection и Tags
+// повторяют метаданные в том виде, в каком по ним фильтрует Qdrant:
+// коллекция с global вместо пустой, теги в нижнем регистре.
+type qdrantPayload struct {
+	DocID       string     `json:"doc_id"`
+	Content     string     `json:"content"`
+	Metadata    Metadata   `json:"metadata"`
+	Chunk       *ChunkInfo `json:"chunk,omitempty"`
+	VectorModel string     `json:"vector_model"`
+	Collection  string     `json:"collection"`
+	Tags        []string   `json:"tags,omitempty"`
+}
+
+func newQdrantPayload(doc Document) qdrantPayload {
+	tags := make([]string, len(doc.Metadata.Tags))
+	for i, tag := range doc.Metadata.Tags {
+		tags[i] = strings.ToLower(tag)
+	}
+
+	return qdrantPayload{
+		DocID:       doc.ID,
+		Content:     doc.Content,
+		Metadata:    doc.Metadata,
+		Chunk:       doc.Chunk,
+		VectorModel: doc.VectorModel,
+		Collection:  documentCollection(doc),
+		Tags:        tags,
+	}
+}
+
+type qdrantPoint struct {
+	ID      string        `json:"id"`
+	Vector  []float64     `json:"vector,omitempty"`
+	Payload qdrantPayload `json:"payload"`
+}
+
+type qdrantScoredPoint struct {
+	ID      string        `json:"id"`
+	Score   float64       `json:"score"`
+	Payload qdrantPayload `json:"payload"`
+}
+
+type qdrantCollectionInfo struct {
+	PointsCount int `json:"points_count"`
+	Config      struct {
+		Params struct {
+			Vectors struct {
+				Size     int    `json:"size"`
+				Distance string `json:"distance"`
+			} `json:"vectors"`
+		} `json:"params"`
+	} `json:"config"`
+}
+
+// QdrantError - ответ Qdrant с кодом ошибки.
+type QdrantError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *QdrantError) Error() string {
+	return fmt.Sprintf("qdrant: %d %s", e.StatusCode, e.Message)
+}
+
+// OpenQdrantStore подключается к Qdrant, создаёт коллекцию, если её нет,
+// и загружает документы в local. Векторы, посчитанные другим
+// эмбеддером, пересчитываются.
+func OpenQdrantStore(opts QdrantOptions, local *VectorStore, embedder ai.Embedder) (*QdrantStore, error) {
+	opts = opts.withDefaults()
+
+	store := &QdrantStore{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		embedder: embedder,
+		local:    local,
+	}
+
+	if err := store.ensureCollection(); err != nil {
+		return nil, err
+	}
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("ошибка загрузки документов из Qdrant: %v", err)
+	}
+
+	log.Printf("Загружено %d документов из Qdrant (%s, коллекция %s)", local.Len(), opts.URL, opts.Collection)
+	return store, nil
+}
+
+func (q *QdrantStore) ensureCollection() error {
+	probe, err := q.embedder.Embed([]string{"qdrant"})
+	if err != nil || len(probe) == 0 {
+		return fmt.Errorf("не удалось определить размер векторов: %v", err)
+	}
+	size := len(probe[0])
+
+	var info qdrantCollectionInfo
+	err = q.call(http.MethodGet, q.collectionPath(""), nil, &info)
+
+	var qdrantErr *QdrantError
+	if errors.As(err, &qdrantErr) && qdrantErr.StatusCode == http.StatusNotFound {
+		request := map[string]interface{}{
+			"vectors": map[string]interface{}{"size": size, "distance": "Cosine"},
+		}
+		if err := q.call(http.MethodPut, q.collectionPath(""), request, nil); err != nil {
+			return fmt.Errorf("не удалось создать коллекцию %s: %v", q.opts.Collection, err)
+		}
+		log.Printf("Создана коллекция Qdrant %s (%d измерений)", q.opts.Collection, size)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Qdrant недоступен: %v", err)
+	}
+
+	vectors := info.Config.Params.Vectors
+	if vectors.Size != size {
+		return fmt.Errorf("в коллекции %s векторы размера %d, а эмбеддер %s даёт %d",
+			q.opts.Collection, vectors.Size, q.embedder.Name(), size)
+	}
+	if vectors.Distance != "" && vectors.Distance != "Cosine" {
+		return fmt.Errorf("в коллекции %s метрика %s, нужна Cosine", q.opts.Collection, vectors.Distance)
+	}
+	return nil
+}
+
+// load читает все точки коллекции без векторов.
+func (q *QdrantStore) load() error {
+	var docs, stale []Document
+
+	var offset interface{}
+	for {
+		request := map[string]interface{}{
+			"limit":        qdrantBatchSize,
+			"with_payload": true,
+			"with_vector":  false,
+		}
+		if offset != nil {
+			request["offset"] = offset
+		}
+
+		var page struct {
+			Points         []qdrantPoint `json:"points"`
+			NextPageOffset interface{}   `json:"next_page_offset"`
+		}
+		if err := q.call(http.MethodPost, q.collectionPath("/points/scroll"), request, &page); err != nil {
+			return err
+		}
+
+		for _, point := range page.Points {
+			doc := point.Payload.document()
+			if doc.ID == "" {
+				continue
+			}
+			// Точки без полей для фильтра записаны до их появления
+			if doc.VectorModel != q.embedder.Name() || point.Payload.Collection == "" {
+				stale = append(stale, doc)
+				continue
+			}
+			docs = append(docs, doc)
+		}
+
+		if page.NextPageOffset == nil {
+			break
+		}
+		offset = page.NextPageOffset
+	}
+
+	if len(stale) > 0 {
+		embedDocuments(q.embedder, stale)
+
+		var embedded []Document
+		for _, doc := range stale {
+			if doc.Vector != nil {
+				embedded = append(embedded, doc)
+			}
+		}
+		if err := q.upsertPoints(embedded); err != nil {
+			return err
+		}
+		log.Printf("Пересчитаны векторы для %d из %d документов в Qdrant (%s)", len(embedded), len(stale), q.embedder.Name())
+		docs = append(docs, stale...)
+	}
+
+	q.local.prepare(docs)
+	q.local.commit(withoutVectors(docs))
+	return nil
+}
+
+func (p qdrantPayload) document() Document {
+	return Document{
+		ID:          p.DocID,
+		Content:     p.Content,
+		Metadata:    p.Metadata,
+		Chunk:       p.Chunk,
+		VectorModel: p.VectorModel,
+	}
+}
+
+// withoutVectors - копия документов для локального индекса: векторы
+// хранит Qdrant.
+func withoutVectors(docs []Document) []Document {
+	stripped := make([]Document, len(docs))
+	for i, doc := range docs {
+		doc.Vector = nil
+		stripped[i] = doc
+	}
+	return stripped
+}
+
+// qdrantPointID превращает ID документа в UUID (версия 5 по SHA-1):
+// Qdrant принимает в качестве ID только числа и UUID.
+func qdrantPointID(docID string) string {
+	sum := sha1.Sum([]byte(docID))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func (q *QdrantStore) AddDocuments(docs []Document) ([]string, error) {
+	if err := q.prepare(docs); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.upsertPoints(docs); err != nil {
+		return nil, err
+	}
+	return q.local.commit(withoutVectors(docs)), nil
+}
+
+// prepare назначает ID и считает векторы. Документ без вектора в Qdrant
+// не записать, поэтому ошибка эмбеддера прерывает добавление.
+func (q *QdrantStore) prepare(docs []Document) error {
+	q.local.prepare(docs)
+	embedMissing(q.embedder, docs)
+
+	for _, doc := range docs {
+		if doc.Vector == nil {
+			return fmt.Errorf("не удалось посчитать вектор документа %s", doc.ID)
+		}
+	}
+	return nil
+}
+
+func (q *QdrantStore) ReplaceDocument(id string, docs []Document) error {
+	if err := q.prepare(docs); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	previous := q.local.groupIDs(id)
+	if len(previous) == 0 {
+		return fmt.Errorf("документ %s не найден", id)
+	}
+
+	if err := q.upsertPoints(docs); err != nil {
+		return err
+	}
+
+	kept := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		kept[doc.ID] = true
+	}
+	var removed []string
+	for _, previousID := range previous {
+		if !kept[previousID] {
+			removed = append(removed, previousID)
+		}
+	}
+	if err := q.deletePoints(removed); err != nil {
+		return err
+	}
+
+	return q.local.replace(id, withoutVectors(docs))
+}
+
+func (q *QdrantStore) DeleteDocument(id string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := q.local.groupIDs(id)
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("документ %s не найден", id)
+	}
+
+	if err := q.deletePoints(ids); err != nil {
+		return 0, err
+	}
+	return q.local.DeleteDocument(id)
+}
+
+func (q *QdrantStore) DeleteWhere(filter Filter) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var ids []string
+	for _, doc := range q.local.Documents() {
+		if filter.Match(doc) {
+			ids = append(ids, doc.ID)
+		}
+	}
+
+	if err := q.deletePoints(ids); err != nil {
+		return 0, err
+	}
+	return q.local.DeleteWhere(filter)
+}
+
+func (q *QdrantStore) upsertPoints(docs []Document) error {
+	for start := 0; start < len(docs); start += qdrantBatchSize {
+		end := min(start+qdrantBatchSize, len(docs))
+
+		points := make([]qdrantPoint, 0, end-start)
+		for _, doc := range docs[start:end] {
+			points = append(points, qdrantPoint{
+				ID:      qdrantPointID(doc.ID),
+				Vector:  doc.Vector,
+				Payload: newQdrantPayload(doc),
+			})
+		}
+
+		request := map[string]interface{}{"points": points}
+		if err := q.call(http.MethodPut, q.collectionPath("/points?wait=true"), request, nil); err != nil {
+			return fmt.Errorf("ошибка записи в Qdrant: %v", err)
+		}
+	}
+	return nil
+}
+
+func (q *QdrantStore) deletePoints(ids []string) error {
+	for start := 0; start < len(ids); start += qdrantBatchSize {
+		end := min(start+qdrantBatchSize, len(ids))
+
+		points := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			points = append(points, qdrantPointID(id))
+		}
+
+		request := map[string]interface{}{"points": points}
+		if err := q.call(http.MethodPost, q.collectionPath("/points/delete?wait=true"), request, nil); err != nil {
+			return fmt.Errorf("ошибка удаления из Qdrant: %v", err)
+		}
+	}
+	return nil
+}
+
+// SearchDense ищет ближайшие векторы в Qdrant. Фильтры по коллекции и
+// тегам Qdrant проверяет сам, остальные проверяются по локальной копии
+// документов: тогда выдача запрашивается страницами, пока не наберётся
+// topK, но не больше qdrantMaxPages страниц.
+func (q *QdrantStore) SearchDense(query string, topK int, filters ...Filter) []SearchHit {
+	vectors, err := q.embedder.Embed([]string{query})
+	if err != nil || len(vectors) == 0 {
+		log.Printf("Ошибка расчёта эмбеддинга запроса: %v", err)
+		return []SearchHit{}
+	}
+	queryVector := normalizeVector(vectors[0])
+
+	payloadFilter, exact := qdrantFilter(filters)
+
+	limit := topK
+	if !exact {
+		limit = topK * 4
+	}
+
+	hits := make([]SearchHit, 0, topK)
+	for page := 0; page < qdrantMaxPages && len(hits) < topK; page++ {
+		request := map[string]interface{}{
+			"vector":       queryVector,
+			"limit":        limit,
+			"offset":       page * limit,
+			"with_payload": []string{"doc_id"},
+		}
+		if payloadFilter != nil {
+			request["filter"] = payloadFilter
+		}
+
+		var points []qdrantScoredPoint
+		if err := q.call(http.MethodPost, q.collectionPath("/points/search"), request, &points); err != nil {
+			log.Printf("Ошибка поиска в Qdrant: %v", err)
+			break
+		}
+
+		for _, point := range points {
+			if point.Score <= 0 || len(hits) == topK {
+				break
+			}
+			doc, found := q.local.Get(point.Payload.DocID)
+			if !found || !matchAll(doc, filters) {
+				continue
+			}
+			hits = append(hits, SearchHit{
+				Document:   doc,
+				Score:      point.Score,
+				Retrievers: map[string]float64{RetrieverDense: point.Score},
+			})
+		}
+
+		if len(points) < limit || points[len(points)-1].Score <= 0 {
+			break
+		}
+	}
+
+	q.local.attachSnippets(query, hits)
+	return hits
+}
+
+// qdrantFilter переводит фильтры по коллекции и тегам, в том числе
+// внутри and, в фильтр payload Qdrant. exact - все фильтры переведены и
+// проверять по локальной копии нечего.
+func qdrantFilter(filters []Filter) (filter map[string]interface{}, exact bool) {
+	var must []interface{}
+	exact = true
+
+	var collect func(filters []Filter)
+	collect = func(filters []Filter) {
+		for _, f := range filters {
+			switch f := f.(type) {
+			case nil:
+			case fieldFilter:
+				must = append(must, map[string]interface{}{
+					"key":   f.field,
+					"match": map[string]interface{}{"any": f.values},
+				})
+			case allOf:
+				collect(f)
+			default:
+				exact = false
+			}
+		}
+	}
+	collect(filters)
+
+	if len(must) == 0 {
+		return nil, exact
+	}
+	return map[string]interface{}{"must": must}, exact
+}
+
+func (q *QdrantStore) SearchLexical(query string, topK int, filters ...Filter) []SearchHit {
+	return q.local.SearchLexical(query, topK, filters...)
+}
+
+func (q *QdrantStore) Get(id string) (Document, bool) {
+	return q.local.Get(id)
+}
+
+func (q *QdrantStore) Chunks(parentID string) []Document {
+	return q.local.Chunks(parentID)
+}
+
+func (q *QdrantStore) Documents() []Document {
+	return q.local.Documents()
+}
+
+func (q *QdrantStore) ExpandChunk(doc Document, window int) Document {
+	return q.local.ExpandChunk(doc, window)
+}
+
+func (q *QdrantStore) FindDuplicates(content string, threshold float64, filters ...Filter) []Duplicate {
+	return q.local.FindDuplicates(content, threshold, filters...)
+}
+
+func (q *QdrantStore) DuplicateClusters(threshold float64) [][]string {
+	return q.local.DuplicateClusters(threshold)
+}
+
+func (q *QdrantStore) Len() int {
+	return q.local.Len()
+}
+
+// Snapshot ничего не делает: Qdrant сохраняет данные сам.
+func (q *QdrantStore) Snapshot() {}
+
+func (q *QdrantStore) GetStats() map[string]interface{} {
+	stats := q.local.GetStats()
+	stats["backend"] = fmt.Sprintf("%s (%s)", BackendQdrant, q.opts.Collection)
+	stats["embedder"] = q.embedder.Name()
+
+	var info qdrantCollectionInfo
+	if err := q.call(http.MethodGet, q.collectionPath(""), nil, &info); err != nil {
+		log.Printf("Ошибка запроса статистики Qdrant: %v", err)
+		stats["embedded"] = 0
+	} else {
+		stats["embedded"] = info.PointsCount
+	}
+	return stats
+}
+
+func (q *QdrantStore) collectionPath(suffix string) string {
+	return "/collections/" + url.PathEscape(q.opts.Collection) + suffix
+}
+
+// call выполняет запрос к REST API Qdrant и разбирает поле result ответа.
+func (q *QdrantStore) call(method, path string, request, result interface{}) error {
+	var body io.Reader
+	if request != nil {
+		jsonData, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("не удалось составить запрос: %v", err)
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequest(method, q.opts.URL+path, body)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании запроса: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if q.opts.APIKey != "" {
+		req.Header.Set("api-key", q.opts.APIKey)
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка отправления запроса: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа: %v", err)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Status json.RawMessage `json:"status"`
+	}
+	decodeErr := json.Unmarshal(data, &response)
+
+	if resp.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(data))
+		var status struct {
+			Error string `json:"error"`
+		}
+		if decodeErr == nil && json.Unmarshal(response.Status, &status) == nil && status.Error != "" {
+			message = status.Error
+		}
+		return &QdrantError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if decodeErr != nil {
+		return fmt.Errorf("ошибка разбора ответа: %v", decodeErr)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("ошибка разбора ответа: %v", err)
+	}
+	return nil
+}
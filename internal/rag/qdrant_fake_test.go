@@ -0,0 +1,393 @@
+package rag_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeQdrant - минимальная реализация REST API Qdrant в памяти:
+// коллекции с косинусной метрикой, upsert, delete, scroll и search с
+// фильтром по payload.
+type fakeQdrant struct {
+	*httptest.Server
+
+	apiKey      string
+	mu          sync.Mutex
+	collections map[string]*fakeCollection
+}
+
+type fakeCollection struct {
+	size   int
+	points map[string]fakePoint
+}
+
+type fakePoint struct {
+	vector  []float64
+	payload map[string]json.RawMessage
+}
+
+// newFakeQdrant запускает заменитель Qdrant. Если apiKey не пустой,
+// запросы без заголовка api-key отклоняются.
+func newFakeQdrant(apiKey string) *fakeQdrant {
+	server := &fakeQdrant{
+		apiKey:      apiKey,
+		collections: make(map[string]*fakeCollection),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections/{name}", server.getCollection)
+	mux.HandleFunc("PUT /collections/{name}", server.createCollection)
+	mux.HandleFunc("DELETE /collections/{name}", server.deleteCollection)
+	mux.HandleFunc("PUT /collections/{name}/points", server.upsertPoints)
+	mux.HandleFunc("POST /collections/{name}/points/delete", server.deletePoints)
+	mux.HandleFunc("POST /collections/{name}/points/scroll", server.scrollPoints)
+	mux.HandleFunc("POST /collections/{name}/points/search", server.searchPoints)
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.apiKey != "" && r.Header.Get("api-key") != server.apiKey {
+			writeError(w, http.StatusUnauthorized, "Invalid api-key")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+
+	return server
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "status": "ok", "time": 0})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": map[string]string{"error": message}, "time": 0})
+}
+
+// collection вызывается под блокировкой s.mu
+func (s *fakeQdrant) collection(w http.ResponseWriter, r *http.Request) (*fakeCollection, bool) {
+	name := r.PathValue("name")
+	collection, found := s.collections[name]
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Not found: Collection `%s` doesn't exist!", name))
+	}
+	return collection, found
+}
+
+func decode(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, "Format error in JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *fakeQdrant) getCollection(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, found := s.collection(w, r)
+	if !found {
+		return
+	}
+
+	writeResult(w, map[string]interface{}{
+		"status":       "green",
+		"points_count": len(collection.points),
+		"config": map[string]interface{}{
+			"params": map[string]interface{}{
+				"vectors": map[string]interface{}{"size": collection.size, "distance": "Cosine"},
+			},
+		},
+	})
+}
+
+func (s *fakeQdrant) createCollection(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Vectors struct {
+			Size     int    `json:"size"`
+			Distance string `json:"distance"`
+		} `json:"vectors"`
+	}
+	if !decode(w, r, &request) {
+		return
+	}
+	if request.Vectors.Size <= 0 || request.Vectors.Distance != "Cosine" {
+		writeError(w, http.StatusBadRequest, "Wrong input: only Cosine vectors are supported")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := r.PathValue("name")
+	if _, exists := s.collections[name]; exists {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Wrong input: Collection `%s` already exists!", name))
+		return
+	}
+
+	s.collections[name] = &fakeCollection{size: request.Vectors.Size, points: make(map[string]fakePoint)}
+	writeResult(w, true)
+}
+
+func (s *fakeQdrant) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, found := s.collections[r.PathValue("name")]
+	delete(s.collections, r.PathValue("name"))
+	writeResult(w, found)
+}
+
+func (s *fakeQdrant) upsertPoints(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Points []struct {
+			ID      string                     `json:"id"`
+			Vector  []float64                  `json:"vector"`
+			Payload map[string]json.RawMessage `json:"payload"`
+		} `json:"points"`
+	}
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, found := s.collection(w, r)
+	if !found {
+		return
+	}
+
+	for _, point := range request.Points {
+		if len(point.Vector) != collection.size {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Wrong input: Vector dimension error: expected dim: %d, got %d", collection.size, len(point.Vector)))
+			return
+		}
+	}
+
+	for _, point := range request.Points {
+		collection.points[point.ID] = fakePoint{vector: normalize(point.Vector), payload: point.Payload}
+	}
+	writeResult(w, map[string]interface{}{"operation_id": 0, "status": "completed"})
+}
+
+func (s *fakeQdrant) deletePoints(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Points []string `json:"points"`
+	}
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, found := s.collection(w, r)
+	if !found {
+		return
+	}
+
+	for _, id := range request.Points {
+		delete(collection.points, id)
+	}
+	writeResult(w, map[string]interface{}{"operation_id": 0, "status": "completed"})
+}
+
+func (s *fakeQdrant) scrollPoints(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Limit       int             `json:"limit"`
+		Offset      *string         `json:"offset"`
+		WithPayload json.RawMessage `json:"with_payload"`
+		WithVector  bool            `json:"with_vector"`
+	}
+	if !decode(w, r, &request) {
+		return
+	}
+	if request.Limit <= 0 {
+		request.Limit = 10
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, found := s.collection(w, r)
+	if !found {
+		return
+	}
+
+	ids := make([]string, 0, len(collection.points))
+	for id := range collection.points {
+		if request.Offset == nil || id >= *request.Offset {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var next interface{}
+	if len(ids) > request.Limit {
+		next = ids[request.Limit]
+		ids = ids[:request.Limit]
+	}
+
+	points := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		point := collection.points[id]
+		record := map[string]interface{}{
+			"id":      id,
+			"payload": selectPayload(point.payload, request.WithPayload),
+		}
+		if request.WithVector {
+			record["vector"] = point.vector
+		}
+		points = append(points, record)
+	}
+
+	writeResult(w, map[string]interface{}{"points": points, "next_page_offset": next})
+}
+
+func (s *fakeQdrant) searchPoints(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Vector      []float64       `json:"vector"`
+		Limit       int             `json:"limit"`
+		Offset      int             `json:"offset"`
+		WithPayload json.RawMessage `json:"with_payload"`
+		Filter      *fakeFilter     `json:"filter"`
+	}
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, found := s.collection(w, r)
+	if !found {
+		return
+	}
+	if len(request.Vector) != collection.size {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Wrong input: Vector dimension error: expected dim: %d, got %d", collection.size, len(request.Vector)))
+		return
+	}
+
+	type scored struct {
+		id    string
+		score float64
+	}
+	query := normalize(request.Vector)
+	results := make([]scored, 0, len(collection.points))
+	for id, point := range collection.points {
+		if !request.Filter.match(point.payload) {
+			continue
+		}
+		score := 0.0
+		for i := range query {
+			score += query[i] * point.vector[i]
+		}
+		results = append(results, scored{id: id, score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].id < results[j].id
+	})
+
+	start := min(request.Offset, len(results))
+	end := min(start+request.Limit, len(results))
+
+	points := make([]map[string]interface{}, 0, end-start)
+	for _, result := range results[start:end] {
+		points = append(points, map[string]interface{}{
+			"id":      result.id,
+			"version": 0,
+			"score":   result.score,
+			"payload": selectPayload(collection.points[result.id].payload, request.WithPayload),
+		})
+	}
+	writeResult(w, points)
+}
+
+// fakeFilter - фильтр payload из условий must с match.any.
+type fakeFilter struct {
+	Must []struct {
+		Key   string `json:"key"`
+		Match struct {
+			Any []string `json:"any"`
+		} `json:"match"`
+	} `json:"must"`
+}
+
+// match проверяет, что каждое поле payload - строка или массив строк -
+// содержит одно из значений условия.
+func (f *fakeFilter) match(payload map[string]json.RawMessage) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, condition := range f.Must {
+		var values []string
+		var value string
+		if json.Unmarshal(payload[condition.Key], &value) == nil {
+			values = []string{value}
+		} else {
+			json.Unmarshal(payload[condition.Key], &values)
+		}
+
+		found := false
+		for _, want := range condition.Match.Any {
+			for _, value := range values {
+				found = found || value == want
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// selectPayload отдаёт payload целиком (with_payload: true), ничего или
+// только перечисленные поля.
+func selectPayload(payload map[string]json.RawMessage, selector json.RawMessage) map[string]json.RawMessage {
+	var fields []string
+	if json.Unmarshal(selector, &fields) == nil {
+		selected := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, found := payload[field]; found {
+				selected[field] = value
+			}
+		}
+		return selected
+	}
+
+	if include, err := strconv.ParseBool(strings.TrimSpace(string(selector))); err == nil && include {
+		return payload
+	}
+	return nil
+}
+
+func normalize(vector []float64) []float64 {
+	var norm float64
+	for _, value := range vector {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+
+	normalized := make([]float64, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+	for i, value := range vector {
+		normalized[i] = value / norm
+	}
+	return normalized
+}
@@ -1,57 +1,541 @@
 package rag
 
 import (
+	"GolangtgBot/internal/ai"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 )
 
+type Options struct {
+	StoragePath      string
+	SnapshotInterval time.Duration
+	SnapshotEvery    int
+
+	Scorer string
+	BM25K1 float64
+	BM25B  float64
+
+	Languages []string
+	Stemming  bool
+	Fuzzy     FuzzyOptions
+
+	Chunking    ChunkOptions
+	ChunkExpand int
+	Context     ContextOptions
+	Snippets    SnippetOptions
+	Dedup       DedupOptions
+
+	Embedder   ai.Embedder
+	Retrieval  RetrievalOptions
+	DenseIndex string
+	HNSW       HNSWOptions
+
+	// Backend - где хранятся документы: memory или qdrant
+	Backend string
+	Qdrant  QdrantOptions
+
+	LLM     ai.AIClient
+	Rerank  RerankOptions
+	Rewrite RewriteOptions
+
+	// Conversation - поиск с учётом истории диалога
+	Conversation ConversationOptions
+	// Feedback - как оценки ответов влияют на выдачу
+	Feedback FeedbackOptions
+
+	// Seed - файлы, которые загружаются в базу при запуске
+	Seed SeedOptions
+
+	// Debug - писать в лог каждую выдачу поиска с баллами
+	Debug bool
+}
+
 type RAGPipeline struct {
-	vectorStore *VectorStore
+	store        DocumentStore
+	chunker      *Chunker
+	chunkExpand  int
+	context      ContextOptions
+	snippets     SnippetOptions
+	dedup        DedupOptions
+	retrieval    RetrievalOptions
+	reranker     *Reranker
+	rewriter     *QueryRewriter
+	conversation ConversationOptions
+	tokenizer    Tokenizer
+	collections  *Collections
+	feedback     *FeedbackStore
+	seeder       *seeder
+	debug        bool
 }
 
-func NewRAGPipeline() *RAGPipeline {
+func NewRAGPipeline(opts Options) (*RAGPipeline, error) {
+	chunker, err := NewChunker(opts.Chunking)
+	if err != nil {
+		return nil, err
+	}
+
+	retrieval, err := opts.Retrieval.validate()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Embedder == nil && retrieval.Mode != RetrievalLexical {
+		log.Println("Эмбеддер не настроен, используется только лексический поиск")
+		retrieval.Mode = RetrievalLexical
+	}
+
+	dedup, err := opts.Dedup.validate()
+	if err != nil {
+		return nil, err
+	}
+
 	pipeline := &RAGPipeline{
-		vectorStore: NewVectorStore(),
+		chunker:      chunker,
+		chunkExpand:  opts.ChunkExpand,
+		context:      opts.Context,
+		snippets:     opts.Snippets,
+		dedup:        dedup,
+		retrieval:    retrieval,
+		conversation: opts.Conversation.withDefaults(),
+		tokenizer:    newTokenizer(opts),
+		debug:        opts.Debug,
 	}
 
-	pipeline.vectorStore.LoadSampleData()
+	pipeline.context.checkBudget()
 
-	return pipeline
+	pipeline.collections, err = OpenCollections(opts.StoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline.feedback, err = OpenFeedback(opts.StoragePath, opts.Feedback)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline.store, err = OpenStore(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.LLM != nil && opts.Rerank.Mode != "" && opts.Rerank.Mode != RerankOff {
+		reranker, err := NewReranker(opts.LLM, opts.Rerank)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.reranker = reranker
+	}
+
+	if opts.LLM != nil && (opts.Rewrite.Enabled || opts.Rewrite.HyDE) {
+		pipeline.rewriter = NewQueryRewriter(opts.LLM, opts.Rewrite)
+	}
+
+	pipeline.removeLegacySamples()
+
+	if len(opts.Seed.Paths) > 0 {
+		pipeline.seeder, err = newSeeder(pipeline, opts.Seed)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Seed()
+		pipeline.seeder.watch()
+	}
+
+	return pipeline, nil
 }
 
-func (p *RAGPipeline) ProcessQuery(question string) (string, []Document) {
+func (p *RAGPipeline) ProcessQuery(question string, filters ...Filter) (string, []SearchHit, ContextReport) {
+	return p.ProcessConversation(question, nil, filters...)
+}
 
-	similarDocs := p.vectorStore.SearchSimilar(question, 5)
+// ProcessConversation - то же, что ProcessQuery, но с историей диалога:
+// по ней переписывается вопрос и ищутся документы, см.
+// ConversationOptions. Найденные источники пронумерованы по Rank так
+// же, как в контексте для модели. ContextReport говорит, какие из них
+// пришлось обрезать или отбросить, чтобы уложиться в бюджет.
+func (p *RAGPipeline) ProcessConversation(question string, history []Turn, filters ...Filter) (string, []SearchHit, ContextReport) {
+	query := Query{Original: question, Text: question, DenseText: question}
+	if p.rewriter != nil {
+		query = p.rewriter.Rewrite(question, history)
+	}
+
+	var hits []SearchHit
+	if p.reranker != nil {
+		hits = p.reranker.Rerank(query.Text, p.retrieveConversation(query, history, p.reranker.Candidates(), filters))
+	} else {
+		hits = p.retrieveConversation(query, history, 5, filters)
+	}
+
+	if len(hits) == 0 {
+		return "", hits, ContextReport{}
+	}
 
-	if len(similarDocs) == 0 {
-		return "", similarDocs
+	// Выдержки и так вокруг совпадений, соседние фрагменты к ним не нужны
+	if p.snippets.Context {
+		hits = snippetContext(hits)
+	} else {
+		hits = p.expandChunks(hits)
 	}
 
-	context := p.buildContext(similarDocs)
+	hits, report := fitBudget(hits, p.context.contextBudget(question))
+	hits = rankHits(hits)
 
-	return context, similarDocs
+	if len(report.Trimmed) > 0 || len(report.Dropped) > 0 {
+		log.Printf("RAG: контекст %d из %d токенов, обрезаны: %v, не поместились: %v",
+			report.Used, report.Budget, report.Trimmed, report.Dropped)
+	}
+
+	context := p.buildContext(hits)
+
+	return context, hits, report
 }
 
-func (p *RAGPipeline) buildContext(docs []Document) string {
-	if len(docs) == 0 {
+const (
+	contextHeader = "Источники для ответа:\n\n"
+	contextFooter = "Используй эту информацию для формирования ответа. " +
+		"Указывай номера источников, на которые опираешься, в квадратных скобках, например [1] или [2][3]."
+	answerPromptFormat = "%s\n\nНа основе контекста выше, ответь на вопрос: %s\n\nБудь кратким и информативным. " +
+		"Если в контексте нет точного ответа, используй свои знания."
+)
+
+// AnswerPrompt - промпт для модели из контекста ProcessConversation и
+// вопроса. По нему же считается бюджет контекста.
+func AnswerPrompt(context, question string) string {
+	return fmt.Sprintf(answerPromptFormat, context, question)
+}
+
+func (p *RAGPipeline) buildContext(hits []SearchHit) string {
+	if len(hits) == 0 {
 		return ""
 	}
 
 	var contextBuilder strings.Builder
-	contextBuilder.WriteString("Контекст для ответа:\n\n")
+	contextBuilder.WriteString(contextHeader)
 
-	for _, doc := range docs {
-		contextBuilder.WriteString(fmt.Sprintf("- %s\n", doc.Content))
+	for _, hit := range hits {
+		contextBuilder.WriteString(fmt.Sprintf("[%d] %s\n\n", hit.Rank, hit.Document.Content))
 	}
 
-	contextBuilder.WriteString("\nИспользуй эту информацию для формирования ответа.")
+	contextBuilder.WriteString(contextFooter)
 	return contextBuilder.String()
 }
 
-func (p *RAGPipeline) AddDocument(content string) string {
-	return p.vectorStore.AddDocument(content)
+// Retrieve находит topK документов лексическим, векторным или
+// гибридным поиском в зависимости от настроек.
+func (p *RAGPipeline) Retrieve(question string, topK int, filters ...Filter) []SearchHit {
+	return p.retrieve(Query{Original: question, Text: question, DenseText: question}, topK, filters)
+}
+
+// retrieve при оценках в журнале берёт вдвое больше кандидатов, чтобы
+// поднятые оценками документы могли попасть в topK.
+func (p *RAGPipeline) retrieve(query Query, topK int, filters []Filter) []SearchHit {
+	var hits []SearchHit
+
+	candidates := topK
+	if p.feedback.active() {
+		candidates = topK * 2
+	}
+
+	switch p.retrieval.Mode {
+	case RetrievalLexical:
+		hits = p.store.SearchLexical(query.Text, candidates, filters...)
+	case RetrievalDense:
+		hits = withMinScore(p.store.SearchDense(query.DenseText, candidates, filters...), p.retrieval.DenseMinScore)
+	default:
+		hits = hybridSearch(p.store, query, candidates, p.retrieval, filters)
+	}
+
+	hits = p.feedback.adjust(hits)
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+
+	p.logHits("RAG:", hits)
+
+	return hits
+}
+
+// logHits пишет выдачу в лог, только в режиме отладки: в лог попадают
+// ID документов на каждый вопрос.
+func (p *RAGPipeline) logHits(label string, hits []SearchHit) {
+	if !p.debug {
+		return
+	}
+	for _, hit := range hits {
+		log.Printf("%s %s score=%.4f %v", label, hit.Document.ID, hit.Score, hit.Retrievers)
+	}
+}
+
+// expandChunks заменяет найденные фрагменты окружающим текстом. Если
+// несколько фрагментов одного документа попали в выдачу, остаётся
+// только первый - его окно и так включает соседей.
+func (p *RAGPipeline) expandChunks(hits []SearchHit) []SearchHit {
+	if p.chunkExpand == 0 {
+		return hits
+	}
+
+	seenParents := make(map[string]bool)
+	result := make([]SearchHit, 0, len(hits))
+
+	for _, hit := range hits {
+		if chunk := hit.Document.Chunk; chunk != nil {
+			if seenParents[chunk.ParentID] {
+				continue
+			}
+			seenParents[chunk.ParentID] = true
+		}
+		hit.Document = p.store.ExpandChunk(hit.Document, p.chunkExpand)
+		result = append(result, hit)
+	}
+
+	return result
+}
+
+// AddResult - итог добавления: ID документа, число записей и похожий
+// документ, если он нашёлся.
+type AddResult struct {
+	ID        string
+	Chunks    int
+	Duplicate *Duplicate
+	Merged    bool
+}
+
+// AddDocument разбивает длинный текст на фрагменты и сохраняет его.
+// Почти точные копии в той же коллекции обрабатываются по политике
+// дубликатов: reject возвращает *DuplicateError с ID существующего
+// документа, merge дополняет существующий документ того же автора, link
+// и merge для чужого документа сохраняют новый со ссылкой на существующий.
+func (p *RAGPipeline) AddDocument(content string, meta Metadata) (AddResult, error) {
+	return p.add(Document{Content: content, Metadata: meta})
+}
+
+// add проверяет документ на дубликаты по политике дедупликации и
+// добавляет его, разбив на фрагменты. ID документа сохраняется.
+func (p *RAGPipeline) add(doc Document) (AddResult, error) {
+	content, meta := doc.Content, doc.Metadata
+	if meta.Language == "" {
+		meta.Language = DetectLanguage(content)
+	}
+
+	var result AddResult
+
+	if p.dedup.Policy != DedupOff {
+		collection := documentCollection(Document{Metadata: meta})
+		if duplicates := p.store.FindDuplicates(content, p.dedup.Threshold, InCollections(collection)); len(duplicates) > 0 {
+			duplicate := duplicates[0]
+			result.Duplicate = &duplicate
+
+			policy := p.dedup.Policy
+			if policy == DedupMerge && !p.sameAuthor(duplicate.ID, meta) {
+				// Чужой документ не меняется: новый сохраняется со ссылкой на него
+				policy = DedupLink
+			}
+			log.Printf("RAG: найден похожий документ %s (%.2f), политика %s", duplicate.ID, duplicate.Similarity, policy)
+
+			switch policy {
+			case DedupReject:
+				result.ID = duplicate.ID
+				return result, &DuplicateError{Duplicate: duplicate}
+
+			case DedupMerge:
+				chunks, err := p.mergeDocument(duplicate.ID, content, meta)
+				result.ID, result.Chunks, result.Merged = duplicate.ID, chunks, true
+				return result, err
+
+			case DedupLink:
+				extra := make(map[string]string, len(meta.Extra)+1)
+				for key, value := range meta.Extra {
+					extra[key] = value
+				}
+				extra["duplicate_of"] = duplicate.ID
+				meta.Extra = extra
+			}
+		}
+	}
+
+	if doc.ID == "" {
+		doc.ID = NewDocumentID()
+	}
+	doc.Metadata = meta
+
+	docs := p.splitDocument(doc)
+	if _, err := p.store.AddDocuments(docs); err != nil {
+		return result, err
+	}
+
+	result.ID, result.Chunks = doc.ID, len(docs)
+	return result, nil
+}
+
+// sameAuthor - добавлен ли документ id тем же автором, что и meta.
+func (p *RAGPipeline) sameAuthor(id string, meta Metadata) bool {
+	existing, found := p.GetDocument(id)
+	return found && existing.Metadata.AuthorID == meta.AuthorID
+}
+
+// mergeDocument объединяет новый текст с существующим документом: теги
+// складываются, а текст остаётся более полный из двух.
+func (p *RAGPipeline) mergeDocument(id, content string, meta Metadata) (int, error) {
+	existing, found := p.GetDocument(id)
+	if !found {
+		return 0, fmt.Errorf("документ %s не найден", id)
+	}
+
+	merged := existing.Metadata
+	for _, tag := range meta.Tags {
+		if !merged.HasTag(tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+
+	text := existing.Content
+	if len([]rune(content)) > len([]rune(text)) {
+		text = content
+		merged.Language = meta.Language
+	}
+
+	docs := p.splitDocument(Document{ID: existing.ID, Content: text, Metadata: merged})
+	if err := p.store.ReplaceDocument(existing.ID, docs); err != nil {
+		return 0, err
+	}
+
+	return len(docs), nil
+}
+
+// AddDocuments добавляет пачку документов с заданными ID (без ID -
+// новый ULID), разбивая каждый на фрагменты. Возвращает число записей.
+func (p *RAGPipeline) AddDocuments(docs []Document) (int, error) {
+	var records []Document
+	for _, doc := range docs {
+		if doc.ID == "" {
+			doc.ID = NewDocumentID()
+		}
+		if doc.Metadata.Language == "" {
+			doc.Metadata.Language = DetectLanguage(doc.Content)
+		}
+		records = append(records, p.splitDocument(doc)...)
+	}
+
+	if _, err := p.store.AddDocuments(records); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+func (p *RAGPipeline) splitDocument(doc Document) []Document {
+	chunks := p.chunker.Split(doc.Content)
+	if len(chunks) <= 1 {
+		return []Document{doc}
+	}
+	return ChunkDocuments(doc.ID, chunks, doc.Metadata)
+}
+
+// AddFile извлекает текст из загруженного файла и добавляет его как
+// один документ, который чанкер разобьёт на фрагменты.
+func (p *RAGPipeline) AddFile(filename, mimeType string, data []byte, meta Metadata) (AddResult, error) {
+	content, err := ExtractText(filename, mimeType, data)
+	if err != nil {
+		return AddResult{}, err
+	}
+
+	if meta.Source == "" {
+		meta.Source = "file"
+	}
+	if meta.Extra == nil {
+		meta.Extra = make(map[string]string)
+	}
+	meta.Extra["filename"] = filename
+	meta.Extra["format"] = DetectFormat(filename, mimeType)
+
+	return p.AddDocument(content, meta)
+}
+
+// GetDocument находит документ по ID. Для ID фрагмента возвращается
+// исходный документ, собранный из всех фрагментов.
+func (p *RAGPipeline) GetDocument(id string) (Document, bool) {
+	parentID := p.resolveParentID(id)
+
+	if chunks := p.store.Chunks(parentID); len(chunks) > 0 {
+		doc := p.store.ExpandChunk(chunks[0], -1)
+		doc.ID = parentID
+		doc.Chunk = nil
+		return doc, true
+	}
+
+	return p.store.Get(parentID)
+}
+
+// UpdateDocument заменяет текст документа, сохраняя его ID и метаданные.
+// Текст заново разбивается на фрагменты.
+func (p *RAGPipeline) UpdateDocument(id, content string) (int, error) {
+	existing, found := p.GetDocument(id)
+	if !found {
+		return 0, fmt.Errorf("документ %s не найден", id)
+	}
+
+	meta := existing.Metadata
+	meta.Language = DetectLanguage(content)
+
+	docs := p.splitDocument(Document{ID: existing.ID, Content: content, Metadata: meta})
+
+	if err := p.store.ReplaceDocument(existing.ID, docs); err != nil {
+		return 0, err
+	}
+
+	return len(docs), nil
+}
+
+// DeleteDocument удаляет документ вместе со всеми фрагментами.
+func (p *RAGPipeline) DeleteDocument(id string) (int, error) {
+	return p.store.DeleteDocument(p.resolveParentID(id))
+}
+
+func (p *RAGPipeline) resolveParentID(id string) string {
+	if doc, found := p.store.Get(id); found && doc.Chunk != nil {
+		return doc.Chunk.ParentID
+	}
+	return id
+}
+
+// DuplicateClusters возвращает группы почти одинаковых документов.
+func (p *RAGPipeline) DuplicateClusters() [][]string {
+	threshold := p.dedup.Threshold
+	if threshold <= 0 {
+		threshold = DefaultDedupThreshold
+	}
+	return p.store.DuplicateClusters(threshold)
+}
+
+func (p *RAGPipeline) Collections() *Collections {
+	return p.collections
+}
+
+func (p *RAGPipeline) Feedback() *FeedbackStore {
+	return p.feedback
+}
+
+// DropCollection удаляет все документы коллекции, а созданную коллекцию
+// ещё и из реестра. Коллекции по умолчанию только очищаются.
+func (p *RAGPipeline) DropCollection(collection Collection) (int, error) {
+	removed, err := p.store.DeleteWhere(InCollections(collection.Name))
+	if err != nil {
+		return removed, err
+	}
+
+	if !collection.IsDefault() {
+		if err := p.collections.Remove(collection.Name); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+func (p *RAGPipeline) Snapshot() {
+	p.store.Snapshot()
 }
 
 func (p *RAGPipeline) GetStats() map[string]interface{} {
-	return p.vectorStore.GetStats()
+	return p.store.GetStats()
 }
@@ -0,0 +1,306 @@
+package rag
+
+import (
+	"GolangtgBot/internal/ai"
+	"container/list"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RerankOff       = "off"
+	RerankListwise  = "listwise"
+	RerankPointwise = "pointwise"
+
+	RetrieverRerank = "rerank"
+
+	rerankPassageLimit = 400
+	rerankParallelism  = 4
+)
+
+var numberRegexp = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+
+type RerankOptions struct {
+	Mode       string
+	Candidates int
+	TopN       int
+	Timeout    time.Duration
+	CacheSize  int
+}
+
+// Reranker переупорядочивает кандидатов с помощью LLM. Если модель не
+// уложилась в Timeout или ответила непонятно, остаётся исходный порядок.
+type Reranker struct {
+	client ai.AIClient
+	opts   RerankOptions
+	cache  *rerankCache
+}
+
+func NewReranker(client ai.AIClient, opts RerankOptions) (*Reranker, error) {
+	switch opts.Mode {
+	case RerankListwise, RerankPointwise:
+	default:
+		return nil, fmt.Errorf("неизвестный режим переранжирования: %s", opts.Mode)
+	}
+
+	if opts.Candidates <= 0 {
+		opts.Candidates = 30
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = 5
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 8 * time.Second
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = 256
+	}
+
+	return &Reranker{
+		client: client,
+		opts:   opts,
+		cache:  newRerankCache(opts.CacheSize),
+	}, nil
+}
+
+func (r *Reranker) Candidates() int {
+	return r.opts.Candidates
+}
+
+func (r *Reranker) Rerank(question string, hits []SearchHit) []SearchHit {
+	if len(hits) <= 1 {
+		return hits
+	}
+
+	key := rerankCacheKey(question, hits)
+	if scores, found := r.cache.get(key); found {
+		return r.apply(hits, scores)
+	}
+
+	done := make(chan map[string]float64, 1)
+	go func() {
+		var scores map[string]float64
+		var err error
+		if r.opts.Mode == RerankPointwise {
+			scores, err = r.scorePointwise(question, hits)
+		} else {
+			scores, err = r.scoreListwise(question, hits)
+		}
+
+		if err != nil {
+			log.Printf("Переранжирование не удалось: %v", err)
+			done <- nil
+			return
+		}
+
+		// Даже опоздавший ответ попадёт в кеш и пригодится в следующий раз
+		r.cache.put(key, scores)
+		done <- scores
+	}()
+
+	select {
+	case scores := <-done:
+		if scores == nil {
+			return r.truncate(hits)
+		}
+		return r.apply(hits, scores)
+	case <-time.After(r.opts.Timeout):
+		log.Printf("Переранжирование превысило %s, используется исходный порядок", r.opts.Timeout)
+		return r.truncate(hits)
+	}
+}
+
+func (r *Reranker) truncate(hits []SearchHit) []SearchHit {
+	if len(hits) > r.opts.TopN {
+		return hits[:r.opts.TopN]
+	}
+	return hits
+}
+
+// apply сортирует кандидатов по баллам модели; кандидаты без балла
+// идут после оценённых в исходном порядке.
+func (r *Reranker) apply(hits []SearchHit, scores map[string]float64) []SearchHit {
+	var scored, rest []SearchHit
+
+	for _, hit := range hits {
+		score, found := scores[hit.Document.ID]
+		if !found {
+			rest = append(rest, hit)
+			continue
+		}
+
+		hit.Retrievers = copyScores(hit.Retrievers)
+		hit.Retrievers[RetrieverRerank] = score
+		scored = append(scored, hit)
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Retrievers[RetrieverRerank] > scored[j].Retrievers[RetrieverRerank]
+	})
+
+	return r.truncate(append(scored, rest...))
+}
+
+func (r *Reranker) scoreListwise(question string, hits []SearchHit) (map[string]float64, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Оцени, какие фрагменты лучше всего отвечают на вопрос.\n\n")
+	prompt.WriteString("Вопрос: " + question + "\n\nФрагменты:\n")
+	for i, hit := range hits {
+		prompt.WriteString(fmt.Sprintf("[%d] %s\n", i+1, truncateRunes(hit.Document.Content, rerankPassageLimit)))
+	}
+	prompt.WriteString(fmt.Sprintf("\nВерни номера не более %d самых релевантных фрагментов через запятую, "+
+		"от самого полезного к наименее полезному. Нерелевантные не указывай. Ответь только номерами.", r.opts.TopN))
+
+	answer, err := r.client.Ask(prompt.String())
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]float64)
+	rank := 0
+	for _, match := range numberRegexp.FindAllString(answer, -1) {
+		number, err := strconv.Atoi(match)
+		if err != nil || number < 1 || number > len(hits) {
+			continue
+		}
+
+		id := hits[number-1].Document.ID
+		if _, seen := scores[id]; seen {
+			continue
+		}
+		scores[id] = float64(len(hits) - rank)
+		rank++
+	}
+
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("модель не вернула номера фрагментов: %q", truncateRunes(answer, 100))
+	}
+
+	return scores, nil
+}
+
+func (r *Reranker) scorePointwise(question string, hits []SearchHit) (map[string]float64, error) {
+	scores := make(map[string]float64)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, rerankParallelism)
+
+	for _, hit := range hits {
+		wg.Add(1)
+		go func(hit SearchHit) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			prompt := "Оцени по шкале от 0 до 10, насколько фрагмент помогает ответить на вопрос. " +
+				"Ответь одним числом.\n\nВопрос: " + question +
+				"\n\nФрагмент: " + truncateRunes(hit.Document.Content, rerankPassageLimit)
+
+			answer, err := r.client.Ask(prompt)
+			if err != nil {
+				return
+			}
+
+			match := numberRegexp.FindString(answer)
+			score, err := strconv.ParseFloat(strings.Replace(match, ",", ".", 1), 64)
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			scores[hit.Document.ID] = score
+			mu.Unlock()
+		}(hit)
+	}
+
+	wg.Wait()
+
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("модель не оценила ни одного фрагмента")
+	}
+	return scores, nil
+}
+
+func copyScores(scores map[string]float64) map[string]float64 {
+	copied := make(map[string]float64, len(scores)+1)
+	for key, value := range scores {
+		copied[key] = value
+	}
+	return copied
+}
+
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
+
+// rerankCacheKey учитывает хеш текста кандидатов: после /rag_edit
+// документ сохраняет ID, и старые оценки к нему уже не относятся.
+func rerankCacheKey(question string, hits []SearchHit) string {
+	var key strings.Builder
+	key.WriteString(strings.ToLower(strings.TrimSpace(question)))
+	for _, hit := range hits {
+		key.WriteString("|" + hit.Document.ID + ":" + strconv.FormatUint(contentHash(hit.Document.Content), 16))
+	}
+	return key.String()
+}
+
+// rerankCache - LRU-кеш оценок по вопросу и набору кандидатов.
+type rerankCache struct {
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+	mu       sync.Mutex
+}
+
+type rerankCacheEntry struct {
+	key    string
+	scores map[string]float64
+}
+
+func newRerankCache(capacity int) *rerankCache {
+	return &rerankCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *rerankCache) get(key string) (map[string]float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*rerankCacheEntry).scores, true
+}
+
+func (c *rerankCache) put(key string, scores map[string]float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, found := c.items[key]; found {
+		element.Value.(*rerankCacheEntry).scores = scores
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&rerankCacheEntry{key: key, scores: scores})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*rerankCacheEntry).key)
+	}
+}
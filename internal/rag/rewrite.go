@@ -0,0 +1,134 @@
+package rag
+
+import (
+	"GolangtgBot/internal/ai"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	rewriteHistoryTurns = 3
+	rewriteAnswerLimit  = 300
+)
+
+type RewriteOptions struct {
+	Enabled bool
+	HyDE    bool
+	Timeout time.Duration
+}
+
+// Turn - одна реплика диалога: вопрос пользователя, ответ бота и ID
+// документов, на которые ответ опирался.
+type Turn struct {
+	Question string
+	Answer   string
+	Sources  []string
+}
+
+// Query - запрос после переписывания. Text идёт в лексический поиск,
+// DenseText - в векторный (при HyDE это гипотетический ответ).
+type Query struct {
+	Original  string
+	Text      string
+	DenseText string
+}
+
+// QueryRewriter превращает вопрос вроде «а как его развернуть?» в
+// самостоятельный поисковый запрос с учётом истории диалога.
+type QueryRewriter struct {
+	client ai.AIClient
+	opts   RewriteOptions
+}
+
+func NewQueryRewriter(client ai.AIClient, opts RewriteOptions) *QueryRewriter {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 8 * time.Second
+	}
+	return &QueryRewriter{client: client, opts: opts}
+}
+
+func (r *QueryRewriter) Rewrite(question string, history []Turn) Query {
+	query := Query{Original: question, Text: question, DenseText: question}
+
+	if r.opts.Enabled {
+		if rewritten, ok := r.ask(r.rewritePrompt(question, history)); ok {
+			query.Text = rewritten
+			query.DenseText = rewritten
+		}
+	}
+
+	if r.opts.HyDE {
+		if hypothetical, ok := r.ask(r.hydePrompt(query.Text)); ok {
+			query.DenseText = hypothetical
+		}
+	}
+
+	log.Printf("RAG: запрос %q переписан в %q", question, query.Text)
+	if query.DenseText != query.Text {
+		log.Printf("RAG: гипотетический ответ для векторного поиска: %q", truncateRunes(query.DenseText, 200))
+	}
+
+	return query
+}
+
+func (r *QueryRewriter) rewritePrompt(question string, history []Turn) string {
+	var prompt strings.Builder
+	prompt.WriteString("Перепиши последний вопрос пользователя в самостоятельный поисковый запрос " +
+		"для базы знаний. Раскрой местоимения и недосказанность по истории диалога, " +
+		"сохрани ключевые термины и язык вопроса.\n\n")
+
+	if len(history) > rewriteHistoryTurns {
+		history = history[len(history)-rewriteHistoryTurns:]
+	}
+	if len(history) > 0 {
+		prompt.WriteString("История диалога:\n")
+		for _, turn := range history {
+			prompt.WriteString("Пользователь: " + turn.Question + "\n")
+			if turn.Answer != "" {
+				prompt.WriteString("Бот: " + truncateRunes(turn.Answer, rewriteAnswerLimit) + "\n")
+			}
+		}
+		prompt.WriteString("\n")
+	}
+
+	prompt.WriteString(fmt.Sprintf("Вопрос: %s\n\nОтветь только текстом запроса, без пояснений.", question))
+	return prompt.String()
+}
+
+func (r *QueryRewriter) hydePrompt(query string) string {
+	return "Напиши короткий абзац (2-3 предложения), который мог бы быть ответом на вопрос " +
+		"в справочной статье. Точность не важна, важны термины.\n\nВопрос: " + query
+}
+
+// ask вызывает модель с ограничением по времени. При ошибке, таймауте
+// или пустом ответе возвращает ok=false, и запрос остаётся исходным.
+func (r *QueryRewriter) ask(prompt string) (string, bool) {
+	type result struct {
+		answer string
+		err    error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		answer, err := r.client.Ask(prompt)
+		done <- result{answer, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			log.Printf("Переписывание запроса не удалось: %v", res.err)
+			return "", false
+		}
+		answer := strings.Trim(strings.TrimSpace(res.answer), "\"«»")
+		if answer == "" {
+			return "", false
+		}
+		return answer, true
+	case <-time.After(r.opts.Timeout):
+		log.Printf("Переписывание запроса превысило %s", r.opts.Timeout)
+		return "", false
+	}
+}
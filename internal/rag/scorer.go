@@ -0,0 +1,166 @@
+package rag
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	ScorerBM25  = "bm25"
+	ScorerTFIDF = "tfidf"
+
+	DefaultBM25K1 = 1.2
+	DefaultBM25B  = 0.75
+)
+
+// CorpusStats - статистика по всей базе, нужная для IDF и нормализации длины.
+type CorpusStats struct {
+	DocCount  int
+	AvgDocLen float64
+	DocFreq   func(term string) int
+}
+
+// DocStats - частоты терминов одного документа.
+type DocStats struct {
+	TermFreq map[string]int
+	Length   int
+}
+
+type Scorer interface {
+	Name() string
+	Score(query map[string]int, doc DocStats, corpus CorpusStats) float64
+	MinScore() float64
+}
+
+func NewScorer(name string, k1, b float64) (Scorer, error) {
+	switch name {
+	case "", ScorerBM25:
+		return NewBM25Scorer(k1, b), nil
+	case ScorerTFIDF:
+		return &TFIDFScorer{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный алгоритм ранжирования: %s", name)
+	}
+}
+
+type BM25Scorer struct {
+	K1 float64
+	B  float64
+}
+
+func NewBM25Scorer(k1, b float64) *BM25Scorer {
+	if k1 <= 0 {
+		k1 = DefaultBM25K1
+	}
+	if b < 0 || b > 1 {
+		b = DefaultBM25B
+	}
+
+	return &BM25Scorer{
+		K1: k1,
+		B:  b,
+	}
+}
+
+func (s *BM25Scorer) Name() string {
+	return ScorerBM25
+}
+
+func (s *BM25Scorer) MinScore() float64 {
+	return 0
+}
+
+func (s *BM25Scorer) Score(query map[string]int, doc DocStats, corpus CorpusStats) float64 {
+	if corpus.DocCount == 0 || doc.Length == 0 {
+		return 0
+	}
+
+	avgLen := corpus.AvgDocLen
+	if avgLen == 0 {
+		avgLen = 1
+	}
+	lengthNorm := 1 - s.B + s.B*float64(doc.Length)/avgLen
+
+	score := 0.0
+	for term := range query {
+		tf := float64(doc.TermFreq[term])
+		if tf == 0 {
+			continue
+		}
+
+		idf := bm25IDF(corpus.DocCount, corpus.DocFreq(term))
+		score += idf * tf * (s.K1 + 1) / (tf + s.K1*lengthNorm)
+	}
+
+	return score
+}
+
+func bm25IDF(docCount, docFreq int) float64 {
+	n := float64(docCount)
+	df := float64(docFreq)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// TFIDFScorer - классическая косинусная близость векторов (1+log tf)*idf.
+type TFIDFScorer struct{}
+
+func (s *TFIDFScorer) Name() string {
+	return ScorerTFIDF
+}
+
+func (s *TFIDFScorer) MinScore() float64 {
+	return 0.05
+}
+
+func (s *TFIDFScorer) Score(query map[string]int, doc DocStats, corpus CorpusStats) float64 {
+	if corpus.DocCount == 0 || doc.Length == 0 {
+		return 0
+	}
+
+	dotProduct := 0.0
+	queryNorm := 0.0
+	for term, qtf := range query {
+		idf := tfidfIDF(corpus.DocCount, corpus.DocFreq(term))
+		queryWeight := tfWeight(qtf) * idf
+		queryNorm += queryWeight * queryWeight
+
+		if dtf := doc.TermFreq[term]; dtf > 0 {
+			dotProduct += queryWeight * tfWeight(dtf) * idf
+		}
+	}
+
+	if dotProduct == 0 {
+		return 0
+	}
+
+	docNorm := 0.0
+	for term, dtf := range doc.TermFreq {
+		docWeight := tfWeight(dtf) * tfidfIDF(corpus.DocCount, corpus.DocFreq(term))
+		docNorm += docWeight * docWeight
+	}
+
+	if queryNorm == 0 || docNorm == 0 {
+		return 0
+	}
+
+	return dotProduct / (math.Sqrt(queryNorm) * math.Sqrt(docNorm))
+}
+
+func tfWeight(tf int) float64 {
+	if tf <= 0 {
+		return 0
+	}
+	return 1 + math.Log(float64(tf))
+}
+
+func tfidfIDF(docCount, docFreq int) float64 {
+	return math.Log(float64(1+docCount)/float64(1+docFreq)) + 1
+}
+
+func termFrequencies(tokens []string) map[string]int {
+	tf := make(map[string]int, len(tokens))
+	for _, token := range tokens {
+		tf[token]++
+	}
+	return tf
+}
@@ -0,0 +1,338 @@
+package rag
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SeedSource - источник документов из начального набора
+	SeedSource = "seed"
+
+	// legacySampleSource - источник демо-документов, которые прежние
+	// версии загружали в пустую базу
+	legacySampleSource = "sample"
+)
+
+// legacySamples - тексты демо-документов прежних версий. Удаляются
+// только точные совпадения, чтобы не задеть документы пользователей с
+// тем же источником.
+var legacySamples = map[string]bool{
+	"RAG Retrieval Augmented Generation архитектура поиск информация генерация текст":                    true,
+	"RAG сначала ищет релевантные документы базе знаний затем использует генерацию ответа":               true,
+	"Векторный поиск позволяет находить семантически похожие тексты точное совпадение слов":              true,
+	"Telegram боты создаются BotFather используют API отправки сообщений":                                true,
+	"Go Golang статически типизированный язык программирования сборщик мусора поддержка многопоточности": true,
+	"Docker позволяет упаковывать приложения контейнеры удобное развертывание":                           true,
+	"API ключи необходимы доступа сервисам искусственного интеллекта DeepSeek OpenRouter":                true,
+	"Программирование разработка программ обеспечение компьютеров алгоритмы код":                         true,
+	"Искусственный интеллект AI машинное обучение нейронные сети данные обучение модели":                 true,
+	"База данных хранение информации структурированные данные запросы SQL":                               true,
+	"Веб разработка создание сайтов приложений интерфейсы backend frontend":                              true,
+	"Мобильные приложения iOS Android разработка телефоны планшеты":                                      true,
+	"Облачные вычисления сервера хранение данных AWS Google Cloud Azure":                                 true,
+	"Блокчейн криптовалюты Bitcoin Ethereum смарт контракты децентрализация":                             true,
+}
+
+// SeedOptions задают начальный набор документов: каталоги и шаблоны
+// glob, каждый файл - один документ. Interval > 0 включает
+// перечитывание изменившихся файлов.
+type SeedOptions struct {
+	Paths      []string
+	Collection string
+	Interval   time.Duration
+}
+
+type SeedReport struct {
+	Added     int
+	Updated   int
+	Removed   int
+	Unchanged int
+	Errors    []error
+}
+
+func (r SeedReport) changed() bool {
+	return r.Added+r.Updated+r.Removed > 0
+}
+
+// seeder держит базу в соответствии с файлами начального набора. ID
+// документа выводится из пути к файлу, а хеш содержимого хранится в
+// метаданных, поэтому повторная загрузка тех же файлов ничего не меняет.
+type seeder struct {
+	pipeline *RAGPipeline
+	opts     SeedOptions
+	mu       sync.Mutex
+	stamps   map[string]fileStamp
+}
+
+// fileStamp - размер и время изменения файла: если они те же, файл не
+// перечитывается.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func newSeeder(pipeline *RAGPipeline, opts SeedOptions) (*seeder, error) {
+	if opts.Collection != "" {
+		collection, err := ParseCollection(opts.Collection)
+		if err == nil {
+			err = pipeline.collections.ensure(collection)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("коллекция начальных документов: %v", err)
+		}
+	}
+
+	return &seeder{
+		pipeline: pipeline,
+		opts:     opts,
+		stamps:   make(map[string]fileStamp),
+	}, nil
+}
+
+// seedID - ID документа для файла начального набора.
+func seedID(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return "seed_" + hex.EncodeToString(sum[:8])
+}
+
+// files находит файлы начального набора. complete == false, если
+// какой-то путь прочитать не удалось: тогда документы пропавших файлов
+// не удаляются, чтобы временная ошибка не стёрла весь набор.
+func (s *seeder) files(report *SeedReport) (paths []string, complete bool) {
+	complete = true
+	seen := make(map[string]bool)
+
+	add := func(path string) {
+		path = filepath.ToSlash(filepath.Clean(path))
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range s.opts.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err == nil && len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			err = fmt.Errorf("%s не найден", pattern)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			complete = false
+			continue
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				report.Errors = append(report.Errors, err)
+				complete = false
+				continue
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+
+			// В каталогах берутся только файлы знакомых форматов
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if strings.HasPrefix(entry.Name(), ".") && path != match {
+					if entry.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if entry.Type().IsRegular() && DetectFormat(path, "") != "" {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				report.Errors = append(report.Errors, err)
+				complete = false
+			}
+		}
+	}
+
+	return paths, complete
+}
+
+// sync загружает новые и изменившиеся файлы и удаляет документы
+// файлов, которых больше нет.
+func (s *seeder) sync() SeedReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var report SeedReport
+	paths, complete := s.files(&report)
+
+	current := make(map[string]bool, len(paths))
+	stamps := make(map[string]fileStamp, len(paths))
+
+	for _, path := range paths {
+		current[seedID(path)] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			continue
+		}
+		stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+		if previous, found := s.stamps[path]; found && previous == stamp {
+			stamps[path] = stamp
+			report.Unchanged++
+			continue
+		}
+
+		if err := s.load(path, &report); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("%s: %v", path, err))
+			continue
+		}
+		stamps[path] = stamp
+	}
+	s.stamps = stamps
+
+	if complete {
+		removed := make(map[string]bool)
+		for _, doc := range s.pipeline.store.Documents() {
+			group := documentGroup(doc)
+			if doc.Metadata.Source != SeedSource || current[group] || removed[group] {
+				continue
+			}
+			removed[group] = true
+			if _, err := s.pipeline.store.DeleteDocument(group); err != nil {
+				report.Errors = append(report.Errors, err)
+				continue
+			}
+			report.Removed++
+		}
+	}
+
+	if report.changed() {
+		s.pipeline.Snapshot()
+	}
+	return report
+}
+
+// load добавляет файл или заменяет его документ, если изменилось
+// содержимое или коллекция.
+func (s *seeder) load(path string, report *SeedReport) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:16])
+	id := seedID(path)
+
+	existing, found := s.pipeline.GetDocument(id)
+	if found && existing.Metadata.Extra["seed_hash"] == hash && existing.Metadata.Collection == s.opts.Collection {
+		report.Unchanged++
+		return nil
+	}
+
+	content, err := ExtractText(path, "", data)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(content) == "" {
+		return errors.New("в файле нет текста")
+	}
+
+	doc := Document{
+		ID:      id,
+		Content: content,
+		Metadata: Metadata{
+			Source:     SeedSource,
+			Collection: s.opts.Collection,
+			Language:   DetectLanguage(content),
+			Extra: map[string]string{
+				"filename":  path,
+				"format":    DetectFormat(path, ""),
+				"seed_hash": hash,
+			},
+		},
+	}
+
+	docs := s.pipeline.splitDocument(doc)
+	if found {
+		if err := s.pipeline.store.ReplaceDocument(id, docs); err != nil {
+			return err
+		}
+		report.Updated++
+		return nil
+	}
+
+	if _, err := s.pipeline.store.AddDocuments(docs); err != nil {
+		return err
+	}
+	report.Added++
+	return nil
+}
+
+// watch перечитывает начальный набор раз в Interval.
+func (s *seeder) watch() {
+	if s.opts.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.opts.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if report := s.sync(); report.changed() || len(report.Errors) > 0 {
+				logSeedReport(report)
+			}
+		}
+	}()
+}
+
+func logSeedReport(report SeedReport) {
+	for _, err := range report.Errors {
+		log.Printf("Начальные документы: %v", err)
+	}
+	log.Printf("Начальные документы: добавлено %d, обновлено %d, удалено %d, без изменений %d",
+		report.Added, report.Updated, report.Removed, report.Unchanged)
+}
+
+// Seed сверяет базу с файлами начального набора.
+func (p *RAGPipeline) Seed() (SeedReport, error) {
+	if p.seeder == nil {
+		return SeedReport{}, errors.New("начальный набор документов не настроен")
+	}
+
+	report := p.seeder.sync()
+	logSeedReport(report)
+	return report, nil
+}
+
+// removeLegacySamples удаляет демо-документы, которые прежние версии
+// добавляли в пустую базу: до появления метаданных без источника,
+// потом с источником sample, но всегда без автора.
+func (p *RAGPipeline) removeLegacySamples() {
+	removed, err := p.store.DeleteWhere(FilterFunc(func(doc Document) bool {
+		source := doc.Metadata.Source
+		return (source == "" || source == legacySampleSource) && doc.Metadata.AuthorID == 0 &&
+			legacySamples[doc.Content]
+	}))
+	if err != nil {
+		log.Printf("Ошибка удаления демо-документов: %v", err)
+	} else if removed > 0 {
+		log.Printf("Удалено %d демо-документов прежних версий", removed)
+	}
+}
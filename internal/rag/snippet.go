@@ -0,0 +1,272 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultSnippetLength = 200
+
+	snippetEllipsis = "…"
+)
+
+// SnippetOptions задают длину выдержки в символах. При Context в
+// контекст для модели попадают выдержки, а не документы целиком.
+type SnippetOptions struct {
+	Length  int
+	Context bool
+}
+
+func (o SnippetOptions) withDefaults() SnippetOptions {
+	if o.Length <= 0 {
+		o.Length = DefaultSnippetLength
+	}
+	return o
+}
+
+// Snippet - выдержка из документа вокруг совпадений с запросом.
+// Highlights - совпавшие слова, байтовые смещения в Text.
+type Snippet struct {
+	Text       string
+	Highlights []Span
+}
+
+type Span struct {
+	Start int
+	End   int
+}
+
+// snippetMatch - слово документа, совпавшее с термином запроса.
+type snippetMatch struct {
+	Span
+	term string
+}
+
+// snippetTerms - термины запроса вместе с подобранными для них
+// терминами с опечатками.
+func snippetTerms(queryTerms map[string]int, fuzzyTerms map[string]float64) map[string]bool {
+	terms := make(map[string]bool, len(queryTerms)+len(fuzzyTerms))
+	for term := range queryTerms {
+		terms[term] = true
+	}
+	for term := range fuzzyTerms {
+		terms[term] = true
+	}
+	return terms
+}
+
+// attachSnippetsLocked добавляет выдержки к найденным документам.
+// Вызывается под блокировкой.
+func (vs *VectorStore) attachSnippetsLocked(query string, hits []SearchHit) {
+	queryTerms := termFrequencies(vs.tokenize(query))
+	terms := snippetTerms(queryTerms, vs.fuzzyTerms(query, queryTerms))
+
+	for i := range hits {
+		hits[i].Snippet = vs.snippet(hits[i].Document.Content, terms)
+	}
+}
+
+// attachSnippets - то же для документов, найденных не этим
+// хранилищем, например векторным поиском в Qdrant.
+func (vs *VectorStore) attachSnippets(query string, hits []SearchHit) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	vs.attachSnippetsLocked(query, hits)
+}
+
+// snippet выбирает окно из Length символов, в котором больше всего
+// разных терминов запроса, а при равенстве - больше совпадений. Окно
+// начинается с начала предложения, если оно недалеко, и не режет слова.
+// Без совпадений выдержка - начало текста.
+func (vs *VectorStore) snippet(content string, terms map[string]bool) Snippet {
+	runes := []rune(content)
+	words := wordSpans(runes)
+	if len(words) == 0 {
+		return Snippet{}
+	}
+
+	var matches []snippetMatch
+	if len(terms) > 0 {
+		for _, word := range words {
+			for _, token := range vs.tokenize(string(runes[word.Start:word.End])) {
+				if terms[token] {
+					matches = append(matches, snippetMatch{Span: word, term: token})
+					break
+				}
+			}
+		}
+	}
+
+	length := vs.snippets.Length
+	start, end := 0, min(len(runes), length)
+
+	if len(matches) > 0 {
+		first, last := bestWindow(matches, length)
+		spanStart, spanEnd := matches[first].Start, matches[last].End
+
+		slack := max(0, length-(spanEnd-spanStart))
+		start = max(0, spanStart-slack/2)
+		if boundary := sentenceStart(runes, start, spanStart); boundary >= 0 {
+			start = boundary
+		}
+		end = min(len(runes), max(spanEnd, start+length))
+
+		// В конце текста окно сдвигается назад, чтобы не пустовать
+		if end == len(runes) && end-start < length {
+			start = max(0, min(start, end-length))
+		}
+	}
+
+	start, end = snapToWords(words, start, end)
+	return buildSnippet(runes, start, end, matches)
+}
+
+// bestWindow возвращает первое и последнее совпадение лучшего окна.
+func bestWindow(matches []snippetMatch, length int) (int, int) {
+	bestFirst, bestLast := 0, 0
+	bestDistinct, bestCount := 0, 0
+
+	for first := range matches {
+		distinct := make(map[string]bool)
+		for last := first; last < len(matches); last++ {
+			if matches[last].End-matches[first].Start > length {
+				break
+			}
+			distinct[matches[last].term] = true
+
+			count := last - first + 1
+			if len(distinct) > bestDistinct || (len(distinct) == bestDistinct && count > bestCount) {
+				bestFirst, bestLast = first, last
+				bestDistinct, bestCount = len(distinct), count
+			}
+		}
+	}
+
+	return bestFirst, bestLast
+}
+
+// sentenceStart ищет начало последнего предложения в runes[from:to];
+// -1, если его там нет.
+func sentenceStart(runes []rune, from, to int) int {
+	if from == 0 {
+		return -1
+	}
+
+	for i := to - 1; i > from; i-- {
+		previous := runes[i-1]
+		if previous != '\n' && !(strings.ContainsRune(".!?", previous) && unicode.IsSpace(runes[i])) {
+			continue
+		}
+		for i < to && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		return i
+	}
+	return -1
+}
+
+// snapToWords сдвигает границы окна внутрь, чтобы они не резали слова.
+func snapToWords(words []Span, start, end int) (int, int) {
+	snappedStart, snappedEnd := -1, -1
+	for _, word := range words {
+		if word.Start >= start && snappedStart < 0 {
+			snappedStart = word.Start
+		}
+		if word.End <= end {
+			snappedEnd = word.End
+		}
+	}
+
+	if snappedStart < 0 || snappedEnd <= snappedStart {
+		// Окно уже одного слова - берётся как есть
+		return start, end
+	}
+	return snappedStart, snappedEnd
+}
+
+// buildSnippet склеивает пробельные символы в один пробел, добавляет
+// многоточия на месте обрезанного текста и пересчитывает совпадения в
+// байтовые смещения.
+func buildSnippet(runes []rune, start, end int, matches []snippetMatch) Snippet {
+	var builder strings.Builder
+	if start > 0 {
+		builder.WriteString(snippetEllipsis)
+	}
+
+	offsets := make([]int, end-start+1)
+	space := false
+	for i := start; i < end; i++ {
+		offsets[i-start] = builder.Len()
+		if unicode.IsSpace(runes[i]) {
+			if !space {
+				builder.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		builder.WriteRune(runes[i])
+		space = false
+	}
+	offsets[end-start] = builder.Len()
+
+	if end < len(runes) {
+		builder.WriteString(snippetEllipsis)
+	}
+
+	var highlights []Span
+	for _, match := range matches {
+		if match.Start >= start && match.End <= end {
+			highlights = append(highlights, Span{
+				Start: offsets[match.Start-start],
+				End:   offsets[match.End-start],
+			})
+		}
+	}
+
+	return Snippet{Text: builder.String(), Highlights: highlights}
+}
+
+// wordSpans - границы слов в символах по тем же правилам, что у
+// splitWords.
+func wordSpans(runes []rune) []Span {
+	var spans []Span
+	start := -1
+
+	for i, r := range runes {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 && (r == '.' || r == '-') && i+1 < len(runes) && isWordRune(runes[i-1]) && isWordRune(runes[i+1]) {
+			continue
+		}
+
+		if start >= 0 {
+			spans = append(spans, Span{Start: start, End: i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		spans = append(spans, Span{Start: start, End: len(runes)})
+	}
+
+	return spans
+}
+
+// snippetContext заменяет документы выдержками для контекста модели.
+func snippetContext(hits []SearchHit) []SearchHit {
+	result := make([]SearchHit, len(hits))
+	for i, hit := range hits {
+		if hit.Snippet.Text != "" {
+			hit.Document.Content = hit.Snippet.Text
+		}
+		result[i] = hit
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSnippet(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		start, end int
+		matches    []Span
+		text       string
+		highlights []Span
+		words      []string
+	}{
+		{
+			name:       "весь текст",
+			content:    "Кошки спят",
+			start:      0,
+			end:        10,
+			matches:    []Span{{0, 5}},
+			text:       "Кошки спят",
+			highlights: []Span{{0, 10}},
+			words:      []string{"Кошки"},
+		},
+		{
+			name:       "пробелы склеиваются",
+			content:    "x  \n\t три",
+			start:      0,
+			end:        9,
+			matches:    []Span{{6, 9}},
+			text:       "x три",
+			highlights: []Span{{2, 8}},
+			words:      []string{"три"},
+		},
+		{
+			name:       "обрезка с двух сторон",
+			content:    "раз два три четыре",
+			start:      4,
+			end:        11,
+			matches:    []Span{{0, 3}, {8, 11}, {12, 18}},
+			text:       "…два три…",
+			highlights: []Span{{10, 16}},
+			words:      []string{"три"},
+		},
+		{
+			name:       "латиница и кириллица",
+			content:    "Docker упаковывает приложение",
+			start:      0,
+			end:        18,
+			matches:    []Span{{0, 6}, {7, 18}},
+			text:       "Docker упаковывает…",
+			highlights: []Span{{0, 6}, {7, 29}},
+			words:      []string{"Docker", "упаковывает"},
+		},
+		{
+			name:    "без совпадений",
+			content: "раз два",
+			start:   0,
+			end:     3,
+			text:    "раз…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := make([]snippetMatch, len(tt.matches))
+			for i, span := range tt.matches {
+				matches[i] = snippetMatch{Span: span}
+			}
+
+			snippet := buildSnippet([]rune(tt.content), tt.start, tt.end, matches)
+			if snippet.Text != tt.text {
+				t.Errorf("Text = %q, ожидалось %q", snippet.Text, tt.text)
+			}
+			if !reflect.DeepEqual(snippet.Highlights, tt.highlights) {
+				t.Errorf("Highlights = %v, ожидалось %v", snippet.Highlights, tt.highlights)
+			}
+
+			var words []string
+			for _, span := range snippet.Highlights {
+				words = append(words, snippet.Text[span.Start:span.End])
+			}
+			if !reflect.DeepEqual(words, tt.words) {
+				t.Errorf("выделены %q, ожидалось %q", words, tt.words)
+			}
+		})
+	}
+}
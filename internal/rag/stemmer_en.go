@@ -0,0 +1,294 @@
+package rag
+
+import "strings"
+
+// Реализация алгоритма Snowball (Porter2) для английского языка:
+// https://snowballstem.org/algorithms/english/stemmer.html
+
+var enExceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli", "only": "onli", "singly": "singl",
+	"sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas", "cosmos": "cosmos",
+	"bias": "bias", "andes": "andes",
+}
+
+var enExceptions1a = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true, "earring": true,
+	"proceed": true, "exceed": true, "succeed": true,
+}
+
+var enStep2Suffixes = []struct{ suffix, replacement string }{
+	{"ization", "ize"}, {"ational", "ate"}, {"fulness", "ful"}, {"ousness", "ous"}, {"iveness", "ive"},
+	{"tional", "tion"}, {"biliti", "ble"}, {"lessli", "less"},
+	{"entli", "ent"}, {"ation", "ate"}, {"alism", "al"}, {"aliti", "al"}, {"ousli", "ous"},
+	{"iviti", "ive"}, {"fulli", "ful"},
+	{"enci", "ence"}, {"anci", "ance"}, {"abli", "able"}, {"izer", "ize"}, {"ator", "ate"}, {"alli", "al"},
+	{"bli", "ble"}, {"ogi", "og"}, {"li", ""},
+}
+
+var enStep3Suffixes = []struct{ suffix, replacement string }{
+	{"ational", "ate"}, {"tional", "tion"}, {"alize", "al"}, {"icate", "ic"}, {"iciti", "ic"},
+	{"ative", ""}, {"ical", "ic"}, {"ness", ""}, {"ful", ""},
+}
+
+var enStep4Suffixes = []string{
+	"ement", "ance", "ence", "able", "ible", "ment", "ant", "ent", "ism", "ate", "iti", "ous",
+	"ive", "ize", "ion", "al", "er", "ic",
+}
+
+const (
+	enVowels    = "aeiouy"
+	enLiEndings = "cdeghkmnrt"
+)
+
+type EnglishStemmer struct{}
+
+func (EnglishStemmer) Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	if stem, exists := enExceptions[word]; exists {
+		return stem
+	}
+
+	w := []byte(strings.TrimPrefix(word, "'"))
+	for i := range w {
+		if w[i] == 'y' && (i == 0 || isEnVowel(w[i-1])) {
+			w[i] = 'Y'
+		}
+	}
+
+	r1, r2 := enRegions(w)
+
+	w = enStep0(w)
+	w = enStep1a(w)
+	if enExceptions1a[string(w)] {
+		return string(w)
+	}
+	w = enStep1b(w, r1)
+	w = enStep1c(w)
+	w = enStep2(w, r1)
+	w = enStep3(w, r1, r2)
+	w = enStep4(w, r2)
+	w = enStep5(w, r1, r2)
+
+	return strings.ReplaceAll(string(w), "Y", "y")
+}
+
+func enRegions(w []byte) (r1, r2 int) {
+	s := string(w)
+	switch {
+	case strings.HasPrefix(s, "gener"), strings.HasPrefix(s, "arsen"):
+		r1 = 5
+	case strings.HasPrefix(s, "commun"):
+		r1 = 6
+	default:
+		r1 = enRegionAfter(w, 0)
+	}
+	r2 = enRegionAfter(w, r1)
+	return r1, r2
+}
+
+func enRegionAfter(w []byte, from int) int {
+	for i := from + 1; i < len(w); i++ {
+		if !isEnVowel(w[i]) && isEnVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+func enStep0(w []byte) []byte {
+	for _, suffix := range []string{"'s'", "'s", "'"} {
+		if enHasSuffix(w, suffix) {
+			return w[:len(w)-len(suffix)]
+		}
+	}
+	return w
+}
+
+func enStep1a(w []byte) []byte {
+	switch {
+	case enHasSuffix(w, "sses"):
+		return w[:len(w)-2]
+	case enHasSuffix(w, "ied"), enHasSuffix(w, "ies"):
+		if len(w) > 4 {
+			return w[:len(w)-2]
+		}
+		return w[:len(w)-1]
+	case enHasSuffix(w, "us"), enHasSuffix(w, "ss"):
+		return w
+	case enHasSuffix(w, "s"):
+		for i := 0; i < len(w)-2; i++ {
+			if isEnVowel(w[i]) {
+				return w[:len(w)-1]
+			}
+		}
+	}
+	return w
+}
+
+func enStep1b(w []byte, r1 int) []byte {
+	for _, suffix := range []string{"eedly", "eed"} {
+		if enHasSuffix(w, suffix) {
+			if len(w)-len(suffix) >= r1 {
+				return append(w[:len(w)-len(suffix)], "ee"...)
+			}
+			return w
+		}
+	}
+
+	for _, suffix := range []string{"ingly", "edly", "ing", "ed"} {
+		if !enHasSuffix(w, suffix) {
+			continue
+		}
+
+		stem := w[:len(w)-len(suffix)]
+		if !enContainsVowel(stem) {
+			return w
+		}
+
+		switch {
+		case enHasSuffix(stem, "at"), enHasSuffix(stem, "bl"), enHasSuffix(stem, "iz"):
+			return append(stem, 'e')
+		case enEndsWithDouble(stem):
+			return stem[:len(stem)-1]
+		case enIsShortWord(stem, r1):
+			return append(stem, 'e')
+		}
+		return stem
+	}
+
+	return w
+}
+
+func enStep1c(w []byte) []byte {
+	n := len(w)
+	if n > 2 && (w[n-1] == 'y' || w[n-1] == 'Y') && !isEnVowel(w[n-2]) {
+		w[n-1] = 'i'
+	}
+	return w
+}
+
+func enStep2(w []byte, r1 int) []byte {
+	for _, rule := range enStep2Suffixes {
+		if !enHasSuffix(w, rule.suffix) {
+			continue
+		}
+
+		start := len(w) - len(rule.suffix)
+		if start < r1 {
+			return w
+		}
+
+		switch rule.suffix {
+		case "ogi":
+			if start == 0 || w[start-1] != 'l' {
+				return w
+			}
+		case "li":
+			if start == 0 || strings.IndexByte(enLiEndings, w[start-1]) < 0 {
+				return w
+			}
+		}
+
+		return append(w[:start], rule.replacement...)
+	}
+	return w
+}
+
+func enStep3(w []byte, r1, r2 int) []byte {
+	for _, rule := range enStep3Suffixes {
+		if !enHasSuffix(w, rule.suffix) {
+			continue
+		}
+
+		start := len(w) - len(rule.suffix)
+		if start < r1 || (rule.suffix == "ative" && start < r2) {
+			return w
+		}
+
+		return append(w[:start], rule.replacement...)
+	}
+	return w
+}
+
+func enStep4(w []byte, r2 int) []byte {
+	for _, suffix := range enStep4Suffixes {
+		if !enHasSuffix(w, suffix) {
+			continue
+		}
+
+		start := len(w) - len(suffix)
+		if start < r2 {
+			return w
+		}
+
+		if suffix == "ion" && (start == 0 || (w[start-1] != 's' && w[start-1] != 't')) {
+			return w
+		}
+
+		return w[:start]
+	}
+	return w
+}
+
+func enStep5(w []byte, r1, r2 int) []byte {
+	n := len(w)
+	if n == 0 {
+		return w
+	}
+
+	switch w[n-1] {
+	case 'e':
+		if n-1 >= r2 || (n-1 >= r1 && !enEndsWithShortSyllable(w[:n-1])) {
+			return w[:n-1]
+		}
+	case 'l':
+		if n-1 >= r2 && n > 1 && w[n-2] == 'l' {
+			return w[:n-1]
+		}
+	}
+	return w
+}
+
+func enHasSuffix(w []byte, suffix string) bool {
+	return len(w) >= len(suffix) && string(w[len(w)-len(suffix):]) == suffix
+}
+
+func enContainsVowel(w []byte) bool {
+	for _, c := range w {
+		if isEnVowel(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func enEndsWithDouble(w []byte) bool {
+	n := len(w)
+	if n < 2 || w[n-1] != w[n-2] {
+		return false
+	}
+	return strings.IndexByte("bdfgmnprt", w[n-1]) >= 0
+}
+
+func enEndsWithShortSyllable(w []byte) bool {
+	n := len(w)
+	if n == 2 {
+		return isEnVowel(w[0]) && !isEnVowel(w[1])
+	}
+	if n >= 3 {
+		return !isEnVowel(w[n-3]) && isEnVowel(w[n-2]) && !isEnVowel(w[n-1]) &&
+			w[n-1] != 'w' && w[n-1] != 'x' && w[n-1] != 'Y'
+	}
+	return false
+}
+
+func enIsShortWord(w []byte, r1 int) bool {
+	return r1 >= len(w) && enEndsWithShortSyllable(w)
+}
+
+func isEnVowel(c byte) bool {
+	return strings.IndexByte(enVowels, c) >= 0
+}
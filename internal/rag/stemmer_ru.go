@@ -0,0 +1,184 @@
+package rag
+
+// Реализация алгоритма Snowball для русского языка:
+// https://snowballstem.org/algorithms/russian/stemmer.html
+
+var (
+	ruPerfectiveGerund1 = []string{"в", "вши", "вшись"}
+	ruPerfectiveGerund2 = []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"}
+
+	ruAdjective = []string{
+		"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом",
+		"его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею",
+	}
+
+	ruParticiple1 = []string{"ем", "нн", "вш", "ющ", "щ"}
+	ruParticiple2 = []string{"ивш", "ывш", "ующ"}
+
+	ruReflexive = []string{"ся", "сь"}
+
+	ruVerb1 = []string{
+		"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно",
+	}
+	ruVerb2 = []string{
+		"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен",
+		"ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю",
+	}
+
+	ruNoun = []string{
+		"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой", "ий", "й",
+		"иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я",
+	}
+
+	ruSuperlative  = []string{"ейш", "ейше"}
+	ruDerivational = []string{"ост", "ость"}
+)
+
+const (
+	ruVowels        = "аеиоуыэюя"
+	ruPrecedingAYa  = "ая"
+	ruStemMinLength = 3
+)
+
+type RussianStemmer struct{}
+
+func (RussianStemmer) Stem(word string) string {
+	runes := []rune(word)
+	if len(runes) < ruStemMinLength {
+		return word
+	}
+
+	for i, r := range runes {
+		if r == 'ё' {
+			runes[i] = 'е'
+		}
+	}
+
+	rv, r2 := ruRegions(runes)
+	if rv >= len(runes) {
+		return string(runes)
+	}
+
+	// Шаг 1
+	if n := ruMatchGroups(runes, rv, ruPerfectiveGerund1, ruPerfectiveGerund2); n > 0 {
+		runes = runes[:len(runes)-n]
+	} else {
+		if n := ruLongestSuffix(runes, rv, ruReflexive); n > 0 {
+			runes = runes[:len(runes)-n]
+		}
+
+		if n := ruLongestSuffix(runes, rv, ruAdjective); n > 0 {
+			runes = runes[:len(runes)-n]
+			if n := ruMatchGroups(runes, rv, ruParticiple1, ruParticiple2); n > 0 {
+				runes = runes[:len(runes)-n]
+			}
+		} else if n := ruMatchGroups(runes, rv, ruVerb1, ruVerb2); n > 0 {
+			runes = runes[:len(runes)-n]
+		} else if n := ruLongestSuffix(runes, rv, ruNoun); n > 0 {
+			runes = runes[:len(runes)-n]
+		}
+	}
+
+	// Шаг 2
+	if len(runes) > rv && runes[len(runes)-1] == 'и' {
+		runes = runes[:len(runes)-1]
+	}
+
+	// Шаг 3
+	if n := ruLongestSuffix(runes, r2, ruDerivational); n > 0 {
+		runes = runes[:len(runes)-n]
+	}
+
+	// Шаг 4
+	if ruHasSuffix(runes, rv, "нн") {
+		runes = runes[:len(runes)-1]
+	} else if n := ruLongestSuffix(runes, rv, ruSuperlative); n > 0 {
+		runes = runes[:len(runes)-n]
+		if ruHasSuffix(runes, rv, "нн") {
+			runes = runes[:len(runes)-1]
+		}
+	} else if ruHasSuffix(runes, rv, "ь") {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes)
+}
+
+// ruRegions возвращает начало RV и R2 в рунах.
+func ruRegions(runes []rune) (rv, r2 int) {
+	rv = len(runes)
+	for i, r := range runes {
+		if isRuneIn(r, ruVowels) {
+			rv = i + 1
+			break
+		}
+	}
+
+	r1 := ruRegionAfter(runes, 0)
+	r2 = ruRegionAfter(runes, r1)
+
+	return rv, r2
+}
+
+// ruRegionAfter находит позицию после первой пары "гласная, согласная"
+// начиная с from.
+func ruRegionAfter(runes []rune, from int) int {
+	for i := from + 1; i < len(runes); i++ {
+		if !isRuneIn(runes[i], ruVowels) && isRuneIn(runes[i-1], ruVowels) {
+			return i + 1
+		}
+	}
+	return len(runes)
+}
+
+// ruMatchGroups ищет самое длинное окончание из двух групп. Окончания
+// первой группы должны стоять после "а" или "я", которые не удаляются.
+func ruMatchGroups(runes []rune, region int, group1, group2 []string) int {
+	n1 := ruLongestSuffix(runes, region, group1)
+	n2 := ruLongestSuffix(runes, region, group2)
+
+	if n2 >= n1 && n2 > 0 {
+		return n2
+	}
+	if n1 > 0 {
+		pos := len(runes) - n1 - 1
+		if pos >= region && isRuneIn(runes[pos], ruPrecedingAYa) {
+			return n1
+		}
+	}
+	return 0
+}
+
+func ruLongestSuffix(runes []rune, region int, suffixes []string) int {
+	best := 0
+	for _, suffix := range suffixes {
+		if n := len([]rune(suffix)); n > best && ruHasSuffix(runes, region, suffix) {
+			best = n
+		}
+	}
+	return best
+}
+
+func ruHasSuffix(runes []rune, region int, suffix string) bool {
+	suffixRunes := []rune(suffix)
+	start := len(runes) - len(suffixRunes)
+	if start < region || start < 0 {
+		return false
+	}
+
+	for i, r := range suffixRunes {
+		if runes[start+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func isRuneIn(r rune, set string) bool {
+	for _, c := range set {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
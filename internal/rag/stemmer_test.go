@@ -0,0 +1,71 @@
+package rag
+
+import "testing"
+
+// Ожидаемые основы взяты из словарей проекта Snowball.
+
+func TestRussianStemmer(t *testing.T) {
+	tests := []struct {
+		word, stem string
+	}{
+		{"вагон", "вагон"},
+		{"вагона", "вагон"},
+		{"вагонов", "вагон"},
+		{"вагоном", "вагон"},
+		{"важная", "важн"},
+		{"важнее", "важн"},
+		{"важнейшие", "важн"},
+		{"важными", "важн"},
+		{"валяется", "валя"},
+		{"побежавший", "побежа"},
+		{"говорилось", "говор"},
+		{"радостно", "радостн"},
+		{"вечерами", "вечер"},
+		{"прогулках", "прогулк"},
+		{"подоконники", "подоконник"},
+		{"ёлки", "елк"},
+		{"вам", "вам"},
+		{"он", "он"},
+	}
+
+	for _, tt := range tests {
+		if stem := (RussianStemmer{}).Stem(tt.word); stem != tt.stem {
+			t.Errorf("Stem(%q) = %q, ожидалось %q", tt.word, stem, tt.stem)
+		}
+	}
+}
+
+func TestEnglishStemmer(t *testing.T) {
+	tests := []struct {
+		word, stem string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"agreed", "agre"},
+		{"hopping", "hop"},
+		{"filing", "file"},
+		{"fizzed", "fizz"},
+		{"happy", "happi"},
+		{"relational", "relat"},
+		{"vietnamization", "vietnam"},
+		{"decisiveness", "decis"},
+		{"hopefulness", "hope"},
+		{"electrical", "electr"},
+		{"replacement", "replac"},
+		{"generously", "generous"},
+		{"knightly", "knight"},
+		{"succeeding", "succeed"},
+		{"'cause", "caus"},
+		// Исключения
+		{"dying", "die"},
+		{"skies", "sky"},
+		{"news", "news"},
+		{"at", "at"},
+	}
+
+	for _, tt := range tests {
+		if stem := (EnglishStemmer{}).Stem(tt.word); stem != tt.stem {
+			t.Errorf("Stem(%q) = %q, ожидалось %q", tt.word, stem, tt.stem)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	logFileName      = "wal.jsonl"
+	indexFileName    = "dense.hnsw"
+	vectorsFileName  = "vectors.bin"
+
+	vectorsFileVersion = 1
+
+	opAdd    = "add"
+	opDelete = "delete"
+)
+
+// Storage хранит снапшот базы знаний и журнал изменений (WAL) на диске.
+// Снапшот заменяется атомарно через временный файл и rename, журнал
+// дописывается построчно и очищается после каждого снапшота.
+type Storage struct {
+	dir          string
+	mu           sync.Mutex
+	logFile      *os.File
+	seq          uint64
+	pending      int
+	compactEvery int
+}
+
+type logEntry struct {
+	Seq      uint64    `json:"seq"`
+	Op       string    `json:"op"`
+	Time     time.Time `json:"ts"`
+	Document *Document `json:"doc,omitempty"`
+	ID       string    `json:"id,omitempty"`
+}
+
+type snapshotFile struct {
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastSeq   uint64     `json:"last_seq"`
+	Documents []Document `json:"documents"`
+}
+
+func OpenStorage(dir string, compactEvery int) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("не удалось создать каталог хранилища: %v", err)
+	}
+
+	return &Storage{
+		dir:          dir,
+		compactEvery: compactEvery,
+	}, nil
+}
+
+// Load читает снапшот и проигрывает поверх него записи журнала,
+// которые были сделаны после снапшота.
+func (s *Storage) Load() ([]Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, err := s.readSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]string, 0, len(snap.Documents))
+	docs := make(map[string]Document, len(snap.Documents))
+	for _, doc := range snap.Documents {
+		order = append(order, doc.ID)
+		docs[doc.ID] = doc
+	}
+	s.seq = snap.LastSeq
+
+	entries, err := s.readLog()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Seq <= snap.LastSeq {
+			continue
+		}
+		switch entry.Op {
+		case opAdd:
+			if entry.Document == nil {
+				continue
+			}
+			if _, exists := docs[entry.Document.ID]; !exists {
+				order = append(order, entry.Document.ID)
+			}
+			docs[entry.Document.ID] = *entry.Document
+		case opDelete:
+			delete(docs, entry.ID)
+		}
+		s.seq = entry.Seq
+		s.pending++
+	}
+
+	result := make([]Document, 0, len(docs))
+	for _, id := range order {
+		if doc, exists := docs[id]; exists {
+			result = append(result, doc)
+			delete(docs, id)
+		}
+	}
+
+	if err := s.openLog(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Storage) readSnapshot() (snapshotFile, error) {
+	var snap snapshotFile
+
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, fmt.Errorf("ошибка чтения снапшота: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("ошибка разбора снапшота: %v", err)
+	}
+
+	return snap, nil
+}
+
+func (s *Storage) readLog() ([]logEntry, error) {
+	var entries []logEntry
+	err := replayLog(filepath.Join(s.dir, logFileName), func(line []byte) error {
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// replayLog передаёт apply строки журнала по одной. Повреждённые строки
+// пропускаются. Хвост после последней целой строки - запись, оборванная
+// падением процесса, - отрезается, иначе следующая запись допишется в
+// его продолжение и тоже станет нечитаемой.
+func replayLog(path string, apply func(line []byte) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка открытия журнала: %v", err)
+	}
+	defer file.Close()
+
+	var offset, valid int64
+	reader := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		offset += int64(len(line))
+		if len(line) > 0 {
+			// Строка без перевода строки не дописана до конца
+			complete := line[len(line)-1] == '\n'
+			if !complete {
+				log.Printf("Журнал %s: оборванная строка %d", filepath.Base(path), lineNum)
+			} else if applyErr := apply(line); applyErr != nil {
+				log.Printf("Журнал %s: пропущена повреждённая строка %d: %v", filepath.Base(path), lineNum, applyErr)
+			} else {
+				valid = offset
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка чтения журнала: %v", err)
+		}
+	}
+
+	if offset > valid {
+		if err := os.Truncate(path, valid); err != nil {
+			return fmt.Errorf("ошибка обрезки журнала: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) openLog() error {
+	file, err := os.OpenFile(filepath.Join(s.dir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия журнала: %v", err)
+	}
+	s.logFile = file
+	return nil
+}
+
+func (s *Storage) AppendAdd(docs ...Document) error {
+	entries := make([]logEntry, len(docs))
+	for i := range docs {
+		entries[i] = logEntry{Op: opAdd, Document: &docs[i]}
+	}
+	return s.append(entries...)
+}
+
+func (s *Storage) AppendDelete(ids ...string) error {
+	entries := make([]logEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = logEntry{Op: opDelete, ID: id}
+	}
+	return s.append(entries...)
+}
+
+// append пишет все записи и делает один fsync на всю пачку.
+func (s *Storage) append(entries ...logEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.logFile == nil {
+		if err := s.openLog(); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	now := time.Now()
+	for _, entry := range entries {
+		s.seq++
+		entry.Seq = s.seq
+		entry.Time = now
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("не удалось записать операцию в журнал: %v", err)
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	if _, err := s.logFile.Write(data); err != nil {
+		return fmt.Errorf("ошибка записи журнала: %v", err)
+	}
+	if err := s.logFile.Sync(); err != nil {
+		return fmt.Errorf("ошибка синхронизации журнала: %v", err)
+	}
+
+	s.pending += len(entries)
+	return nil
+}
+
+// NeedsSnapshot сообщает, что журнал вырос до порога compactEvery.
+func (s *Storage) NeedsSnapshot() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compactEvery > 0 && s.pending >= s.compactEvery
+}
+
+// Seq - номер последней записи журнала.
+func (s *Storage) Seq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seq
+}
+
+// WriteSnapshot атомарно заменяет снапшот состоянием на записи lastSeq
+// и очищает журнал. Снапшот пишется без блокировки журнала, поэтому
+// вызовы не должны пересекаться. Если за это время в журнал что-то
+// дописали, он не очищается: при загрузке записи с seq <= LastSeq
+// пропускаются, так же как после падения между rename и очисткой.
+func (s *Storage) WriteSnapshot(docs []Document, lastSeq uint64) error {
+	snap := snapshotFile{
+		Version:   1,
+		CreatedAt: time.Now(),
+		LastSeq:   lastSeq,
+		Documents: docs,
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("не удалось сериализовать снапшот: %v", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(s.dir, snapshotFileName), data); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq != lastSeq {
+		s.pending = int(s.seq - lastSeq)
+		return nil
+	}
+
+	if s.logFile != nil {
+		s.logFile.Close()
+		s.logFile = nil
+	}
+	if err := os.Truncate(filepath.Join(s.dir, logFileName), 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("ошибка очистки журнала: %v", err)
+	}
+	s.pending = 0
+
+	return s.openLog()
+}
+
+// WriteIndex сохраняет граф векторного индекса рядом со снапшотом.
+func (s *Storage) WriteIndex(data []byte) error {
+	return writeFileAtomic(filepath.Join(s.dir, indexFileName), data)
+}
+
+// ReadIndex возвращает сохранённый граф или nil, если его ещё нет.
+func (s *Storage) ReadIndex() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, indexFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// vectorsFile - векторы документов на момент снапшота. В JSON снапшота
+// и журнала они не пишутся: в двоичном виде float32 занимают в несколько
+// раз меньше места. Хэш текста отсекает векторы документов, которые
+// изменились после сохранения.
+type vectorsFile struct {
+	Version int
+	Vectors []vectorRecord
+}
+
+type vectorRecord struct {
+	ID          string
+	Model       string
+	ContentHash uint64
+	Values      []float32
+}
+
+func contentHash(text string) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(text))
+	return hasher.Sum64()
+}
+
+// WriteVectors сохраняет векторы документов рядом со снапшотом.
+func (s *Storage) WriteVectors(docs []Document) error {
+	file := vectorsFile{Version: vectorsFileVersion}
+	for _, doc := range docs {
+		if doc.Vector == nil {
+			continue
+		}
+		values := make([]float32, len(doc.Vector))
+		for i, value := range doc.Vector {
+			values[i] = float32(value)
+		}
+		file.Vectors = append(file.Vectors, vectorRecord{
+			ID:          doc.ID,
+			Model:       doc.VectorModel,
+			ContentHash: contentHash(doc.indexText()),
+			Values:      values,
+		})
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(file); err != nil {
+		return fmt.Errorf("не удалось сериализовать векторы: %v", err)
+	}
+	return writeFileAtomic(filepath.Join(s.dir, vectorsFileName), data.Bytes())
+}
+
+// RestoreVectors возвращает документам сохранённые векторы. Документы,
+// для которых вектора нет или он устарел, остаются без него, их векторы
+// пересчитает эмбеддер.
+func (s *Storage) RestoreVectors(docs []Document) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, vectorsFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения векторов: %v", err)
+	}
+
+	var file vectorsFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&file); err != nil {
+		return fmt.Errorf("повреждён файл векторов: %v", err)
+	}
+	if file.Version != vectorsFileVersion {
+		return fmt.Errorf("неподдерживаемая версия файла векторов: %d", file.Version)
+	}
+
+	records := make(map[string]vectorRecord, len(file.Vectors))
+	for _, record := range file.Vectors {
+		records[record.ID] = record
+	}
+
+	for i := range docs {
+		record, found := records[docs[i].ID]
+		if !found || record.ContentHash != contentHash(docs[i].indexText()) {
+			continue
+		}
+		vector := make([]float64, len(record.Values))
+		for j, value := range record.Values {
+			vector[j] = float64(value)
+		}
+		docs[i].Vector, docs[i].VectorModel = vector, record.Model
+	}
+
+	return nil
+}
+
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.logFile == nil {
+		return nil
+	}
+	err := s.logFile.Close()
+	s.logFile = nil
+	return err
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("ошибка создания временного файла: %v", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка установки прав на файл: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка записи временного файла: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка синхронизации временного файла: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("ошибка закрытия временного файла: %v", err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("ошибка замены файла: %v", err)
+	}
+
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+
+	return nil
+}
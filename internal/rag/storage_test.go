@@ -0,0 +1,159 @@
+package rag
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReplayLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		applied []string
+		kept    string
+	}{
+		{
+			name:    "целый журнал",
+			content: "\"a\"\n\"b\"\n",
+			applied: []string{"a", "b"},
+			kept:    "\"a\"\n\"b\"\n",
+		},
+		{
+			name:    "оборванная последняя строка отрезается",
+			content: "\"a\"\n\"b",
+			applied: []string{"a"},
+			kept:    "\"a\"\n",
+		},
+		{
+			name:    "целая, но не дописанная строка тоже отрезается",
+			content: "\"a\"\n\"b\"",
+			applied: []string{"a"},
+			kept:    "\"a\"\n",
+		},
+		{
+			name:    "повреждённая строка в середине пропускается",
+			content: "\"a\"\n{oops\n\"b\"\n",
+			applied: []string{"a", "b"},
+			kept:    "\"a\"\n{oops\n\"b\"\n",
+		},
+		{
+			name:    "повреждённый хвост отрезается целиком",
+			content: "\"a\"\n{oops\n\"b",
+			applied: []string{"a"},
+			kept:    "\"a\"\n",
+		},
+		{
+			name:    "нечего читать",
+			content: "\"a",
+			kept:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), logFileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var applied []string
+			err := replayLog(path, func(line []byte) error {
+				var value string
+				if err := json.Unmarshal(line, &value); err != nil {
+					return err
+				}
+				applied = append(applied, value)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("replayLog: %v", err)
+			}
+
+			if !reflect.DeepEqual(applied, tt.applied) {
+				t.Errorf("прочитаны %q, ожидалось %q", applied, tt.applied)
+			}
+			if data, _ := os.ReadFile(path); string(data) != tt.kept {
+				t.Errorf("в журнале осталось %q, ожидалось %q", data, tt.kept)
+			}
+		})
+	}
+}
+
+func TestStorageReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	load := func() []string {
+		t.Helper()
+
+		storage, err := OpenStorage(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs, err := storage.Load()
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		t.Cleanup(func() { storage.Close() })
+
+		var ids []string
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	storage, err := OpenStorage(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Load()
+
+	a, b, c := Document{ID: "a", Content: "раз"}, Document{ID: "b", Content: "два"}, Document{ID: "c", Content: "три"}
+	if err := storage.AppendAdd(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.AppendDelete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := load(); !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Fatalf("после журнала загружены %v, ожидалось [b]", ids)
+	}
+
+	// Снапшот на записи 2, а журнал ушёл дальше: он не очищается, и
+	// записи до снапшота при загрузке пропускаются
+	if err := storage.AppendAdd(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.WriteSnapshot([]Document{a, b}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if ids := load(); !reflect.DeepEqual(ids, []string{"b", "c"}) {
+		t.Fatalf("после снапшота загружены %v, ожидалось [b c]", ids)
+	}
+
+	// Оборванная запись после падения не портит следующие
+	storage.Close()
+	file, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"seq":5,"op":"add","doc":{"id":"d"`)
+	file.Close()
+
+	storage, err = OpenStorage(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Load()
+	if err := storage.AppendAdd(Document{ID: "e", Content: "пять"}); err != nil {
+		t.Fatal(err)
+	}
+	storage.Close()
+
+	if ids := load(); !reflect.DeepEqual(ids, []string{"b", "c", "e"}) {
+		t.Fatalf("после обрыва загружены %v, ожидалось [b c e]", ids)
+	}
+}
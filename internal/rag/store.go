@@ -0,0 +1,107 @@
+package rag
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendQdrant = "qdrant"
+)
+
+// Retriever ищет документы по тексту запроса.
+type Retriever interface {
+	SearchLexical(query string, topK int, filters ...Filter) []SearchHit
+	SearchDense(query string, topK int, filters ...Filter) []SearchHit
+}
+
+// DocumentStore - хранилище документов и фрагментов, с которым работает
+// RAGPipeline. VectorStore держит всё в памяти, QdrantStore хранит
+// векторы во внешней базе.
+type DocumentStore interface {
+	Retriever
+
+	// AddDocuments добавляет или заменяет документы с теми же ID и
+	// возвращает их ID. Документам без ID назначается новый.
+	AddDocuments(docs []Document) ([]string, error)
+	Get(id string) (Document, bool)
+	Chunks(parentID string) []Document
+	Documents() []Document
+	ExpandChunk(doc Document, window int) Document
+
+	ReplaceDocument(id string, docs []Document) error
+	DeleteDocument(id string) (int, error)
+	DeleteWhere(filter Filter) (int, error)
+
+	FindDuplicates(content string, threshold float64, filters ...Filter) []Duplicate
+	DuplicateClusters(threshold float64) [][]string
+
+	Len() int
+	Snapshot()
+	GetStats() map[string]interface{}
+}
+
+func newTokenizer(opts Options) *UnicodeTokenizer {
+	tokenizer := NewUnicodeTokenizer(opts.Languages...)
+	tokenizer.Stemming = opts.Stemming
+	return tokenizer
+}
+
+// OpenStore создаёт хранилище выбранного в opts.Backend типа и
+// загружает в него сохранённые документы.
+func OpenStore(opts Options) (DocumentStore, error) {
+	local := NewVectorStore()
+
+	scorer, err := NewScorer(opts.Scorer, opts.BM25K1, opts.BM25B)
+	if err != nil {
+		return nil, err
+	}
+	local.SetScorer(scorer)
+
+	local.SetTokenizer(newTokenizer(opts))
+
+	local.SetFuzzy(opts.Fuzzy)
+	local.SetSnippets(opts.Snippets)
+
+	switch opts.Backend {
+	case "", BackendMemory:
+	case BackendQdrant:
+		if opts.Embedder == nil {
+			return nil, fmt.Errorf("для хранилища %s нужен эмбеддер", BackendQdrant)
+		}
+		return OpenQdrantStore(opts.Qdrant, local, opts.Embedder)
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище: %s", opts.Backend)
+	}
+
+	switch opts.DenseIndex {
+	case "", DenseIndexHNSW:
+		hnsw := opts.HNSW.withDefaults()
+		local.SetDenseIndex(func() DenseIndex { return NewHNSWIndex(hnsw) })
+	case DenseIndexFlat:
+		local.SetDenseIndex(func() DenseIndex { return NewFlatIndex() })
+	default:
+		return nil, fmt.Errorf("неизвестный векторный индекс: %s", opts.DenseIndex)
+	}
+
+	if opts.StoragePath != "" {
+		storage, err := OpenStorage(opts.StoragePath, opts.SnapshotEvery)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := local.AttachStorage(storage); err != nil {
+			return nil, fmt.Errorf("ошибка загрузки базы знаний: %v", err)
+		}
+
+		log.Printf("Загружено %d документов из %s", local.Len(), opts.StoragePath)
+		local.StartSnapshots(opts.SnapshotInterval)
+	}
+
+	if opts.Embedder != nil {
+		local.SetEmbedder(opts.Embedder)
+	}
+
+	return local, nil
+}
@@ -0,0 +1,541 @@
+package rag_test
+
+import (
+	"GolangtgBot/internal/ai"
+	"GolangtgBot/internal/rag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// storeBackend открывает проверяемое хранилище: open - новое пустое,
+// reopen - заново то, что последним вернул open, как после перезапуска.
+type storeBackend struct {
+	open   func(t *testing.T) rag.DocumentStore
+	reopen func(t *testing.T) rag.DocumentStore
+}
+
+// Все хранилища проходят один набор сценариев. Хранилище открывается с
+// эмбеддером и поиском с опечатками, иначе их не проверить.
+var storeChecks = []struct {
+	name string
+	run  func(t *testing.T, backend storeBackend)
+}{
+	{"add_get", checkAddGet},
+	{"upsert", checkUpsert},
+	{"documents", checkDocuments},
+	{"chunks", checkChunks},
+	{"delete", checkDelete},
+	{"delete_where", checkDeleteWhere},
+	{"replace", checkReplace},
+	{"lexical_search", checkLexicalSearch},
+	{"fuzzy_search", checkFuzzySearch},
+	{"dense_search", checkDenseSearch},
+	{"snippets", checkSnippets},
+	{"duplicates", checkDuplicates},
+	{"reopen", checkReopen},
+}
+
+func runStoreChecks(t *testing.T, backend storeBackend) {
+	for _, check := range storeChecks {
+		t.Run(check.name, func(t *testing.T) {
+			check.run(t, backend)
+		})
+	}
+}
+
+func storeOptions() rag.Options {
+	return rag.Options{
+		Embedder: ai.NewHashEmbedder(0),
+		Stemming: true,
+		Fuzzy:    rag.FuzzyOptions{Enabled: true},
+	}
+}
+
+func openStore(t *testing.T, opts rag.Options) rag.DocumentStore {
+	t.Helper()
+
+	store, err := rag.OpenStore(opts)
+	if err != nil {
+		t.Fatalf("не удалось открыть хранилище: %v", err)
+	}
+	return store
+}
+
+func TestMemoryStore(t *testing.T) {
+	for _, denseIndex := range []string{rag.DenseIndexHNSW, rag.DenseIndexFlat} {
+		t.Run(denseIndex, func(t *testing.T) {
+			var dir string
+			reopen := func(t *testing.T) rag.DocumentStore {
+				opts := storeOptions()
+				opts.Backend = rag.BackendMemory
+				opts.DenseIndex = denseIndex
+				opts.StoragePath = dir
+				return openStore(t, opts)
+			}
+
+			runStoreChecks(t, storeBackend{
+				open: func(t *testing.T) rag.DocumentStore {
+					dir = t.TempDir()
+					return reopen(t)
+				},
+				reopen: reopen,
+			})
+		})
+	}
+}
+
+// TestQdrantStore проверяет хранилище на заменителе Qdrant, а если задан
+// RAG_TEST_QDRANT_URL, то на настоящем Qdrant: в нём создаются и
+// удаляются коллекции storetest_*.
+func TestQdrantStore(t *testing.T) {
+	url, apiKey := os.Getenv("RAG_TEST_QDRANT_URL"), os.Getenv("RAG_TEST_QDRANT_API_KEY")
+	if url == "" {
+		server := newFakeQdrant(apiKey)
+		t.Cleanup(server.Close)
+		url = server.URL
+	}
+
+	var collection string
+	counter := 0
+	reopen := func(t *testing.T) rag.DocumentStore {
+		opts := storeOptions()
+		opts.Backend = rag.BackendQdrant
+		opts.Qdrant = rag.QdrantOptions{URL: url, APIKey: apiKey, Collection: collection}
+		return openStore(t, opts)
+	}
+
+	runStoreChecks(t, storeBackend{
+		open: func(t *testing.T) rag.DocumentStore {
+			counter++
+			collection = fmt.Sprintf("storetest_%d_%d", os.Getpid(), counter)
+			name := collection
+			t.Cleanup(func() { dropQdrantCollection(url, apiKey, name) })
+			return reopen(t)
+		},
+		reopen: reopen,
+	})
+}
+
+func dropQdrantCollection(url, apiKey, collection string) {
+	req, err := http.NewRequest(http.MethodDelete, strings.TrimRight(url, "/")+"/collections/"+collection, nil)
+	if err != nil {
+		return
+	}
+	if apiKey != "" {
+		req.Header.Set("api-key", apiKey)
+	}
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func corpus() []rag.Document {
+	return []rag.Document{
+		{ID: "cats", Content: "Кошки спят до шестнадцати часов в сутки и любят тёплые подоконники",
+			Metadata: rag.Metadata{Collection: "pets", Tags: []string{"animals"}}},
+		{ID: "dogs", Content: "Собаки нуждаются в ежедневных прогулках и дрессировке с раннего возраста",
+			Metadata: rag.Metadata{Collection: "pets", Tags: []string{"animals"}}},
+		{ID: "go", Content: "Go компилируется в статический бинарный файл и поддерживает горутины",
+			Metadata: rag.Metadata{Collection: "code", Tags: []string{"lang"}}},
+		{ID: "docker", Content: "Docker упаковывает приложение вместе с зависимостями в контейнер",
+			Metadata: rag.Metadata{Collection: "code"}},
+	}
+}
+
+var manualParts = []string{
+	"Установка: скачайте архив и распакуйте его в домашний каталог",
+	"Настройка: укажите токен бота в переменной окружения",
+	"Запуск: выполните команду и проверьте журнал на ошибки",
+}
+
+// manual - документ из трёх фрагментов без перекрытия.
+func manual() []rag.Document {
+	var chunks []rag.Chunk
+	offset := 0
+	for i, text := range manualParts {
+		chunks = append(chunks, rag.Chunk{Text: text, Position: i, Start: offset, End: offset + len(text)})
+		offset += len(text) + 1
+	}
+	return rag.ChunkDocuments("manual", chunks, rag.Metadata{Collection: "docs"})
+}
+
+func openWith(t *testing.T, backend storeBackend, docs ...[]rag.Document) rag.DocumentStore {
+	t.Helper()
+
+	store := backend.open(t)
+	for _, batch := range docs {
+		if _, err := store.AddDocuments(batch); err != nil {
+			t.Fatalf("AddDocuments: %v", err)
+		}
+	}
+	return store
+}
+
+func hitIDs(hits []rag.SearchHit) []string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.Document.ID
+	}
+	return ids
+}
+
+func contains(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func checkAddGet(t *testing.T, backend storeBackend) {
+	store := backend.open(t)
+
+	ids, err := store.AddDocuments(corpus())
+	if err != nil {
+		t.Fatalf("AddDocuments: %v", err)
+	}
+	if strings.Join(ids, ",") != "cats,dogs,go,docker" {
+		t.Fatalf("AddDocuments вернул %v", ids)
+	}
+	if store.Len() != 4 {
+		t.Fatalf("Len = %d, ожидалось 4", store.Len())
+	}
+
+	for _, want := range corpus() {
+		doc, found := store.Get(want.ID)
+		switch {
+		case !found:
+			t.Fatalf("Get(%s): документ не найден", want.ID)
+		case doc.Content != want.Content:
+			t.Fatalf("Get(%s): текст %q", want.ID, doc.Content)
+		case doc.Metadata.Collection != want.Metadata.Collection:
+			t.Fatalf("Get(%s): коллекция %q", want.ID, doc.Metadata.Collection)
+		case strings.Join(doc.Metadata.Tags, ",") != strings.Join(want.Metadata.Tags, ","):
+			t.Fatalf("Get(%s): теги %v", want.ID, doc.Metadata.Tags)
+		case doc.Metadata.CreatedAt.IsZero():
+			t.Fatalf("Get(%s): не заполнена дата создания", want.ID)
+		}
+	}
+
+	if _, found := store.Get("missing"); found {
+		t.Fatalf("Get(missing) нашёл документ")
+	}
+}
+
+func checkUpsert(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus())
+
+	if _, err := store.AddDocuments([]rag.Document{{ID: "cats", Content: "Кошки ловят мышей по ночам"}}); err != nil {
+		t.Fatalf("AddDocuments: %v", err)
+	}
+	if store.Len() != 4 {
+		t.Fatalf("после замены по ID Len = %d, ожидалось 4", store.Len())
+	}
+	if doc, _ := store.Get("cats"); doc.Content != "Кошки ловят мышей по ночам" {
+		t.Fatalf("документ с тем же ID не заменён: %q", doc.Content)
+	}
+
+	ids, err := store.AddDocuments([]rag.Document{{Content: "Документ без ID"}})
+	if err != nil {
+		t.Fatalf("AddDocuments: %v", err)
+	}
+	if len(ids) != 1 || ids[0] == "" {
+		t.Fatalf("документу без ID не назначен ID: %v", ids)
+	}
+	if doc, found := store.Get(ids[0]); !found || doc.Content != "Документ без ID" {
+		t.Fatalf("Get(%s) после добавления без ID: %v", ids[0], found)
+	}
+}
+
+func checkDocuments(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus(), manual())
+
+	var ids []string
+	for _, doc := range store.Documents() {
+		ids = append(ids, doc.ID)
+	}
+	sort.Strings(ids)
+
+	want := "cats,docker,dogs,go,manual_0,manual_1,manual_2"
+	if strings.Join(ids, ",") != want || store.Len() != len(ids) {
+		t.Fatalf("Documents = %v, Len = %d, ожидалось %s", ids, store.Len(), want)
+	}
+}
+
+func checkChunks(t *testing.T, backend storeBackend) {
+	parts := manual()
+	// Порядок добавления не должен влиять на порядок фрагментов
+	parts[0], parts[2] = parts[2], parts[0]
+
+	store := openWith(t, backend, parts)
+
+	chunks := store.Chunks("manual")
+	if len(chunks) != len(manualParts) {
+		t.Fatalf("Chunks вернул %d фрагментов, ожидалось %d", len(chunks), len(manualParts))
+	}
+	for i, chunk := range chunks {
+		if chunk.Chunk == nil || chunk.Chunk.ParentID != "manual" || chunk.Chunk.Position != i {
+			t.Fatalf("фрагмент %d: %+v", i, chunk.Chunk)
+		}
+	}
+
+	if _, found := store.Get("manual"); found {
+		t.Fatalf("Get по ID исходного документа должен искать только фрагменты")
+	}
+
+	expanded := store.ExpandChunk(chunks[1], -1)
+	if expanded.Content != strings.Join(manualParts, "\n") {
+		t.Fatalf("ExpandChunk(-1) = %q", expanded.Content)
+	}
+	if neighbours := store.ExpandChunk(chunks[0], 1); neighbours.Content != manualParts[0]+"\n"+manualParts[1] {
+		t.Fatalf("ExpandChunk(1) = %q", neighbours.Content)
+	}
+}
+
+func checkDelete(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus(), manual())
+
+	if removed, err := store.DeleteDocument("manual"); err != nil || removed != 3 {
+		t.Fatalf("DeleteDocument(manual) = %d, %v, ожидалось 3 фрагмента", removed, err)
+	}
+	if _, found := store.Get("manual_1"); found {
+		t.Fatalf("фрагмент остался после удаления документа")
+	}
+	if chunks := store.Chunks("manual"); len(chunks) != 0 {
+		t.Fatalf("Chunks после удаления вернул %d фрагментов", len(chunks))
+	}
+
+	if removed, err := store.DeleteDocument("go"); err != nil || removed != 1 {
+		t.Fatalf("DeleteDocument(go) = %d, %v", removed, err)
+	}
+	if _, err := store.DeleteDocument("go"); err == nil {
+		t.Fatalf("повторное удаление не вернуло ошибку")
+	}
+
+	if store.Len() != 3 {
+		t.Fatalf("Len = %d, ожидалось 3", store.Len())
+	}
+	if ids := hitIDs(store.SearchDense(corpus()[2].Content, 10)); contains(ids, "go") {
+		t.Fatalf("удалённый документ найден векторным поиском: %v", ids)
+	}
+	if ids := hitIDs(store.SearchLexical("горутины", 10)); contains(ids, "go") {
+		t.Fatalf("удалённый документ найден лексическим поиском: %v", ids)
+	}
+}
+
+func checkDeleteWhere(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus(), manual())
+
+	removed, err := store.DeleteWhere(rag.InCollections("pets", "docs"))
+	if err != nil || removed != 5 {
+		t.Fatalf("DeleteWhere = %d, %v, ожидалось 5", removed, err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Len = %d, ожидалось 2", store.Len())
+	}
+	if ids := hitIDs(store.SearchDense(corpus()[0].Content, 10)); contains(ids, "cats") {
+		t.Fatalf("удалённый документ найден векторным поиском: %v", ids)
+	}
+
+	if removed, err := store.DeleteWhere(rag.TagIn("nothing")); err != nil || removed != 0 {
+		t.Fatalf("DeleteWhere без совпадений = %d, %v", removed, err)
+	}
+}
+
+func checkReplace(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus(), manual())
+
+	replacement := []rag.Document{{ID: "dogs", Content: "Попугаи повторяют слова и живут десятилетиями",
+		Metadata: rag.Metadata{Collection: "pets"}}}
+	if err := store.ReplaceDocument("dogs", replacement); err != nil {
+		t.Fatalf("ReplaceDocument(dogs): %v", err)
+	}
+	if doc, _ := store.Get("dogs"); doc.Content != replacement[0].Content {
+		t.Fatalf("текст не заменён: %q", doc.Content)
+	}
+	if ids := hitIDs(store.SearchLexical("попугаи", 5)); !contains(ids, "dogs") {
+		t.Fatalf("новый текст не найден лексическим поиском: %v", ids)
+	}
+	if ids := hitIDs(store.SearchLexical("прогулках", 5)); contains(ids, "dogs") {
+		t.Fatalf("старый текст всё ещё находится: %v", ids)
+	}
+	if hits := store.SearchDense(replacement[0].Content, 1); len(hits) == 0 || hits[0].Document.ID != "dogs" {
+		t.Fatalf("новый вектор не найден: %v", hitIDs(hits))
+	}
+
+	// Документ из фрагментов заменяется одним документом с тем же ID
+	whole := []rag.Document{{ID: "manual", Content: "Короткое руководство целиком", Metadata: rag.Metadata{Collection: "docs"}}}
+	if err := store.ReplaceDocument("manual", whole); err != nil {
+		t.Fatalf("ReplaceDocument(manual): %v", err)
+	}
+	if chunks := store.Chunks("manual"); len(chunks) != 0 {
+		t.Fatalf("после замены остались фрагменты: %d", len(chunks))
+	}
+	if _, found := store.Get("manual_0"); found {
+		t.Fatalf("после замены остался фрагмент manual_0")
+	}
+	if doc, found := store.Get("manual"); !found || doc.Content != whole[0].Content {
+		t.Fatalf("Get(manual) после замены: %v", found)
+	}
+
+	if err := store.ReplaceDocument("missing", replacement); err == nil {
+		t.Fatalf("замена несуществующего документа не вернула ошибку")
+	}
+}
+
+func checkLexicalSearch(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus())
+
+	hits := store.SearchLexical("кошки подоконники", 3)
+	if len(hits) == 0 || hits[0].Document.ID != "cats" {
+		t.Fatalf("лексический поиск вернул %v, ожидалось cats первым", hitIDs(hits))
+	}
+	if hits[0].Score <= 0 || hits[0].Retrievers[rag.RetrieverLexical] == 0 {
+		t.Fatalf("у результата нет балла: %+v", hits[0])
+	}
+
+	if ids := hitIDs(store.SearchLexical("кошки подоконники", 3, rag.InCollections("code"))); contains(ids, "cats") {
+		t.Fatalf("фильтр по коллекции не применён: %v", ids)
+	}
+	if hits := store.SearchLexical("контейнер", 1); len(hits) != 1 || hits[0].Document.ID != "docker" {
+		t.Fatalf("topK=1 вернул %v", hitIDs(hits))
+	}
+}
+
+func checkFuzzySearch(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus())
+
+	for _, query := range []string{"контенер", "докер", "горутинны"} {
+		hits := store.SearchLexical(query, 1)
+		want := "docker"
+		if query == "горутинны" {
+			want = "go"
+		}
+		if len(hits) == 0 || hits[0].Document.ID != want {
+			t.Fatalf("запрос с опечаткой %q вернул %v, ожидалось %s", query, hitIDs(hits), want)
+		}
+	}
+
+	exact := store.SearchLexical("контейнер", 1)
+	fuzzy := store.SearchLexical("контенер", 1)
+	if len(exact) == 0 || exact[0].Score <= fuzzy[0].Score {
+		t.Fatalf("совпадение с опечаткой не ниже точного: %v и %v", exact, fuzzy)
+	}
+}
+
+func checkDenseSearch(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus())
+
+	for _, doc := range corpus() {
+		hits := store.SearchDense(doc.Content, 2)
+		if len(hits) == 0 || hits[0].Document.ID != doc.ID {
+			t.Fatalf("запрос текстом %s вернул %v", doc.ID, hitIDs(hits))
+		}
+		if hits[0].Score < 0.99 || hits[0].Retrievers[rag.RetrieverDense] == 0 {
+			t.Fatalf("близость %s к своему тексту %.4f", doc.ID, hits[0].Score)
+		}
+		if hits[0].Document.Content != doc.Content {
+			t.Fatalf("в результате нет текста документа %s", doc.ID)
+		}
+	}
+
+	hits := store.SearchDense(corpus()[0].Content, 4, rag.InCollections("code"))
+	for _, hit := range hits {
+		if hit.Document.Metadata.Collection != "code" {
+			t.Fatalf("фильтр по коллекции пропустил %s", hit.Document.ID)
+		}
+	}
+
+	if hits := store.SearchDense(corpus()[0].Content, 1, rag.TagIn("animals")); len(hits) != 1 || hits[0].Document.ID != "cats" {
+		t.Fatalf("поиск с фильтром по тегу вернул %v", hitIDs(hits))
+	}
+}
+
+// checkSnippets проверяет выдержки лексического и векторного поиска:
+// совпавшие слова отмечены, в том числе найденные с опечаткой.
+func checkSnippets(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus())
+
+	for query, want := range map[string][]string{
+		"горутины":         {"горутины"},
+		"докер контенер":   {"Docker", "контейнер"},
+		"кошки подоконник": {"Кошки", "подоконники"},
+	} {
+		for name, hits := range map[string][]rag.SearchHit{
+			rag.RetrieverLexical: store.SearchLexical(query, 1),
+			rag.RetrieverDense:   store.SearchDense(query, 1),
+		} {
+			if len(hits) == 0 {
+				t.Fatalf("%s: запрос %q ничего не нашёл", name, query)
+			}
+
+			snippet := hits[0].Snippet
+			var highlighted []string
+			for _, span := range snippet.Highlights {
+				highlighted = append(highlighted, snippet.Text[span.Start:span.End])
+			}
+			if strings.Join(highlighted, " ") != strings.Join(want, " ") {
+				t.Fatalf("%s: в выдержке %q по запросу %q отмечены %v, ожидались %v",
+					name, snippet.Text, query, highlighted, want)
+			}
+		}
+	}
+}
+
+func checkDuplicates(t *testing.T, backend storeBackend) {
+	copyOfCats := rag.Document{ID: "cats-copy", Content: corpus()[0].Content, Metadata: rag.Metadata{Collection: "pets"}}
+
+	store := openWith(t, backend, corpus(), []rag.Document{copyOfCats})
+
+	duplicates := store.FindDuplicates(corpus()[0].Content, rag.DefaultDedupThreshold)
+	var ids []string
+	for _, duplicate := range duplicates {
+		ids = append(ids, duplicate.ID)
+	}
+	if !contains(ids, "cats") || !contains(ids, "cats-copy") || contains(ids, "dogs") {
+		t.Fatalf("FindDuplicates вернул %v", ids)
+	}
+
+	if found := store.FindDuplicates(corpus()[0].Content, rag.DefaultDedupThreshold, rag.InCollections("code")); len(found) != 0 {
+		t.Fatalf("FindDuplicates не применил фильтр: %v", found)
+	}
+
+	clusters := store.DuplicateClusters(rag.DefaultDedupThreshold)
+	if len(clusters) != 1 || strings.Join(clusters[0], ",") != "cats,cats-copy" {
+		t.Fatalf("DuplicateClusters = %v", clusters)
+	}
+}
+
+func checkReopen(t *testing.T, backend storeBackend) {
+	store := openWith(t, backend, corpus(), manual())
+	if _, err := store.DeleteDocument("docker"); err != nil {
+		t.Fatalf("DeleteDocument: %v", err)
+	}
+	store.Snapshot()
+
+	reopened := backend.reopen(t)
+
+	if reopened.Len() != 6 {
+		t.Fatalf("после перезапуска Len = %d, ожидалось 6", reopened.Len())
+	}
+	if _, found := reopened.Get("docker"); found {
+		t.Fatalf("удалённый документ вернулся после перезапуска")
+	}
+	if doc, found := reopened.Get("cats"); !found || doc.Content != corpus()[0].Content || doc.Metadata.Collection != "pets" {
+		t.Fatalf("Get(cats) после перезапуска: %v", found)
+	}
+	if chunks := reopened.Chunks("manual"); len(chunks) != 3 || chunks[2].Chunk.Position != 2 {
+		t.Fatalf("после перезапуска Chunks вернул %d фрагментов", len(chunks))
+	}
+	if hits := reopened.SearchDense(corpus()[2].Content, 1); len(hits) == 0 || hits[0].Document.ID != "go" {
+		t.Fatalf("векторный поиск после перезапуска вернул %v", hitIDs(hits))
+	}
+	if hits := reopened.SearchLexical("токен бота", 1); len(hits) == 0 || hits[0].Document.ID != "manual_1" {
+		t.Fatalf("лексический поиск после перезапуска вернул %v", hitIDs(hits))
+	}
+}
@@ -0,0 +1,183 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	LanguageRussian = "ru"
+	LanguageEnglish = "en"
+)
+
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+type Stemmer interface {
+	Stem(word string) string
+}
+
+var stemmers = map[string]Stemmer{
+	LanguageRussian: RussianStemmer{},
+	LanguageEnglish: EnglishStemmer{},
+}
+
+var stopWordLists = map[string][]string{
+	LanguageRussian: {
+		"и", "в", "на", "с", "по", "для", "не", "что", "это", "как", "так",
+		"из", "у", "к", "о", "за", "от", "то", "же", "все", "но", "вы", "бы",
+		"а", "мне", "вот", "до", "ну", "ли", "если", "уже", "или", "ни", "быть", "был",
+		"про", "при", "год", "очень", "может", "есть", "он", "она", "оно", "они",
+		"его", "ее", "её", "их", "мы", "я", "ты", "там", "тут", "где", "когда",
+		"чем", "чтобы", "этот", "эта", "эти", "того", "тот", "только", "еще", "ещё",
+	},
+	LanguageEnglish: {
+		"a", "an", "the", "and", "or", "but", "if", "of", "to", "in", "on", "at",
+		"by", "for", "with", "from", "as", "is", "are", "was", "were", "be", "been",
+		"it", "its", "this", "that", "these", "those", "not", "no", "do", "does",
+		"did", "can", "will", "would", "should", "what", "how", "why", "which",
+		"who", "i", "you", "he", "she", "we", "they", "me", "my", "your", "our",
+		"so", "than", "then", "there", "here", "about", "into", "also",
+	},
+}
+
+// UnicodeTokenizer выделяет слова из букв любых алфавитов, цифр и
+// подчёркиваний. Точка и дефис внутри слова сохраняются, поэтому
+// go1.25 и snake_case остаются одним термином; их части добавляются
+// отдельными токенами. При включённом Stemming слова приводятся к основе
+// стеммером языка, к алфавиту которого они относятся.
+//
+// Токенизатор один на базу знаний (RAG_LANGUAGES, RAG_STEMMING): все
+// коллекции лежат в общем индексе, и вопрос должен разбиваться на те же
+// термины, что и документы любой из них.
+type UnicodeTokenizer struct {
+	MinLength int
+	Stemming  bool
+	stopWords map[string]bool
+	stemmers  map[string]Stemmer
+}
+
+func NewUnicodeTokenizer(languages ...string) *UnicodeTokenizer {
+	if len(languages) == 0 {
+		languages = []string{LanguageRussian, LanguageEnglish}
+	}
+
+	stopWords := make(map[string]bool)
+	languageStemmers := make(map[string]Stemmer)
+	for _, lang := range languages {
+		lang = strings.TrimSpace(lang)
+		for _, word := range stopWordLists[lang] {
+			stopWords[word] = true
+		}
+		if stemmer, exists := stemmers[lang]; exists {
+			languageStemmers[lang] = stemmer
+		}
+	}
+
+	return &UnicodeTokenizer{
+		MinLength: 2,
+		Stemming:  true,
+		stopWords: stopWords,
+		stemmers:  languageStemmers,
+	}
+}
+
+func (t *UnicodeTokenizer) Tokenize(text string) []string {
+	var tokens []string
+
+	for _, word := range splitWords(strings.ToLower(text)) {
+		if t.accept(word) {
+			tokens = append(tokens, t.stem(word))
+		}
+
+		if strings.ContainsAny(word, "._-") {
+			for _, part := range strings.FieldsFunc(word, isWordJoiner) {
+				if part != word && t.accept(part) {
+					tokens = append(tokens, t.stem(part))
+				}
+			}
+		}
+	}
+
+	return tokens
+}
+
+// stem не трогает идентификаторы с цифрами и разделителями и слова
+// из смешанных алфавитов.
+func (t *UnicodeTokenizer) stem(word string) string {
+	if !t.Stemming {
+		return word
+	}
+
+	lang := ""
+	for _, r := range word {
+		var runeLang string
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			runeLang = LanguageRussian
+		case r >= 'a' && r <= 'z':
+			runeLang = LanguageEnglish
+		default:
+			return word
+		}
+
+		if lang != "" && lang != runeLang {
+			return word
+		}
+		lang = runeLang
+	}
+
+	stemmer, exists := t.stemmers[lang]
+	if !exists {
+		return word
+	}
+	return stemmer.Stem(word)
+}
+
+func (t *UnicodeTokenizer) accept(word string) bool {
+	if utf8.RuneCountInString(word) < t.MinLength {
+		return false
+	}
+	return !t.stopWords[word]
+}
+
+func splitWords(text string) []string {
+	var words []string
+	runes := []rune(text)
+	start := -1
+
+	for i, r := range runes {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		// Точка или дефис между двумя символами слова не разрывают его
+		if start >= 0 && (r == '.' || r == '-') && i+1 < len(runes) && isWordRune(runes[i-1]) && isWordRune(runes[i+1]) {
+			continue
+		}
+
+		if start >= 0 {
+			words = append(words, string(runes[start:i]))
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+
+	return words
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isWordJoiner(r rune) bool {
+	return r == '.' || r == '-' || r == '_'
+}
@@ -0,0 +1,256 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxRecordSize - самая длинная строка JSONL, которую читает импорт
+const maxRecordSize = 16 << 20
+
+// maxRecordIDBytes - самый длинный ID записи в байтах. ID источника
+// уходит в callback_data кнопки бота, а Telegram пропускает не больше
+// 64 байт: остаётся место на префикс кнопки и номер фрагмента.
+const maxRecordIDBytes = 48
+
+var recordIDRegexp = regexp.MustCompile(`^[\p{L}\p{N}_.:-]+$`)
+
+// Record - строка файла экспорта: документ целиком, без разбиения на
+// фрагменты. Вектор пишется только для документов из одного фрагмента.
+type Record struct {
+	ID          string    `json:"id"`
+	Content     string    `json:"content"`
+	Metadata    Metadata  `json:"metadata"`
+	Vector      []float64 `json:"vector,omitempty"`
+	VectorModel string    `json:"vector_model,omitempty"`
+}
+
+type ExportOptions struct {
+	Vectors bool
+	Filters []Filter
+}
+
+// ImportOptions: Collection подставляется записям без коллекции,
+// Source - записям без источника.
+type ImportOptions struct {
+	Collection string
+	Source     string
+}
+
+// LineError - ошибка в конкретной строке импортируемого файла.
+type LineError struct {
+	Line int
+	ID   string
+	Err  error
+}
+
+func (e LineError) Error() string {
+	if e.ID != "" {
+		return fmt.Sprintf("строка %d (%s): %v", e.Line, e.ID, e.Err)
+	}
+	return fmt.Sprintf("строка %d: %v", e.Line, e.Err)
+}
+
+type ImportReport struct {
+	Added     int
+	Updated   int
+	Merged    int
+	Unchanged int
+	Errors    []LineError
+}
+
+// Export пишет все документы в JSONL, по одному на строку, в порядке ID.
+// Фрагменты собираются обратно в исходный документ.
+func (p *RAGPipeline) Export(w io.Writer, opts ExportOptions) (int, error) {
+	docs := p.store.Documents()
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].ID < docs[j].ID
+	})
+
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+
+	exported := make(map[string]bool)
+	count := 0
+
+	for _, doc := range docs {
+		if doc.Chunk != nil {
+			if exported[doc.Chunk.ParentID] {
+				continue
+			}
+			parent, found := p.GetDocument(doc.Chunk.ParentID)
+			if !found {
+				continue
+			}
+			doc = parent
+		}
+		exported[doc.ID] = true
+
+		if !matchAll(doc, opts.Filters) {
+			continue
+		}
+
+		record := Record{ID: doc.ID, Content: doc.Content, Metadata: doc.Metadata}
+		if opts.Vectors {
+			record.Vector, record.VectorModel = doc.Vector, doc.VectorModel
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, writer.Flush()
+}
+
+// Import читает JSONL из Export. Ошибочные строки пропускаются и
+// попадают в отчёт, остальные добавляются. Запись с существующим ID
+// заменяет документ, новые проходят ту же проверку на дубликаты, что и
+// /rag_add. Повторный импорт того же файла ничего не меняет.
+func (p *RAGPipeline) Import(r io.Reader, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		record, err := parseRecord(data)
+		if err != nil {
+			report.Errors = append(report.Errors, LineError{Line: line, ID: record.ID, Err: err})
+			continue
+		}
+
+		if record.Metadata.Collection == "" {
+			record.Metadata.Collection = opts.Collection
+		}
+		if record.Metadata.Source == "" {
+			record.Metadata.Source = opts.Source
+		}
+		if record.Metadata.Collection != "" {
+			collection, err := ParseCollection(record.Metadata.Collection)
+			if err == nil {
+				err = p.collections.ensure(collection)
+			}
+			if err != nil {
+				report.Errors = append(report.Errors, LineError{Line: line, ID: record.ID, Err: err})
+				continue
+			}
+		}
+
+		if err := p.importRecord(record, &report); err != nil {
+			report.Errors = append(report.Errors, LineError{Line: line, ID: record.ID, Err: err})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("строка %d: %v", line+1, err)
+	}
+
+	if report.Added+report.Updated+report.Merged > 0 {
+		p.Snapshot()
+	}
+
+	return report, nil
+}
+
+func parseRecord(data []byte) (Record, error) {
+	var record Record
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&record); err != nil {
+		return record, fmt.Errorf("некорректный JSON: %v", err)
+	}
+
+	record.Content = strings.TrimSpace(record.Content)
+	if record.Content == "" {
+		return record, errors.New("пустой content")
+	}
+	if record.ID != "" && !recordIDRegexp.MatchString(record.ID) {
+		return record, fmt.Errorf("недопустимый id %q", record.ID)
+	}
+	if len(record.ID) > maxRecordIDBytes {
+		return record, fmt.Errorf("id длиннее %d байт", maxRecordIDBytes)
+	}
+	if len(record.Vector) > 0 && record.VectorModel == "" {
+		return record, errors.New("у вектора не указан vector_model")
+	}
+
+	return record, nil
+}
+
+func (p *RAGPipeline) importRecord(record Record, report *ImportReport) error {
+	doc := Document{
+		ID:          record.ID,
+		Content:     record.Content,
+		Metadata:    record.Metadata,
+		Vector:      record.Vector,
+		VectorModel: record.VectorModel,
+	}
+	if doc.Vector != nil {
+		doc.Vector = normalizeVector(doc.Vector)
+	}
+
+	if doc.ID != "" {
+		if stored, found := p.store.Get(doc.ID); found && stored.Chunk != nil {
+			return fmt.Errorf("id %s занят фрагментом документа %s", doc.ID, stored.Chunk.ParentID)
+		}
+		if existing, found := p.GetDocument(doc.ID); found {
+			if existing.Content == doc.Content && sameMetadata(existing.Metadata, doc.Metadata) {
+				report.Unchanged++
+				return nil
+			}
+
+			if doc.Metadata.Language == "" {
+				doc.Metadata.Language = DetectLanguage(doc.Content)
+			}
+			if err := p.store.ReplaceDocument(doc.ID, p.splitDocument(doc)); err != nil {
+				return err
+			}
+			report.Updated++
+			return nil
+		}
+	}
+
+	result, err := p.add(doc)
+	if err != nil {
+		return err
+	}
+
+	if result.Merged {
+		report.Merged++
+	} else {
+		report.Added++
+	}
+	return nil
+}
+
+// sameMetadata сравнивает метаданные через JSON, как они хранятся.
+func sameMetadata(a, b Metadata) bool {
+	if b.Language == "" {
+		b.Language = a.Language
+	}
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = a.CreatedAt
+	}
+
+	left, _ := json.Marshal(a)
+	right, _ := json.Marshal(b)
+	return bytes.Equal(left, right)
+}
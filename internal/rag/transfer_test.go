@@ -0,0 +1,32 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRecordID(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{name: "без ID", id: ""},
+		{name: "ULID", id: "doc_01J8Z3Q4W5E6R7T8Y9U0I1O2P3"},
+		{name: "кириллица в пределах", id: strings.Repeat("д", maxRecordIDBytes/2)},
+		{name: "латиница на пределе", id: strings.Repeat("a", maxRecordIDBytes)},
+		{name: "латиница длиннее", id: strings.Repeat("a", maxRecordIDBytes+1), wantErr: true},
+		{name: "кириллица длиннее в байтах", id: strings.Repeat("д", maxRecordIDBytes/2+1), wantErr: true},
+		{name: "пробел", id: "a b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRecord([]byte(`{"id":"` + tt.id + `","content":"текст"}`))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ошибка %v, ожидалась: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+}
@@ -1,261 +1,1023 @@
 package rag
 
 import (
+	"GolangtgBot/internal/ai"
+	"bytes"
 	"fmt"
-	"math"
-	"regexp"
+	"log"
+	"sort"
 	"strings"
 	"sync"
-	"unicode"
+	"time"
 )
 
 type Document struct {
-	ID      string
-	Content string
-	Vector  []float64
-	Tokens  []string
+	ID       string     `json:"id"`
+	Content  string     `json:"content"`
+	Metadata Metadata   `json:"metadata"`
+	Chunk    *ChunkInfo `json:"chunk,omitempty"`
+	// Vector хранится отдельно от JSON, в двоичном файле векторов
+	Vector []float64 `json:"-"`
+	// VectorModel - эмбеддер, которым посчитан Vector
+	VectorModel string   `json:"-"`
+	Tokens      []string `json:"-"`
+}
+
+// ChunkInfo связывает фрагмент с исходным документом.
+type ChunkInfo struct {
+	ParentID string `json:"parent_id"`
+	Position int    `json:"position"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Heading  string `json:"heading,omitempty"`
+}
+
+// indexText - текст, по которому документ индексируется: заголовок
+// раздела тоже участвует в поиске.
+func (d Document) indexText() string {
+	if d.Chunk != nil && d.Chunk.Heading != "" {
+		return d.Chunk.Heading + "\n" + d.Content
+	}
+	return d.Content
 }
 
 type VectorStore struct {
-	documents  []Document
-	vocabulary map[string]int
-	docVectors [][]float64
-	mu         sync.RWMutex
+	documents []Document
+	byID      map[string]int
+	byParent  map[string][]int
+	index     *InvertedIndex
+	dense     DenseIndex
+	newDense  func() DenseIndex
+	dupes     *duplicateIndex
+	embedder  ai.Embedder
+	tokenizer Tokenizer
+	scorer    Scorer
+	fuzzy     FuzzyOptions
+	snippets  SnippetOptions
+	storage   *Storage
+	mu        sync.RWMutex
+
+	// snapshotMu не даёт снапшотам пересекаться: иначе более старая
+	// копия могла бы перезаписать более новую
+	snapshotMu sync.Mutex
+
+	// deferDense откладывает заполнение плотного индекса при массовой
+	// загрузке, чтобы сначала попробовать восстановить сохранённый граф
+	deferDense bool
 }
 
 func NewVectorStore() *VectorStore {
 	return &VectorStore{
-		documents:  make([]Document, 0),
-		vocabulary: make(map[string]int),
-		docVectors: make([][]float64, 0),
+		documents: make([]Document, 0),
+		byID:      make(map[string]int),
+		byParent:  make(map[string][]int),
+		index:     NewInvertedIndex(),
+		dense:     NewFlatIndex(),
+		newDense:  func() DenseIndex { return NewFlatIndex() },
+		dupes:     newDuplicateIndex(),
+		tokenizer: NewUnicodeTokenizer(),
+		scorer:    NewBM25Scorer(DefaultBM25K1, DefaultBM25B),
+		snippets:  SnippetOptions{}.withDefaults(),
 	}
 }
 
+func (vs *VectorStore) SetScorer(scorer Scorer) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.scorer = scorer
+}
+
+// SetFuzzy включает поиск с опечатками.
+func (vs *VectorStore) SetFuzzy(opts FuzzyOptions) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.fuzzy = opts.withDefaults()
+}
+
+// SetSnippets задаёт длину выдержек в результатах поиска.
+func (vs *VectorStore) SetSnippets(opts SnippetOptions) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.snippets = opts.withDefaults()
+}
+
+// SetDenseIndex меняет реализацию плотного индекса, например на HNSW.
+// Уже посчитанные векторы переносятся в новый индекс.
+func (vs *VectorStore) SetDenseIndex(factory func() DenseIndex) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.newDense = factory
+	vs.dense = factory()
+	vs.fillDense()
+}
+
+// SetTokenizer меняет токенизатор и переиндексирует все документы.
+func (vs *VectorStore) SetTokenizer(tokenizer Tokenizer) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.tokenizer = tokenizer
+
+	docs := vs.liveDocuments()
+	for i := range docs {
+		docs[i].Tokens = vs.tokenize(docs[i].indexText())
+	}
+	vs.reindex(docs)
+}
+
 func (vs *VectorStore) tokenize(text string) []string {
-	text = strings.ToLower(text)
+	return vs.tokenizer.Tokenize(text)
+}
 
-	reg := regexp.MustCompile(`[^\w\sа-яё]`)
+// SetEmbedder включает векторный поиск и досчитывает векторы для
+// документов, у которых их нет или они посчитаны другой моделью.
+func (vs *VectorStore) SetEmbedder(embedder ai.Embedder) {
+	vs.mu.Lock()
+	vs.embedder = embedder
+	var stale []Document
+	for _, doc := range vs.liveDocuments() {
+		if doc.VectorModel != embedder.Name() {
+			stale = append(stale, doc)
+		}
+	}
+	vs.mu.Unlock()
 
-	text = reg.ReplaceAllString(text, " ")
+	if len(stale) == 0 {
+		return
+	}
 
-	words := strings.Fields(text)
+	embedDocuments(embedder, stale)
 
-	var tokens []string
-	stopWords := map[string]bool{
-		"и": true, "в": true, "на": true, "с": true, "по": true, "для": true,
-		"не": true, "что": true, "это": true, "как": true, "так": true,
-		"из": true, "у": true, "к": true, "о": true, "за": true, "от": true,
-		"то": true, "же": true, "все": true, "но": true, "вы": true, "бы": true,
-		"а": true, "мне": true, "вот": true, "до": true, "ну": true, "ли": true,
-		"если": true, "уже": true, "или": true, "ни": true, "быть": true, "был": true,
-		"про": true, "при": true, "год": true, "очень": true, "может": true, "есть": true,
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	for _, doc := range stale {
+		docNum, exists := vs.byID[doc.ID]
+		if !exists || doc.Vector == nil || vs.documents[docNum].Content != doc.Content {
+			continue
+		}
+		vs.documents[docNum].Vector = doc.Vector
+		vs.documents[docNum].VectorModel = doc.VectorModel
+		vs.dense.Add(docNum, doc.Vector)
 	}
 
-	for _, word := range words {
-		word = strings.TrimSpace(word)
-		if len(word) >= 2 && !stopWords[word] && isRussianWord(word) {
-			tokens = append(tokens, word)
+	log.Printf("Посчитаны векторы для %d документов (%s)", len(stale), embedder.Name())
+}
+
+// embedDocuments считает векторы пачками. При ошибке документы остаются
+// без векторов и находятся только лексическим поиском.
+func embedDocuments(embedder ai.Embedder, docs []Document) {
+	if embedder == nil {
+		return
+	}
+
+	const batchSize = 64
+	for start := 0; start < len(docs); start += batchSize {
+		end := start + batchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+
+		texts := make([]string, end-start)
+		for i := range texts {
+			texts[i] = docs[start+i].indexText()
+		}
+
+		vectors, err := embedder.Embed(texts)
+		if err != nil {
+			log.Printf("Ошибка расчёта эмбеддингов: %v", err)
+			continue
+		}
+
+		for i, vector := range vectors {
+			docs[start+i].Vector = normalizeVector(vector)
+			docs[start+i].VectorModel = embedder.Name()
 		}
 	}
+}
+
+func (vs *VectorStore) AddDocument(content string, meta Metadata) string {
+	ids, _ := vs.AddDocuments([]Document{{Content: content, Metadata: meta}})
+	return ids[0]
+}
+
+// AddDocuments добавляет пачку документов под одной блокировкой и
+// одной записью в журнал. Документам без ID назначается новый ULID,
+// документ с уже существующим ID заменяется. Токенизация выполняется
+// до захвата блокировки, чтобы не задерживать поиск.
+func (vs *VectorStore) AddDocuments(docs []Document) ([]string, error) {
+	vs.prepare(docs)
+	vs.embedMissing(docs)
+
+	return vs.commit(docs), nil
+}
+
+// commit сохраняет подготовленные документы.
+func (vs *VectorStore) commit(docs []Document) []string {
+	defer vs.snapshotIfNeeded()
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	ids := make([]string, len(docs))
+	stale := make(map[string]bool)
+	for i := range docs {
+		vs.upsert(docs[i], stale)
+		ids[i] = docs[i].ID
+	}
+	vs.rebuildSignatures(stale)
+
+	vs.persistAdd(docs)
 
-	return tokens
+	return ids
 }
 
-func isRussianWord(word string) bool {
-	russianCount := 0
-	totalCount := 0
+// AddChunks сохраняет фрагменты одного текста. ID исходного документа
+// общий для всех фрагментов, сами фрагменты получают суффикс позиции.
+func (vs *VectorStore) AddChunks(chunks []Chunk, meta Metadata) (string, []string) {
+	parentID := NewDocumentID()
+	docs := ChunkDocuments(parentID, chunks, meta)
 
-	for _, r := range word {
-		if unicode.Is(unicode.Cyrillic, r) {
-			russianCount++
+	ids, _ := vs.AddDocuments(docs)
+	return parentID, ids
+}
+
+// ChunkDocuments превращает фрагменты в документы, связанные с parentID.
+func ChunkDocuments(parentID string, chunks []Chunk, meta Metadata) []Document {
+	docs := make([]Document, len(chunks))
+	for i, chunk := range chunks {
+		docs[i] = Document{
+			ID:       fmt.Sprintf("%s_%d", parentID, chunk.Position),
+			Content:  chunk.Text,
+			Metadata: meta,
+			Chunk: &ChunkInfo{
+				ParentID: parentID,
+				Position: chunk.Position,
+				Start:    chunk.Start,
+				End:      chunk.End,
+				Heading:  chunk.Heading,
+			},
 		}
-		totalCount++
 	}
+	return docs
+}
 
-	return russianCount > 0 && float64(russianCount)/float64(totalCount) > 0.6
+// prepare назначает ID и дату создания и токенизирует документы.
+func (vs *VectorStore) prepare(docs []Document) {
+	now := time.Now()
+	for i := range docs {
+		if docs[i].ID == "" {
+			docs[i].ID = NewDocumentID()
+		}
+		if docs[i].Metadata.CreatedAt.IsZero() {
+			docs[i].Metadata.CreatedAt = now
+		}
+		docs[i].Tokens = vs.tokenize(docs[i].indexText())
+	}
 }
 
-func (vs *VectorStore) buildVocabulary() {
-	vs.vocabulary = make(map[string]int)
-	index := 0
+func (vs *VectorStore) embedMissing(docs []Document) {
+	vs.mu.RLock()
+	embedder := vs.embedder
+	vs.mu.RUnlock()
 
-	for _, doc := range vs.documents {
-		for _, token := range doc.Tokens {
-			if _, exists := vs.vocabulary[token]; !exists {
-				vs.vocabulary[token] = index
-				index++
-			}
+	embedMissing(embedder, docs)
+}
+
+// embedMissing считает векторы документам, у которых их нет. Векторы из
+// импорта переиспользуются, если их посчитал тот же эмбеддер.
+func embedMissing(embedder ai.Embedder, docs []Document) {
+	if embedder == nil {
+		return
+	}
+
+	var pending []int
+	for i := range docs {
+		if docs[i].Vector == nil || docs[i].VectorModel != embedder.Name() {
+			pending = append(pending, i)
 		}
 	}
+	if len(pending) == len(docs) {
+		embedDocuments(embedder, docs)
+		return
+	}
+
+	stale := make([]Document, len(pending))
+	for j, i := range pending {
+		stale[j] = docs[i]
+	}
+	embedDocuments(embedder, stale)
+	for j, i := range pending {
+		docs[i] = stale[j]
+	}
+}
+
+// Get возвращает документ или фрагмент по ID.
+func (vs *VectorStore) Get(id string) (Document, bool) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	docNum, exists := vs.byID[id]
+	if !exists {
+		return Document{}, false
+	}
+	return vs.documents[docNum], true
+}
+
+// Documents возвращает копию всех документов и фрагментов.
+func (vs *VectorStore) Documents() []Document {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	return vs.liveDocuments()
+}
+
+// Chunks возвращает фрагменты документа parentID по порядку.
+func (vs *VectorStore) Chunks(parentID string) []Document {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	chunks := make([]Document, 0, len(vs.byParent[parentID]))
+	for _, docNum := range vs.byParent[parentID] {
+		chunks = append(chunks, vs.documents[docNum])
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].Chunk.Position < chunks[j].Chunk.Position
+	})
+	return chunks
 }
 
-func (vs *VectorStore) textToVector(tokens []string) []float64 {
-	if len(vs.vocabulary) == 0 {
-		return []float64{}
+// DeleteDocument удаляет документ, а если id - это ID исходного
+// документа, то все его фрагменты. Возвращает число удалённых записей.
+func (vs *VectorStore) DeleteDocument(id string) (int, error) {
+	defer vs.snapshotIfNeeded()
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	removed := vs.removeByID(id)
+	if len(removed) == 0 {
+		return 0, fmt.Errorf("документ %s не найден", id)
 	}
 
-	vector := make([]float64, len(vs.vocabulary))
+	vs.persistDelete(removed)
+
+	return len(removed), nil
+}
+
+// DeleteWhere удаляет все документы и фрагменты, подходящие под фильтр.
+func (vs *VectorStore) DeleteWhere(filter Filter) (int, error) {
+	defer vs.snapshotIfNeeded()
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
 
-	tf := make(map[string]float64)
-	for _, token := range tokens {
-		if idx, exists := vs.vocabulary[token]; exists {
-			tf[token]++
-			vector[idx] = tf[token]
+	var removed []string
+	stale := make(map[string]bool)
+	for docNum, doc := range vs.documents {
+		if doc.ID != "" && filter.Match(doc) {
+			removed = append(removed, doc.ID)
+			stale[vs.remove(docNum)] = true
 		}
 	}
+	vs.rebuildSignatures(stale)
 
-	maxFreq := 0.0
-	for _, freq := range tf {
-		if freq > maxFreq {
-			maxFreq = freq
+	if len(removed) > 0 {
+		vs.compactIfSparse()
+		vs.persistDelete(removed)
+	}
+
+	return len(removed), nil
+}
+
+// FindDuplicates ищет документы, почти совпадающие с content, среди
+// прошедших фильтры. Фрагменты сравниваются как один документ.
+func (vs *VectorStore) FindDuplicates(content string, threshold float64, filters ...Filter) []Duplicate {
+	signature := minHashSignature(vs.tokenize(content))
+	if signature == nil {
+		return nil
+	}
+
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	return vs.dupes.similar(signature, threshold, func(group string) bool {
+		doc, found := vs.groupDocument(group)
+		return found && matchAll(doc, filters)
+	})
+}
+
+// DuplicateClusters находит группы почти одинаковых документов по всей базе.
+func (vs *VectorStore) DuplicateClusters(threshold float64) [][]string {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	return vs.dupes.clusters(threshold)
+}
+
+// groupDocument вызывается под блокировкой vs.mu и возвращает документ
+// или первый фрагмент документа с этим ID.
+func (vs *VectorStore) groupDocument(id string) (Document, bool) {
+	if docNum, exists := vs.byID[id]; exists {
+		return vs.documents[docNum], true
+	}
+	if docNums := vs.byParent[id]; len(docNums) > 0 {
+		return vs.documents[docNums[0]], true
+	}
+	return Document{}, false
+}
+
+// ReplaceDocument атомарно заменяет документ id (вместе с фрагментами)
+// на новый набор документов.
+func (vs *VectorStore) ReplaceDocument(id string, docs []Document) error {
+	vs.prepare(docs)
+	vs.embedMissing(docs)
+
+	return vs.replace(id, docs)
+}
+
+// replace заменяет документ уже подготовленными документами.
+func (vs *VectorStore) replace(id string, docs []Document) error {
+	defer vs.snapshotIfNeeded()
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	removed := vs.removeByID(id)
+	if len(removed) == 0 {
+		return fmt.Errorf("документ %s не найден", id)
+	}
+
+	stale := make(map[string]bool)
+	for _, doc := range docs {
+		vs.upsert(doc, stale)
+	}
+	vs.rebuildSignatures(stale)
+
+	vs.persistDelete(removed)
+	vs.persistAdd(docs)
+
+	return nil
+}
+
+// groupIDs возвращает ID документа id и всех его фрагментов.
+func (vs *VectorStore) groupIDs(id string) []string {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	var ids []string
+	if _, exists := vs.byID[id]; exists {
+		ids = append(ids, id)
+	}
+	for _, docNum := range vs.byParent[id] {
+		ids = append(ids, vs.documents[docNum].ID)
+	}
+	return ids
+}
+
+// removeByID вызывается под блокировкой vs.mu
+func (vs *VectorStore) removeByID(id string) []string {
+	var docNums []int
+	if docNum, exists := vs.byID[id]; exists {
+		docNums = append(docNums, docNum)
+	}
+	docNums = append(docNums, vs.byParent[id]...)
+
+	removed := make([]string, 0, len(docNums))
+	stale := make(map[string]bool)
+	for _, docNum := range docNums {
+		removed = append(removed, vs.documents[docNum].ID)
+		stale[vs.remove(docNum)] = true
+	}
+	vs.rebuildSignatures(stale)
+
+	vs.compactIfSparse()
+
+	return removed
+}
+
+// upsert вызывается под блокировкой vs.mu. Группы заменённых
+// документов попадают в stale, см. remove.
+func (vs *VectorStore) upsert(doc Document, stale map[string]bool) {
+	if docNum, exists := vs.byID[doc.ID]; exists {
+		stale[vs.remove(docNum)] = true
+	}
+	vs.insert(doc)
+}
+
+// insert вызывается под блокировкой vs.mu
+func (vs *VectorStore) insert(doc Document) {
+	docNum := len(vs.documents)
+	vs.documents = append(vs.documents, doc)
+	vs.byID[doc.ID] = docNum
+	vs.index.Add(docNum, doc.Tokens)
+	if doc.Vector != nil && !vs.deferDense {
+		vs.dense.Add(docNum, doc.Vector)
+	}
+
+	if doc.Chunk != nil {
+		vs.byParent[doc.Chunk.ParentID] = append(vs.byParent[doc.Chunk.ParentID], docNum)
+	}
+
+	if signature := minHashSignature(doc.Tokens); signature != nil {
+		vs.dupes.add(documentGroup(doc), signature)
+	}
+}
+
+// documentGroup - ID исходного документа для фрагмента или сам ID.
+func documentGroup(doc Document) string {
+	if doc.Chunk != nil {
+		return doc.Chunk.ParentID
+	}
+	return doc.ID
+}
+
+// remove оставляет на месте документа пустую запись, чтобы номера
+// остальных документов в индексе не сдвигались, и возвращает группу
+// документа. Подпись группы удаляется целиком: вызывающий пересобирает
+// её из оставшихся фрагментов один раз после всех удалений через
+// rebuildSignatures.
+func (vs *VectorStore) remove(docNum int) string {
+	doc := vs.documents[docNum]
+	if doc.ID == "" {
+		return ""
+	}
+
+	vs.index.Remove(docNum)
+	vs.dense.Remove(docNum)
+	vs.dupes.remove(documentGroup(doc))
+	delete(vs.byID, doc.ID)
+
+	if doc.Chunk != nil {
+		siblings := vs.byParent[doc.Chunk.ParentID]
+		for i, sibling := range siblings {
+			if sibling == docNum {
+				siblings = append(siblings[:i], siblings[i+1:]...)
+				break
+			}
+		}
+		if len(siblings) == 0 {
+			delete(vs.byParent, doc.Chunk.ParentID)
+		} else {
+			vs.byParent[doc.Chunk.ParentID] = siblings
 		}
 	}
 
-	if maxFreq > 0 {
-		for token, freq := range tf {
-			if idx, exists := vs.vocabulary[token]; exists {
-				vector[idx] = freq / maxFreq
+	vs.documents[docNum] = Document{}
+	return documentGroup(doc)
+}
+
+// rebuildSignatures вызывается под блокировкой vs.mu и собирает подписи
+// групп заново из оставшихся в них документов. Удалённые целиком группы
+// просто остаются без подписи.
+func (vs *VectorStore) rebuildSignatures(groups map[string]bool) {
+	for group := range groups {
+		if group == "" {
+			continue
+		}
+		vs.dupes.remove(group)
+
+		var signature []uint64
+		merge := func(doc Document) {
+			next := minHashSignature(doc.Tokens)
+			if next == nil {
+				return
+			}
+			if signature == nil {
+				signature = next
+				return
+			}
+			for i := range signature {
+				signature[i] = min(signature[i], next[i])
 			}
 		}
+
+		if docNum, exists := vs.byID[group]; exists {
+			merge(vs.documents[docNum])
+		}
+		for _, docNum := range vs.byParent[group] {
+			merge(vs.documents[docNum])
+		}
+		if signature != nil {
+			vs.dupes.add(group, signature)
+		}
+	}
+}
+
+// compactIfSparse перестраивает индекс, когда удалённых записей
+// становится больше, чем живых.
+func (vs *VectorStore) compactIfSparse() {
+	deleted := len(vs.documents) - len(vs.byID)
+	if deleted < 64 || deleted < len(vs.byID) {
+		return
+	}
+
+	vs.reindex(vs.liveDocuments())
+}
+
+// reindex вызывается под блокировкой vs.mu. Граф плотного индекса не
+// строится заново, а переносится на новые номера документов по ID.
+func (vs *VectorStore) reindex(docs []Document) {
+	var graph bytes.Buffer
+	if index, ok := vs.dense.(persistentIndex); ok {
+		previous := vs.documents
+		if err := index.Save(&graph, func(docNum int) string { return previous[docNum].ID }); err != nil {
+			graph.Reset()
+		}
+	}
+
+	vs.documents = make([]Document, 0, len(docs))
+	vs.byID = make(map[string]int, len(docs))
+	vs.byParent = make(map[string][]int)
+	vs.index = NewInvertedIndex()
+	vs.dense = vs.newDense()
+	vs.dupes = newDuplicateIndex()
+
+	vs.deferDense = true
+	for _, doc := range docs {
+		vs.insert(doc)
+	}
+	vs.deferDense = false
+
+	if graph.Len() > 0 {
+		if err := vs.loadDense(graph.Bytes()); err != nil {
+			log.Printf("Не удалось перенести граф векторного индекса: %v", err)
+		}
+	}
+	vs.fillDense()
+}
+
+// loadDense восстанавливает граф плотного индекса, сопоставляя узлы
+// документам по ID. Вызывается под блокировкой vs.mu.
+func (vs *VectorStore) loadDense(data []byte) error {
+	index, ok := vs.dense.(persistentIndex)
+	if !ok {
+		return nil
 	}
 
-	return vector
+	return index.Load(bytes.NewReader(data), func(id string) (int, []float64, bool) {
+		docNum, exists := vs.byID[id]
+		if !exists || vs.documents[docNum].Vector == nil {
+			return 0, nil, false
+		}
+		return docNum, vs.documents[docNum].Vector, true
+	})
 }
 
-func cosineSimilarity(a, b []float64) float64 {
-	if len(a) == 0 || len(b) == 0 {
-		return 0
+// fillDense добавляет в плотный индекс векторы, которых в нём ещё нет,
+// и возвращает их число. Вызывается под блокировкой vs.mu.
+func (vs *VectorStore) fillDense() int {
+	restored, _ := vs.dense.(persistentIndex)
+
+	added := 0
+	for docNum, doc := range vs.documents {
+		if doc.ID == "" || doc.Vector == nil {
+			continue
+		}
+		if restored != nil && restored.Contains(docNum) {
+			continue
+		}
+		vs.dense.Add(docNum, doc.Vector)
+		added++
 	}
+	return added
+}
 
-	dotProduct := 0.0
-	normA := 0.0
-	normB := 0.0
+func (vs *VectorStore) liveDocuments() []Document {
+	docs := make([]Document, 0, len(vs.byID))
+	for _, doc := range vs.documents {
+		if doc.ID != "" {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
 
-	minLen := len(a)
-	if len(b) < minLen {
-		minLen = len(b)
+// ExpandChunk возвращает фрагмент вместе с window соседями с каждой
+// стороны; window < 0 - весь исходный документ. Перекрывающиеся части
+// соседних фрагментов склеиваются по смещениям.
+func (vs *VectorStore) ExpandChunk(doc Document, window int) Document {
+	if doc.Chunk == nil || window == 0 {
+		return doc
 	}
 
-	for i := 0; i < minLen; i++ {
-		dotProduct += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	var siblings []Document
+	for _, docNum := range vs.byParent[doc.Chunk.ParentID] {
+		sibling := vs.documents[docNum]
+		distance := sibling.Chunk.Position - doc.Chunk.Position
+		if window < 0 || (distance >= -window && distance <= window) {
+			siblings = append(siblings, sibling)
+		}
 	}
 
-	if normA == 0 || normB == 0 {
-		return 0
+	sort.Slice(siblings, func(i, j int) bool {
+		return siblings[i].Chunk.Start < siblings[j].Chunk.Start
+	})
+
+	var builder strings.Builder
+	covered := -1
+	for _, sibling := range siblings {
+		info := sibling.Chunk
+		if info.End <= covered {
+			continue
+		}
+
+		content := sibling.Content
+		if info.Start < covered {
+			content = content[covered-info.Start:]
+		} else if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+
+		builder.WriteString(content)
+		covered = info.End
 	}
 
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+	expanded := doc
+	expanded.Content = builder.String()
+	return expanded
 }
 
-func (vs *VectorStore) AddDocument(content string) string {
+// AttachStorage загружает сохранённые документы и включает запись
+// всех последующих изменений в журнал.
+func (vs *VectorStore) AttachStorage(storage *Storage) error {
+	docs, err := storage.Load()
+	if err != nil {
+		return err
+	}
+
+	if err := storage.RestoreVectors(docs); err != nil {
+		log.Printf("Векторы будут посчитаны заново: %v", err)
+	}
+
 	vs.mu.Lock()
 	defer vs.mu.Unlock()
 
-	id := fmt.Sprintf("doc_%d", len(vs.documents))
-	tokens := vs.tokenize(content)
+	vs.deferDense = true
+	stale := make(map[string]bool)
+	for _, doc := range docs {
+		doc.Tokens = vs.tokenize(doc.indexText())
+		vs.upsert(doc, stale)
+	}
+	vs.rebuildSignatures(stale)
+	vs.deferDense = false
+
+	graph, err := storage.ReadIndex()
+	if err != nil {
+		log.Printf("Ошибка чтения векторного индекса: %v", err)
+	}
+	if graph != nil {
+		if err := vs.loadDense(graph); err != nil {
+			log.Printf("Векторный индекс будет построен заново: %v", err)
+		}
+	}
 
-	doc := Document{
-		ID:      id,
-		Content: content,
-		Tokens:  tokens,
+	start := time.Now()
+	if added := vs.fillDense(); added > 0 {
+		log.Printf("Векторный индекс: %d из %d векторов добавлено за %v", added, vs.dense.Len(), time.Since(start).Round(time.Millisecond))
 	}
 
-	vs.documents = append(vs.documents, doc)
+	vs.storage = storage
+
+	return nil
+}
+
+// persistAdd дописывает документы в журнал. Вызывается под блокировкой
+// vs.mu, снапшот пишет snapshotIfNeeded уже после неё.
+func (vs *VectorStore) persistAdd(docs []Document) {
+	if vs.storage == nil || len(docs) == 0 {
+		return
+	}
+
+	if err := vs.storage.AppendAdd(docs...); err != nil {
+		log.Printf("Ошибка записи %d документов в журнал: %v", len(docs), err)
+	}
+}
 
-	vs.buildVocabulary()
-	vs.updateAllVectors()
+func (vs *VectorStore) persistDelete(ids []string) {
+	if vs.storage == nil || len(ids) == 0 {
+		return
+	}
 
-	return id
+	if err := vs.storage.AppendDelete(ids...); err != nil {
+		log.Printf("Ошибка записи удаления %d документов в журнал: %v", len(ids), err)
+	}
 }
 
-func (vs *VectorStore) updateAllVectors() {
-	vs.docVectors = make([][]float64, len(vs.documents))
-	for i, doc := range vs.documents {
-		vs.docVectors[i] = vs.textToVector(doc.Tokens)
+// snapshotIfNeeded пишет снапшот, когда журнал вырос до порога.
+// Вызывается без блокировки vs.mu.
+func (vs *VectorStore) snapshotIfNeeded() {
+	vs.mu.RLock()
+	storage := vs.storage
+	vs.mu.RUnlock()
+
+	if storage != nil && storage.NeedsSnapshot() {
+		vs.Snapshot()
 	}
 }
 
-func (vs *VectorStore) SearchSimilar(query string, topK int) []Document {
+// Snapshot сохраняет снапшот и граф векторного индекса. Под блокировкой
+// vs.mu снимаются только копии документов и графа, на диск они пишутся
+// уже без неё, чтобы не останавливать поиск и запись.
+func (vs *VectorStore) Snapshot() {
+	vs.snapshotMu.Lock()
+	defer vs.snapshotMu.Unlock()
+
 	vs.mu.RLock()
-	defer vs.mu.RUnlock()
+	storage := vs.storage
+	if storage == nil {
+		vs.mu.RUnlock()
+		return
+	}
 
-	if len(vs.documents) == 0 {
-		return []Document{}
+	seq := storage.Seq()
+	docs := vs.liveDocuments()
+
+	var graph bytes.Buffer
+	var graphErr error
+	index, persistent := vs.dense.(persistentIndex)
+	if persistent {
+		graphErr = index.Save(&graph, func(docNum int) string { return vs.documents[docNum].ID })
 	}
+	vs.mu.RUnlock()
 
-	queryTokens := vs.tokenize(query)
-	queryVector := vs.textToVector(queryTokens)
+	if err := storage.WriteSnapshot(docs, seq); err != nil {
+		log.Printf("Ошибка сохранения снапшота базы знаний: %v", err)
+		return
+	}
+	if err := storage.WriteVectors(docs); err != nil {
+		log.Printf("Ошибка сохранения векторов: %v", err)
+	}
 
-	type scoredDoc struct {
-		doc   Document
-		score float64
+	if persistent {
+		if graphErr == nil {
+			graphErr = storage.WriteIndex(graph.Bytes())
+		}
+		if graphErr != nil {
+			log.Printf("Ошибка сохранения векторного индекса: %v", graphErr)
+		}
 	}
+}
 
-	scoredDocs := make([]scoredDoc, 0, len(vs.documents))
+func (vs *VectorStore) StartSnapshots(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
 
-	for i, docVector := range vs.docVectors {
-		score := cosineSimilarity(queryVector, docVector)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 
-		if score > 0.05 {
-			scoredDocs = append(scoredDocs, scoredDoc{
-				doc:   vs.documents[i],
-				score: score,
-			})
+		for range ticker.C {
+			vs.Snapshot()
 		}
+	}()
+}
+
+// SearchSimilar ищет topK документов, прошедших все фильтры, и
+// возвращает их с баллами и местами в выдаче.
+func (vs *VectorStore) SearchSimilar(query string, topK int, filters ...Filter) []SearchHit {
+	return rankHits(vs.SearchLexical(query, topK, filters...))
+}
+
+// SearchLexical ранжирует документы по совпадению терминов выбранным Scorer.
+func (vs *VectorStore) SearchLexical(query string, topK int, filters ...Filter) []SearchHit {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	if len(vs.byID) == 0 {
+		return []SearchHit{}
+	}
+
+	queryTerms := termFrequencies(vs.tokenize(query))
+	if len(queryTerms) == 0 {
+		return []SearchHit{}
 	}
 
-	for i := 0; i < len(scoredDocs); i++ {
-		for j := i + 1; j < len(scoredDocs); j++ {
-			if scoredDocs[j].score > scoredDocs[i].score {
-				scoredDocs[i], scoredDocs[j] = scoredDocs[j], scoredDocs[i]
+	fuzzyTerms := vs.fuzzyTerms(query, queryTerms)
+	candidates := vs.index.Candidates(queryTerms, fuzzyTerms)
+	hits := make([]SearchHit, 0, len(candidates))
+	corpus := vs.index.Corpus()
+	minScore := vs.scorer.MinScore()
+
+	for _, docNum := range candidates {
+		if !matchAll(vs.documents[docNum], filters) {
+			continue
+		}
+
+		stats, _ := vs.index.DocStats(docNum)
+		score := vs.scorer.Score(queryTerms, stats, corpus)
+
+		// Термины с опечатками считаются по одному с пониженным весом
+		for term, weight := range fuzzyTerms {
+			if stats.TermFreq[term] > 0 {
+				score += weight * vs.scorer.Score(map[string]int{term: 1}, stats, corpus)
 			}
 		}
+
+		if score > minScore {
+			hits = append(hits, SearchHit{
+				Document:   vs.documents[docNum],
+				Score:      score,
+				Retrievers: map[string]float64{RetrieverLexical: score},
+			})
+		}
 	}
 
-	if len(scoredDocs) > topK {
-		scoredDocs = scoredDocs[:topK]
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Document.ID < hits[j].Document.ID
+	})
+
+	if len(hits) > topK {
+		hits = hits[:topK]
 	}
 
-	result := make([]Document, len(scoredDocs))
-	for i, sd := range scoredDocs {
-		result[i] = sd.doc
+	terms := snippetTerms(queryTerms, fuzzyTerms)
+	for i := range hits {
+		hits[i].Snippet = vs.snippet(hits[i].Document.Content, terms)
 	}
 
-	return result
+	return hits
 }
 
-func (vs *VectorStore) LoadSampleData() {
-	sampleData := []string{
-		"RAG Retrieval Augmented Generation архитектура поиск информация генерация текст",
-		"RAG сначала ищет релевантные документы базе знаний затем использует генерацию ответа",
-		"Векторный поиск позволяет находить семантически похожие тексты точное совпадение слов",
-		"Telegram боты создаются BotFather используют API отправки сообщений",
-		"Go Golang статически типизированный язык программирования сборщик мусора поддержка многопоточности",
-		"Docker позволяет упаковывать приложения контейнеры удобное развертывание",
-		"API ключи необходимы доступа сервисам искусственного интеллекта DeepSeek OpenRouter",
-		"Программирование разработка программ обеспечение компьютеров алгоритмы код",
-		"Искусственный интеллект AI машинное обучение нейронные сети данные обучение модели",
-		"База данных хранение информации структурированные данные запросы SQL",
-		"Веб разработка создание сайтов приложений интерфейсы backend frontend",
-		"Мобильные приложения iOS Android разработка телефоны планшеты",
-		"Облачные вычисления сервера хранение данных AWS Google Cloud Azure",
-		"Блокчейн криптовалюты Bitcoin Ethereum смарт контракты децентрализация",
+// SearchDense ищет документы по близости эмбеддингов. Без эмбеддера
+// возвращает пустой список.
+func (vs *VectorStore) SearchDense(query string, topK int, filters ...Filter) []SearchHit {
+	vs.mu.RLock()
+	embedder := vs.embedder
+	vs.mu.RUnlock()
+
+	if embedder == nil {
+		return []SearchHit{}
+	}
+
+	vectors, err := embedder.Embed([]string{query})
+	if err != nil || len(vectors) == 0 {
+		log.Printf("Ошибка расчёта эмбеддинга запроса: %v", err)
+		return []SearchHit{}
 	}
+	queryVector := normalizeVector(vectors[0])
 
-	for _, content := range sampleData {
-		vs.AddDocument(content)
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	accept := func(docNum int) bool {
+		return matchAll(vs.documents[docNum], filters)
+	}
+
+	found := vs.dense.Search(queryVector, topK, accept)
+	hits := make([]SearchHit, 0, len(found))
+	for _, hit := range found {
+		if hit.Score <= 0 {
+			continue
+		}
+		hits = append(hits, SearchHit{
+			Document:   vs.documents[hit.DocNum],
+			Score:      hit.Score,
+			Retrievers: map[string]float64{RetrieverDense: hit.Score},
+		})
 	}
+
+	vs.attachSnippetsLocked(query, hits)
+	return hits
+}
+
+func (vs *VectorStore) Len() int {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	return len(vs.byID)
 }
 
 func (vs *VectorStore) GetStats() map[string]interface{} {
 	vs.mu.RLock()
 	defer vs.mu.RUnlock()
 
+	vocabularySize := vs.index.VocabularySize()
+
+	embedderName := "нет"
+	if vs.embedder != nil {
+		embedderName = vs.embedder.Name()
+	}
+
 	return map[string]interface{}{
-		"total_documents": len(vs.documents),
-		"vocabulary_size": len(vs.vocabulary),
-		"store_size":      fmt.Sprintf("%d docs, %d words", len(vs.documents), len(vs.vocabulary)),
+		"total_documents": len(vs.byID),
+		"embedded":        vs.dense.Len(),
+		"embedder":        embedderName,
+		"backend":         BackendMemory,
+		"vocabulary_size": vocabularySize,
+		"scorer":          vs.scorer.Name(),
+		"store_size":      fmt.Sprintf("%d docs, %d words", len(vs.byID), vocabularySize),
 	}
 }